@@ -0,0 +1,33 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2025, 5, 31, 23, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+
+	if got := f.Now(); !got.Equal(start) {
+		t.Errorf("Expected %v, got %v", start, got)
+	}
+
+	f.Advance(2 * time.Hour)
+	if got := f.Now(); got.Month() != time.June || got.Day() != 1 {
+		t.Errorf("Expected the clock to move into June, got %v", got)
+	}
+
+	f.Set(start)
+	if got := f.Now(); !got.Equal(start) {
+		t.Errorf("Expected %v after Set, got %v", start, got)
+	}
+}
+
+func TestRealIsAClock(t *testing.T) {
+	var c Clock = Real{}
+	before := time.Now()
+	if got := c.Now(); got.Before(before) {
+		t.Errorf("Expected a time at or after %v, got %v", before, got)
+	}
+}
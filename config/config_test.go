@@ -0,0 +1,148 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func setRequiredEnv(t *testing.T) {
+	t.Setenv("PSQL_URL", "postgres://user:pass@db:5432/accounting?sslmode=disable")
+	t.Setenv("LINE_CHANNEL_SECRET", "secret")
+	t.Setenv("LINE_CHANNEL_ACCESS_TOKEN", "token")
+}
+
+func TestInitFailsWithoutSecrets(t *testing.T) {
+	for _, name := range []string{"PSQL_URL", "LINE_CHANNEL_SECRET", "LINE_CHANNEL_ACCESS_TOKEN"} {
+		t.Run(name, func(t *testing.T) {
+			cfg = Config{}
+			setRequiredEnv(t)
+			t.Setenv(name, "")
+
+			if _, err := Init(); err == nil {
+				t.Errorf("Expected Init to fail when %s is empty", name)
+			}
+		})
+	}
+}
+
+func TestInitSucceedsWithSecrets(t *testing.T) {
+	cfg = Config{}
+	setRequiredEnv(t)
+
+	c, err := Init()
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if c.Line.ChannelSecret != "secret" || c.Line.ChannelAccessToken != "token" {
+		t.Errorf("Unexpected LINE config: %+v", c.Line)
+	}
+	if c.Db.PsqlUrl != "postgres://user:pass@db:5432/accounting?sslmode=disable" {
+		t.Errorf("Unexpected PSQL_URL: %q", c.Db.PsqlUrl)
+	}
+}
+
+func TestInitRejectsMalformedPort(t *testing.T) {
+	for _, port := range []string{"abc", "0", "70000", "80a"} {
+		t.Run(port, func(t *testing.T) {
+			cfg = Config{}
+			setRequiredEnv(t)
+			t.Setenv("PORT", port)
+
+			if _, err := Init(); err == nil {
+				t.Errorf("Expected Init to fail for PORT %q", port)
+			}
+		})
+	}
+}
+
+func TestInitRejectsUnknownTimezone(t *testing.T) {
+	cfg = Config{}
+	setRequiredEnv(t)
+	t.Setenv("APP_TIMEZONE", "Mars/Olympus_Mons")
+
+	if _, err := Init(); err == nil {
+		t.Error("Expected Init to fail for an unknown timezone")
+	}
+}
+
+func TestInitRejectsNegativeRateLimit(t *testing.T) {
+	cfg = Config{}
+	setRequiredEnv(t)
+	t.Setenv("RATE_LIMIT_PER_MINUTE", "-1")
+
+	if _, err := Init(); err == nil {
+		t.Error("Expected Init to fail for a negative RATE_LIMIT_PER_MINUTE")
+	}
+}
+
+func TestPoolSettingsFromEnv(t *testing.T) {
+	cfg = Config{}
+	setRequiredEnv(t)
+	t.Setenv("DB_MAX_OPEN_CONNS", "4")
+	t.Setenv("DB_MAX_IDLE_CONNS", "2")
+	t.Setenv("DB_CONN_MAX_LIFETIME", "90s")
+
+	want := Pool{MaxOpenConns: 4, MaxIdleConns: 2, ConnMaxLifetime: 90 * time.Second}
+
+	c, err := Init()
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if c.Db.Pool != want {
+		t.Errorf("Init pool = %+v, expected %+v", c.Db.Pool, want)
+	}
+
+	pool, err := LoadPool()
+	if err != nil {
+		t.Fatalf("LoadPool failed: %v", err)
+	}
+	if pool != want {
+		t.Errorf("LoadPool = %+v, expected %+v", pool, want)
+	}
+
+	t.Setenv("DB_MAX_OPEN_CONNS", "-1")
+	if _, err := LoadPool(); err == nil {
+		t.Error("Expected LoadPool to fail for a negative DB_MAX_OPEN_CONNS")
+	}
+}
+
+func TestPoolDefaults(t *testing.T) {
+	pool, err := LoadPool()
+	if err != nil {
+		t.Fatalf("LoadPool failed: %v", err)
+	}
+	if want := (Pool{MaxOpenConns: 10, MaxIdleConns: 5, ConnMaxLifetime: 5 * time.Minute}); pool != want {
+		t.Errorf("Default pool = %+v, expected %+v", pool, want)
+	}
+}
+
+func TestRetrySettings(t *testing.T) {
+	retry, err := LoadRetry()
+	if err != nil {
+		t.Fatalf("LoadRetry failed: %v", err)
+	}
+	if want := (Retry{MaxAttempts: 5, BaseDelay: time.Second}); retry != want {
+		t.Errorf("Default retry = %+v, expected %+v", retry, want)
+	}
+
+	t.Setenv("DB_CONNECT_MAX_ATTEMPTS", "8")
+	t.Setenv("DB_CONNECT_BASE_DELAY", "250ms")
+	retry, err = LoadRetry()
+	if err != nil {
+		t.Fatalf("LoadRetry failed: %v", err)
+	}
+	if want := (Retry{MaxAttempts: 8, BaseDelay: 250 * time.Millisecond}); retry != want {
+		t.Errorf("LoadRetry = %+v, expected %+v", retry, want)
+	}
+
+	t.Setenv("DB_CONNECT_MAX_ATTEMPTS", "0")
+	if _, err := LoadRetry(); err == nil {
+		t.Error("Expected LoadRetry to fail for zero attempts")
+	}
+
+	cfg = Config{}
+	setRequiredEnv(t)
+	if _, err := Init(); err == nil {
+		t.Error("Expected Init to fail for zero attempts")
+	}
+}
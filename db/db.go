@@ -3,18 +3,29 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"math/rand"
-	"time"
+	"regexp"
+	"sync/atomic"
 
 	"accountingbot/config"
 	"accountingbot/logger"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 var DB *sql.DB
 
+// ready is set once DB is connected and migrated. Probes run while Init is still retrying,
+// so they check it before touching DB.
+var ready atomic.Bool
+
+// Ready reports whether Init has connected to the database and applied the migrations
+func Ready() bool {
+	return ready.Load()
+}
+
 // Init initializes the database connection
 func Init(ctx context.Context) {
 	// Start tracing span
@@ -32,27 +43,10 @@ func Init(ctx context.Context) {
 		logger.Fatal(ctx, "Failed to create database connection", "error", err.Error())
 	}
 
-	// Set connection pool
-	DB.SetMaxOpenConns(25)
-	DB.SetMaxIdleConns(5)
-	DB.SetConnMaxLifetime(5 * time.Minute)
+	configurePool(ctx, cfg.Db.Pool)
 
 	// Try to connect
-	retries := 5
-	for i := range retries {
-		err = DB.PingContext(ctx)
-		if err == nil {
-			break
-		}
-
-		logger.Warn(ctx, "Database connection test failed, retrying later",
-			"attempt", i+1,
-			"max_attempts", retries,
-			"error", err.Error(),
-		)
-
-		time.Sleep(3 * time.Second)
-	}
+	err = connectWithRetry(ctx, cfg.Db.Retry, DB.PingContext, sleepContext)
 
 	if err != nil {
 		logger.Fatal(ctx, "Failed to connect to database", "error", err.Error())
@@ -60,13 +54,42 @@ func Init(ctx context.Context) {
 
 	logger.Info(ctx, "Database connection successful")
 	createTables(ctx)
+	ready.Store(true)
+}
+
+// configurePool applies the connection pool settings to DB
+func configurePool(ctx context.Context, pool config.Pool) {
+	DB.SetMaxOpenConns(pool.MaxOpenConns)
+	DB.SetMaxIdleConns(pool.MaxIdleConns)
+	DB.SetConnMaxLifetime(pool.ConnMaxLifetime)
+
+	logger.Info(ctx, "Database pool configured",
+		"max_open_conns", pool.MaxOpenConns,
+		"max_idle_conns", pool.MaxIdleConns,
+		"conn_max_lifetime", pool.ConnMaxLifetime.String())
 }
 
 // generateTestDbName generates a unique database name using timestamp and random suffix
-func generateTestDbName(dbName string) string {
+func generateTestDbName(dbName string) (string, error) {
 	randomSuffix := rand.Intn(1_000_000_000_000)
 
-	return fmt.Sprintf("%s_%010d", dbName, randomSuffix)
+	name := fmt.Sprintf("%s_%010d", dbName, randomSuffix)
+	if err := validateTestDbName(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// testDbNamePattern is what a test database name may contain, so it is always a plain
+// Postgres identifier of at most 63 bytes
+var testDbNamePattern = regexp.MustCompile(`^[a-z0-9_]{1,63}$`)
+
+// validateTestDbName rejects names that are not plain lowercase identifiers
+func validateTestDbName(name string) error {
+	if !testDbNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid test database name %q: only a-z, 0-9 and _ are allowed, up to 63 characters", name)
+	}
+	return nil
 }
 
 // Init 初始化資料庫連線
@@ -85,8 +108,11 @@ func SetupTestDB(ctx context.Context) string {
 		logger.Fatal(ctx, "Failed to create database connection", "error", err.Error())
 	}
 
-	testDbName := generateTestDbName("accounting")
-	_, err = DB.Exec(fmt.Sprintf("CREATE DATABASE %s", testDbName))
+	testDbName, err := generateTestDbName("accounting")
+	if err != nil {
+		logger.Fatal(ctx, "Invalid test database name", "error", err.Error())
+	}
+	_, err = DB.Exec("CREATE DATABASE " + pq.QuoteIdentifier(testDbName))
 	if err != nil {
 		logger.Fatal(ctx, "Failed to create test database", "error", err.Error())
 	}
@@ -101,34 +127,27 @@ func SetupTestDB(ctx context.Context) string {
 		logger.Fatal(ctx, "Failed to create database connection", "error", err.Error())
 	}
 
-	// Set connection pool
-	DB.SetMaxOpenConns(25)
-	DB.SetMaxIdleConns(5)
-	DB.SetConnMaxLifetime(5 * time.Minute)
-
-	// Try to connect
-	retries := 5
-	for i := range retries {
-		err = DB.PingContext(ctx)
-		if err == nil {
-			break
-		}
-
-		logger.Warn(ctx, "Database connection test failed, retrying later",
-			"attempt", i+1,
-			"max_attempts", retries,
-			"error", err.Error(),
-		)
+	pool, err := config.LoadPool()
+	if err != nil {
+		logger.Fatal(ctx, "Invalid database pool configuration", "error", err.Error())
+	}
+	configurePool(ctx, pool)
 
-		time.Sleep(3 * time.Second)
+	retry, err := config.LoadRetry()
+	if err != nil {
+		logger.Fatal(ctx, "Invalid database retry configuration", "error", err.Error())
 	}
 
+	// Try to connect
+	err = connectWithRetry(ctx, retry, DB.PingContext, sleepContext)
+
 	if err != nil {
 		logger.Fatal(ctx, "Failed to connect to database", "error", err.Error())
 	}
 
 	logger.Info(ctx, "Database connection successful")
 	createTables(ctx)
+	ready.Store(true)
 
 	return testDbName
 }
@@ -139,6 +158,11 @@ func CleanupTestDB(ctx context.Context, testDbName string) error {
 	ctx, span := logger.StartSpan(ctx, "db.CleanupTestDB")
 	defer span.End()
 
+	if err := validateTestDbName(testDbName); err != nil {
+		logger.Error(ctx, "Refusing to drop test database", "error", err.Error())
+		return err
+	}
+
 	// Close current test DB connection
 	if DB != nil {
 		DB.Close()
@@ -154,12 +178,12 @@ func CleanupTestDB(ctx context.Context, testDbName string) error {
 	defer adminDB.Close()
 
 	// Terminate all connections to the test database before dropping (PostgreSQL requirement)
-	_, _ = adminDB.ExecContext(ctx, fmt.Sprintf(
-		`SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = '%s';`, testDbName,
-	))
+	_, _ = adminDB.ExecContext(ctx,
+		`SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = $1`, testDbName,
+	)
 
 	// Drop the test database
-	_, err = adminDB.ExecContext(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %s", testDbName))
+	_, err = adminDB.ExecContext(ctx, "DROP DATABASE IF EXISTS "+pq.QuoteIdentifier(testDbName))
 	if err != nil {
 		logger.Error(ctx, "Failed to drop test database", "test_db", testDbName, "error", err.Error())
 		return err
@@ -169,44 +193,65 @@ func CleanupTestDB(ctx context.Context, testDbName string) error {
 	return nil
 }
 
-// createTables creates the required tables
+// createTables applies pending schema migrations
 func createTables(ctx context.Context) {
 	ctx, span := logger.StartSpan(ctx, "db.createTables")
 	defer span.End()
 
 	logger.Info(ctx, "Checking and creating tables")
 
-	query := `
-        CREATE TABLE IF NOT EXISTS categories (
-            id SERIAL PRIMARY KEY,
-            user_id TEXT NOT NULL,
-            name TEXT NOT NULL,
-            type TEXT NOT NULL,
-            UNIQUE(user_id, name)
-        );
-
-        CREATE TABLE IF NOT EXISTS transactions (
-            id SERIAL PRIMARY KEY,
-            user_id TEXT NOT NULL,
-            type TEXT NOT NULL,
-            amount INTEGER NOT NULL,
-            category_id INTEGER NOT NULL,
-            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			CONSTRAINT fk_category_id
-			    FOREIGN KEY (category_id)
-			    REFERENCES categories(id)
-			    ON DELETE CASCADE
-        );
-    `
-
-	_, err := DB.ExecContext(ctx, query)
-	if err != nil {
+	if _, err := Migrate(ctx); err != nil {
 		logger.Fatal(ctx, "Failed to create tables", "error", err.Error())
 	}
 
 	logger.Info(ctx, "Tables checked/created")
 }
 
+// Ping checks whether the database is reachable
+func Ping(ctx context.Context) error {
+	ctx, span := logger.StartSpan(ctx, "db.ping")
+	defer span.End()
+
+	if !Ready() || DB == nil {
+		return errors.New("database not initialized")
+	}
+	return DB.PingContext(ctx)
+}
+
+// WithTx runs fn inside a database transaction. The transaction is committed when fn
+// returns nil and rolled back when it returns an error or panics.
+func WithTx(ctx context.Context, fn func(tx *sql.Tx) error) (err error) {
+	ctx, span := logger.StartSpan(ctx, "db.withTx")
+	defer span.End()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error(ctx, "Failed to begin transaction", "error", err.Error())
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			logger.Error(ctx, "Failed to roll back transaction", "error", rbErr.Error())
+		}
+		logger.Warn(ctx, "Transaction rolled back", "error", err.Error())
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error(ctx, "Failed to commit transaction", "error", err.Error())
+		return err
+	}
+	return nil
+}
+
 // QueryContext executes a query and returns rows
 func QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
 	ctx, span := logger.StartSpan(ctx, "db.query")
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"accountingbot/config"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateTestDbName(t *testing.T) {
+	name, err := generateTestDbName("accounting")
+	if err != nil {
+		t.Fatalf("generateTestDbName failed: %v", err)
+	}
+	if !strings.HasPrefix(name, "accounting_") {
+		t.Errorf("Expected an accounting_ prefix, got %q", name)
+	}
+
+	for _, base := range []string{
+		"accounting; DROP DATABASE postgres; --",
+		`accounting"`,
+		"Accounting",
+		"accounting-test",
+		"測試",
+		strings.Repeat("a", 60),
+	} {
+		if name, err := generateTestDbName(base); err == nil {
+			t.Errorf("Expected %q to be rejected, got %q", base, name)
+		}
+	}
+}
+
+func TestCleanupTestDBRejectsInvalidName(t *testing.T) {
+	if err := CleanupTestDB(context.Background(), "postgres; --"); err == nil {
+		t.Error("Expected an invalid name to be rejected")
+	}
+
+	// The test database connection is left open when the name is rejected
+	if err := Ping(context.Background()); err != nil {
+		t.Errorf("Expected the connection to stay open, got %v", err)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	base := time.Second
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, maxRetryDelay, maxRetryDelay} {
+		for range 20 {
+			delay := backoffDelay(base, attempt+1)
+			if delay < want/2 || delay > want {
+				t.Fatalf("backoffDelay(%s, %d) = %s, want between %s and %s", base, attempt+1, delay, want/2, want)
+			}
+		}
+	}
+}
+
+func TestConnectWithRetry(t *testing.T) {
+	ctx := context.Background()
+	retry := config.Retry{MaxAttempts: 4, BaseDelay: 100 * time.Millisecond}
+	errDown := errors.New("connection refused")
+
+	var slept []time.Duration
+	sleep := func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+
+	// Succeeds on the third attempt after two growing waits
+	attempts := 0
+	err := connectWithRetry(ctx, retry, func(context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return errDown
+		}
+		return nil
+	}, sleep)
+	if err != nil || attempts != 3 {
+		t.Fatalf("Expected success on attempt 3, got %v after %d attempts", err, attempts)
+	}
+	if len(slept) != 2 || slept[0] < 50*time.Millisecond || slept[0] > 100*time.Millisecond ||
+		slept[1] < 100*time.Millisecond || slept[1] > 200*time.Millisecond {
+		t.Errorf("Unexpected backoff sequence %v", slept)
+	}
+
+	// Gives up after MaxAttempts, without waiting after the last one
+	slept, attempts = nil, 0
+	err = connectWithRetry(ctx, retry, func(context.Context) error {
+		attempts++
+		return errDown
+	}, sleep)
+	if !errors.Is(err, errDown) || attempts != 4 || len(slept) != 3 {
+		t.Errorf("Expected to give up after 4 attempts and 3 waits, got %v, %d attempts, waits %v", err, attempts, slept)
+	}
+
+	// Stops waiting once the context is cancelled
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	attempts = 0
+	err = connectWithRetry(cancelled, retry, func(context.Context) error {
+		attempts++
+		return errDown
+	}, sleepContext)
+	if !errors.Is(err, context.Canceled) || attempts != 1 {
+		t.Errorf("Expected to stop after 1 attempt on cancel, got %v after %d attempts", err, attempts)
+	}
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"accountingbot/logger"
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrationFiles holds the schema steps, named NNNN_description.sql
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the advisory lock key that keeps two instances from migrating at once
+const migrationLockID = 7_402_191
+
+// migration is one numbered schema step
+type migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// loadMigrations reads the migration files in fsys, ordered by version
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	names, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]migration, 0, len(names))
+	seen := make(map[int]string, len(names))
+	for _, path := range names {
+		name := strings.TrimSuffix(strings.TrimPrefix(path, "migrations/"), ".sql")
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %q must start with a positive version number", path)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %q and %q share version %d", other, name, version)
+		}
+		seen[version] = name
+
+		content, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{Version: version, Name: name, SQL: string(content)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Migrate applies the migrations not yet recorded in schema_migrations, in order, each in
+// its own transaction. It returns how many were applied.
+func Migrate(ctx context.Context) (int, error) {
+	ctx, span := logger.StartSpan(ctx, "db.Migrate")
+	defer span.End()
+
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		logger.Error(ctx, "Failed to load migrations", "error", err.Error())
+		return 0, err
+	}
+
+	if _, err := DB.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS schema_migrations (
+            version INTEGER PRIMARY KEY,
+            name TEXT NOT NULL,
+            applied_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+        )
+    `); err != nil {
+		logger.Error(ctx, "Failed to create schema_migrations", "error", err.Error())
+		return 0, err
+	}
+
+	applied := 0
+	for _, m := range migrations {
+		ran := false
+		err := WithTx(ctx, func(tx *sql.Tx) error {
+			// Held until commit; a concurrent instance waits here and then sees the version
+			if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+				return err
+			}
+
+			var done bool
+			if err := tx.QueryRowContext(ctx, `
+                SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)
+            `, m.Version).Scan(&done); err != nil {
+				return err
+			}
+			if done {
+				return nil
+			}
+
+			if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `
+                INSERT INTO schema_migrations (version, name) VALUES ($1, $2)
+            `, m.Version, m.Name); err != nil {
+				return err
+			}
+			ran = true
+			return nil
+		})
+		if err != nil {
+			logger.Error(ctx, "Failed to apply migration", "migration", m.Name, "error", err.Error())
+			return applied, fmt.Errorf("migration %s: %w", m.Name, err)
+		}
+
+		if ran {
+			applied++
+			logger.Info(ctx, "Migration applied", "migration", m.Name)
+		}
+	}
+
+	logger.Info(ctx, "Migrations up to date", "applied", applied, "total", len(migrations))
+	return applied, nil
+}
+
+// PendingMigrations returns how many migrations have not been applied yet. It fails when
+// schema_migrations does not exist, i.e. before the first Migrate.
+func PendingMigrations(ctx context.Context) (int, error) {
+	ctx, span := logger.StartSpan(ctx, "db.PendingMigrations")
+	defer span.End()
+
+	if !Ready() || DB == nil {
+		return 0, errors.New("database not initialized")
+	}
+
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return 0, err
+	}
+
+	var latest int
+	if err := DB.QueryRowContext(ctx, `
+        SELECT COALESCE(MAX(version), 0) FROM schema_migrations
+    `).Scan(&latest); err != nil {
+		return 0, err
+	}
+
+	pending := 0
+	for _, m := range migrations {
+		if m.Version > latest {
+			pending++
+		}
+	}
+	return pending, nil
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"accountingbot/logger"
+	"context"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+
+	shutdown := logger.Init()
+	testDBName := SetupTestDB(ctx)
+
+	code := m.Run()
+
+	CleanupTestDB(ctx, testDBName)
+	if shutdown != nil {
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		_ = shutdown(ctx)
+	}
+	os.Exit(code)
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+
+	// SetupTestDB has already migrated once, so both runs should be no-ops
+	for run := 1; run <= 2; run++ {
+		applied, err := Migrate(ctx)
+		if err != nil {
+			t.Fatalf("Migrate run %d failed: %v", run, err)
+		}
+		if applied != 0 {
+			t.Errorf("Migrate run %d applied %d migrations, want 0", run, applied)
+		}
+	}
+
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatalf("loadMigrations failed: %v", err)
+	}
+	var recorded int
+	if err := DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations`).Scan(&recorded); err != nil {
+		t.Fatalf("Failed to count schema_migrations: %v", err)
+	}
+	if recorded != len(migrations) {
+		t.Errorf("Expected %d recorded migrations, got %d", len(migrations), recorded)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_second.sql": {Data: []byte("SELECT 2;")},
+		"migrations/0001_first.sql":  {Data: []byte("SELECT 1;")},
+	}
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		t.Fatalf("loadMigrations failed: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Version != 1 || migrations[1].Version != 2 {
+		t.Fatalf("Expected migrations ordered 1, 2, got %+v", migrations)
+	}
+	if migrations[0].Name != "0001_first" {
+		t.Errorf("Expected name 0001_first, got %q", migrations[0].Name)
+	}
+
+	bad := fstest.MapFS{"migrations/initial.sql": {Data: []byte("SELECT 1;")}}
+	if _, err := loadMigrations(bad); err == nil {
+		t.Error("Expected an error for a migration without a version")
+	}
+
+	dup := fstest.MapFS{
+		"migrations/0001_a.sql": {Data: []byte("SELECT 1;")},
+		"migrations/0001_b.sql": {Data: []byte("SELECT 1;")},
+	}
+	if _, err := loadMigrations(dup); err == nil {
+		t.Error("Expected an error for duplicate versions")
+	}
+}
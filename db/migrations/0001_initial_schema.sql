@@ -0,0 +1,92 @@
+-- Schema as of the introduction of numbered migrations. Every statement is idempotent,
+-- so it also applies cleanly to databases created by the old inline createTables.
+
+CREATE TABLE IF NOT EXISTS categories (
+    id SERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    type TEXT NOT NULL,
+    UNIQUE(user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id SERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    amount INTEGER NOT NULL,
+    category_id INTEGER NOT NULL,
+    note TEXT,
+    attachment TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_category_id
+        FOREIGN KEY (category_id)
+        REFERENCES categories(id)
+        ON DELETE CASCADE
+);
+
+-- Columns added after the initial release
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS note TEXT;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS attachment TEXT;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS type_overridden BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Every summary, detail list and export filters on user_id and a created_at range;
+-- without this index each report scans the whole table. The same index also serves
+-- the latest-first lookups of 撤銷 and 附件.
+CREATE INDEX IF NOT EXISTS idx_transactions_user_created_at ON transactions (user_id, created_at);
+
+-- Lookups by (user_id, name) on categories, as in GetCategoryIdAndType and
+-- FindTransactionIDs, are already served by the index behind UNIQUE(user_id, name)
+
+-- created_at used to be a TIMESTAMP holding UTC wall-clock time
+DO $$
+BEGIN
+    IF (SELECT data_type FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'transactions' AND column_name = 'created_at')
+        = 'timestamp without time zone' THEN
+        ALTER TABLE transactions ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'UTC';
+    END IF;
+END $$;
+
+CREATE TABLE IF NOT EXISTS user_settings (
+    user_id TEXT PRIMARY KEY,
+    monthly_budget INTEGER
+);
+ALTER TABLE user_settings ADD COLUMN IF NOT EXISTS retention_months INTEGER;
+
+-- Transactions older than the user's retention window, kept out of the hot path
+CREATE TABLE IF NOT EXISTS archived_transactions (
+    id INTEGER PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    amount INTEGER NOT NULL,
+    category_id INTEGER NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+    note TEXT,
+    attachment TEXT,
+    type_overridden BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL,
+    archived_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_archived_transactions_user_created_at ON archived_transactions (user_id, created_at);
+
+CREATE TABLE IF NOT EXISTS budgets (
+    id SERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    category_id INTEGER NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+    amount INTEGER NOT NULL,
+    UNIQUE(user_id, category_id)
+);
+
+CREATE TABLE IF NOT EXISTS command_usage (
+    id SERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    command TEXT NOT NULL,
+    used_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_command_usage_user_used_at ON command_usage (user_id, used_at);
+
+CREATE TABLE IF NOT EXISTS user_macros (
+    user_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    expansion TEXT NOT NULL,
+    PRIMARY KEY (user_id, name)
+);
@@ -0,0 +1,2 @@
+-- Deleted transactions are kept with a deletion time so 還原 can bring them back
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
@@ -0,0 +1,6 @@
+-- Amounts are stored in cents so decimal amounts like 45.50 can be recorded. Existing
+-- whole-unit amounts are scaled up, and the columns widen to BIGINT to keep the same range.
+ALTER TABLE transactions ALTER COLUMN amount TYPE BIGINT USING amount::bigint * 100;
+ALTER TABLE archived_transactions ALTER COLUMN amount TYPE BIGINT USING amount::bigint * 100;
+ALTER TABLE budgets ALTER COLUMN amount TYPE BIGINT USING amount::bigint * 100;
+ALTER TABLE user_settings ALTER COLUMN monthly_budget TYPE BIGINT USING monthly_budget::bigint * 100;
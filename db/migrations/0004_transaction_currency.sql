@@ -0,0 +1,3 @@
+-- Transactions can be recorded in a foreign currency; existing rows are in TWD
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'TWD';
+ALTER TABLE archived_transactions ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'TWD';
@@ -0,0 +1,15 @@
+-- Fixed monthly items, such as rent or subscriptions, posted as transactions on their day.
+-- next_due is the date of the next posting; it moves forward in the same database
+-- transaction as each posting, so a restart never posts a month twice.
+CREATE TABLE IF NOT EXISTS recurring_transactions (
+    id SERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    category_id INTEGER NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+    amount BIGINT NOT NULL,
+    day_of_month INTEGER NOT NULL CHECK (day_of_month BETWEEN 1 AND 31),
+    note TEXT,
+    next_due DATE NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_recurring_transactions_next_due ON recurring_transactions (next_due);
+CREATE INDEX IF NOT EXISTS idx_recurring_transactions_user ON recurring_transactions (user_id);
@@ -0,0 +1,29 @@
+-- transactions.type copies categories.type so a single record can be overridden, e.g. a
+-- refund recorded as 收入 in an expense category. Any change to a category's type, through
+-- the bot or by hand, now carries over to its records that were not overridden, so the
+-- copy can no longer drift.
+CREATE OR REPLACE FUNCTION sync_transaction_types() RETURNS trigger AS $$
+BEGIN
+    UPDATE transactions SET type = NEW.type
+    WHERE category_id = NEW.id AND type <> NEW.type AND NOT type_overridden;
+    UPDATE archived_transactions SET type = NEW.type
+    WHERE category_id = NEW.id AND type <> NEW.type AND NOT type_overridden;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS categories_sync_transaction_types ON categories;
+CREATE TRIGGER categories_sync_transaction_types
+    AFTER UPDATE OF type ON categories
+    FOR EACH ROW
+    WHEN (OLD.type IS DISTINCT FROM NEW.type)
+    EXECUTE FUNCTION sync_transaction_types();
+
+-- Realign the records that drifted before the trigger existed
+UPDATE transactions t SET type = c.type
+FROM categories c
+WHERE t.category_id = c.id AND t.type <> c.type AND NOT t.type_overridden;
+
+UPDATE archived_transactions t SET type = c.type
+FROM categories c
+WHERE t.category_id = c.id AND t.type <> c.type AND NOT t.type_overridden;
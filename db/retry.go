@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"accountingbot/config"
+	"accountingbot/logger"
+)
+
+// maxRetryDelay caps the wait between connection attempts
+const maxRetryDelay = 30 * time.Second
+
+// sleeper waits for d, returning early with ctx's error when ctx is done
+type sleeper func(ctx context.Context, d time.Duration) error
+
+// sleepContext is the real sleeper
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// backoffDelay returns the wait after the given failed attempt, counted from 1: the base
+// delay doubled per attempt up to maxRetryDelay, of which a random half is taken off so
+// instances restarted together spread their retries out
+func backoffDelay(base time.Duration, attempt int) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxRetryDelay)
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// connectWithRetry calls ping until it succeeds or retry.MaxAttempts attempts have failed,
+// waiting with backoff in between. It gives up early when ctx is done.
+func connectWithRetry(ctx context.Context, retry config.Retry, ping func(context.Context) error, sleep sleeper) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = ping(ctx); err == nil {
+			return nil
+		}
+		if attempt >= retry.MaxAttempts {
+			return err
+		}
+
+		delay := backoffDelay(retry.BaseDelay, attempt)
+		logger.Warn(ctx, "Database connection test failed, retrying later",
+			"attempt", attempt,
+			"max_attempts", retry.MaxAttempts,
+			"delay", delay.String(),
+			"error", err.Error(),
+		)
+
+		if sleepErr := sleep(ctx, delay); sleepErr != nil {
+			return sleepErr
+		}
+	}
+}
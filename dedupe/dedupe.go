@@ -0,0 +1,87 @@
+package dedupe
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache remembers IDs for a fixed window so a redelivered event is handled once. It lives
+// in memory, so it only catches redeliveries to the same instance. It is safe for
+// concurrent use. A nil *Cache treats every ID as new.
+type Cache struct {
+	mu     sync.Mutex
+	seen   map[string]time.Time
+	window time.Duration
+	now    func() time.Time
+}
+
+// New returns a cache remembering IDs for window. It returns nil, which remembers nothing,
+// when window is not positive.
+func New(window time.Duration) *Cache {
+	if window <= 0 {
+		return nil
+	}
+	return &Cache{
+		seen:   make(map[string]time.Time),
+		window: window,
+		now:    time.Now,
+	}
+}
+
+// FirstSeen records id and reports whether it was not already seen within the window.
+// An empty id is always new, since there is nothing to tell deliveries apart by.
+func (c *Cache) FirstSeen(id string) bool {
+	if c == nil || id == "" {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if at, ok := c.seen[id]; ok && now.Sub(at) < c.window {
+		return false
+	}
+	c.seen[id] = now
+	return true
+}
+
+// Cleanup forgets the IDs older than the window and returns how many were removed
+func (c *Cache) Cleanup() int {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	removed := 0
+	for id, at := range c.seen {
+		if now.Sub(at) >= c.window {
+			delete(c.seen, id)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Run calls Cleanup every interval until ctx is done
+func (c *Cache) Run(ctx context.Context, interval time.Duration) {
+	if c == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Cleanup()
+		}
+	}
+}
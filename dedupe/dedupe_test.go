@@ -0,0 +1,70 @@
+package dedupe
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock for the cache
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTestCache(window time.Duration) (*Cache, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)}
+	c := New(window)
+	c.now = clock.now
+	return c, clock
+}
+
+func TestFirstSeenRejectsRepeatsWithinWindow(t *testing.T) {
+	c, clock := newTestCache(10 * time.Minute)
+
+	if !c.FirstSeen("01H0EVENT") {
+		t.Fatal("Expected the first delivery to be new")
+	}
+	if c.FirstSeen("01H0EVENT") {
+		t.Error("Expected the redelivery to be a duplicate")
+	}
+	if !c.FirstSeen("01H0OTHER") {
+		t.Error("Expected a different ID to be new")
+	}
+
+	clock.t = clock.t.Add(10 * time.Minute)
+	if !c.FirstSeen("01H0EVENT") {
+		t.Error("Expected the ID to be new again after the window")
+	}
+}
+
+func TestFirstSeenEmptyIDAndNilCache(t *testing.T) {
+	c, _ := newTestCache(time.Minute)
+	if !c.FirstSeen("") || !c.FirstSeen("") {
+		t.Error("Expected an empty ID to always be new")
+	}
+
+	var disabled *Cache
+	if !disabled.FirstSeen("01H0EVENT") || !disabled.FirstSeen("01H0EVENT") {
+		t.Error("Expected a nil cache to treat every ID as new")
+	}
+	if New(0) != nil {
+		t.Error("Expected a zero window to disable the cache")
+	}
+}
+
+func TestCleanupForgetsExpiredIDs(t *testing.T) {
+	c, clock := newTestCache(time.Minute)
+
+	c.FirstSeen("old")
+	clock.t = clock.t.Add(30 * time.Second)
+	c.FirstSeen("new")
+	clock.t = clock.t.Add(45 * time.Second)
+
+	if removed := c.Cleanup(); removed != 1 {
+		t.Errorf("Expected 1 expired ID to be removed, got %d", removed)
+	}
+	if c.FirstSeen("new") {
+		t.Error("Expected the unexpired ID to be kept")
+	}
+}
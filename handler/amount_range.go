@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"accountingbot/config"
+	"accountingbot/logger"
+	"accountingbot/model"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// amountRangeFormatReply shows the forms of 金額
+const amountRangeFormatReply = "⚠️ 格式錯誤，請使用：金額 最小值 [最大值] [類別名稱]，例如：金額 100 500 餐費"
+
+// handleAmountRange handles the command to list transactions within an amount range, e.g.
+// "金額 100 500 餐費", or at or above an amount with "金額 100"
+func handleAmountRange(ctx context.Context, userID string, tokens []string) string {
+	ctx, span := logger.StartSpan(ctx, "handleAmountRange")
+	defer span.End()
+
+	args := tokens[1:]
+	minAmount, err := model.ParseAmount(args[0])
+	if err != nil || minAmount <= 0 {
+		logger.Warn(ctx, "Invalid amount range minimum", "min", args[0])
+		return amountRangeFormatReply
+	}
+
+	maxAmount := 0
+	if len(args) > 1 && isNumber(args[1]) {
+		if maxAmount, err = model.ParseAmount(args[1]); err != nil || maxAmount <= 0 {
+			logger.Warn(ctx, "Invalid amount range maximum", "max", args[1])
+			return amountRangeFormatReply
+		}
+		args = args[1:]
+	}
+
+	category := ""
+	switch len(args) {
+	case 1:
+	case 2:
+		category = args[1]
+	default:
+		logger.Warn(ctx, "Amount range format error", "tokens", tokens)
+		return amountRangeFormatReply
+	}
+
+	if maxAmount > 0 && minAmount > maxAmount {
+		logger.Warn(ctx, "Amount range minimum above maximum", "min", minAmount, "max", maxAmount)
+		return "⚠️ 最小值不能大於最大值，例如：金額 100 500"
+	}
+
+	logger.Info(ctx, "Amount range", "user_id", userID, "min", minAmount, "max", maxAmount, "category", category)
+
+	details, err := model.FindTransactionsByAmountRange(ctx, userID, minAmount, maxAmount, category)
+	if err != nil {
+		logger.Error(ctx, "Failed to find transactions by amount range", "error", err.Error())
+		return "❌ 查詢失敗，請稍後再試。"
+	}
+
+	label := fmt.Sprintf("$%s 以上", model.FormatAmount(minAmount))
+	if maxAmount > 0 {
+		label = fmt.Sprintf("$%s 至 $%s", model.FormatAmount(minAmount), model.FormatAmount(maxAmount))
+	}
+	if category != "" {
+		label = category + " " + label
+	}
+
+	if len(details) == 0 {
+		return fmt.Sprintf("🔍 沒有 %s 的紀錄。", label)
+	}
+
+	result := fmt.Sprintf("🔍 %s 的紀錄（%d 筆）：\n", label, len(details))
+	for i, d := range details {
+		if i == searchResultLimit {
+			result += fmt.Sprintf("只顯示金額最大的 %d 筆。", searchResultLimit)
+			break
+		}
+		createdAt := d.CreatedAt.In(config.Location())
+		result += fmt.Sprintf("・%s %s %s（編號 %d）\n",
+			createdAt.Format("2006/01/02"), d.Category, formatMoney(d.Amount, d.Currency), d.ID)
+	}
+	return strings.TrimSuffix(result, "\n")
+}
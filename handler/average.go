@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"accountingbot/logger"
+	"accountingbot/model"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// handleSpendingAverages handles the command to show the average spent per active day and
+// per month over the whole history: "平均" for all expenses, "平均 餐費" for one category
+func handleSpendingAverages(ctx context.Context, userID, category string) string {
+	ctx, span := logger.StartSpan(ctx, "handleSpendingAverages")
+	defer span.End()
+
+	logger.Info(ctx, "Spending averages", "user_id", userID, "category", category)
+
+	averages, err := model.GetSpendingAverages(ctx, userID, category)
+	if errors.Is(err, model.ErrCategoryNotFound) {
+		return "❌ 類別不存在。"
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to get spending averages", "error", err.Error())
+		return "❌ 查詢失敗，請稍後再試。"
+	}
+
+	subject := "支出"
+	if category != "" {
+		subject = category
+	}
+	if averages.Count == 0 {
+		return fmt.Sprintf("📈 %s目前沒有紀錄。", subject)
+	}
+
+	first := averages.First
+	return fmt.Sprintf("📈 %s平均（%d/%d/%d 起，共 %d 筆 $%s）\n・每個記帳日：$%s（%d 天）\n・每月：$%s（%d 個月）",
+		subject, first.Year(), first.Month(), first.Day(), averages.Count, model.FormatAmount(averages.Total),
+		model.FormatAmount(averages.PerActiveDay()), averages.ActiveDays,
+		model.FormatAmount(averages.PerMonth()), averages.Months)
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"accountingbot/logger"
+	"accountingbot/model"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// splitLines splits a message into its non-empty lines
+func splitLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// recordBatchLine records a single "類別 金額 [幣別] [備註]" line and returns the amount and
+// its currency, or a reason the line could not be recorded
+func recordBatchLine(ctx context.Context, userID, line string, createdAt time.Time) (int, string, string) {
+	tokens := expandMacros(ctx, userID, strings.Fields(line))
+	if len(tokens) < 2 || !isNumber(tokens[1]) || isNumber(tokens[0]) {
+		return 0, "", "格式錯誤，請使用『類別 金額』"
+	}
+
+	amount, err := model.ParseAmount(tokens[1])
+	if err != nil {
+		return 0, "", amountErrorReply(err)
+	}
+	if amount <= 0 {
+		return 0, "", "金額必須大於 0"
+	}
+
+	categoryID, categoryType, err := model.GetCategoryIdAndType(ctx, userID, tokens[0])
+	if err != nil {
+		return 0, "", fmt.Sprintf("類別 %s 不存在", tokens[0])
+	}
+
+	currency, note := splitCurrency(strings.Join(tokens[2:], " "))
+	if _, err := model.AddTransactionInCurrency(ctx, userID, categoryID, categoryType, amount, currency, note, createdAt); err != nil {
+		logger.Error(ctx, "Failed to record batch line", "line", line, "error", err.Error())
+		return 0, "", "記錄失敗"
+	}
+	logger.RecordTransaction(ctx, categoryType)
+
+	return amount, currency, ""
+}
+
+// handleBatchTransactions handles a multi-line message, recording each line as a separate
+// transaction. A failing line is reported without stopping the rest of the batch.
+func handleBatchTransactions(ctx context.Context, userID string, lines []string) string {
+	ctx, span := logger.StartSpan(ctx, "handleBatchTransactions")
+	defer span.End()
+
+	logger.Info(ctx, "Batch transactions", "lines", len(lines))
+
+	now := localNow()
+	recorded := 0
+	// Totals are kept per currency so different currencies are never added up
+	totals := make(map[string]int)
+	var failures []string
+
+	for i, line := range lines {
+		amount, currency, reason := recordBatchLine(ctx, userID, line, now)
+		if reason != "" {
+			logger.Warn(ctx, "Batch line failed", "line_number", i+1, "line", line, "reason", reason)
+			failures = append(failures, fmt.Sprintf("・第 %d 行「%s」：%s", i+1, strings.TrimSpace(line), reason))
+			continue
+		}
+		recorded++
+		totals[currency] += amount
+	}
+
+	logger.Info(ctx, "Batch transactions completed",
+		"recorded", recorded,
+		"failed", len(failures),
+		"totals", totals)
+
+	response := fmt.Sprintf("✅ 已記錄 %d 筆，共 %s", recorded, renderCurrencyAmounts(totals))
+	if recorded == 0 {
+		response = "❌ 沒有任何一筆記錄成功"
+	}
+	if len(failures) > 0 {
+		response += fmt.Sprintf("\n⚠️ %d 筆失敗：\n%s", len(failures), strings.Join(failures, "\n"))
+	}
+	return response
+}
@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"accountingbot/logger"
+	"accountingbot/model"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// checkCategoryBudget returns a warning when the category's spending this month exceeds its budget
+func checkCategoryBudget(ctx context.Context, userID string, categoryID int, categoryName string, createdAt time.Time) string {
+	ctx, span := logger.StartSpan(ctx, "checkCategoryBudget")
+	defer span.End()
+
+	budget, err := model.GetBudget(ctx, userID, categoryID)
+	if err != nil || budget <= 0 {
+		return ""
+	}
+
+	summary, err := model.GetMonthlySummary(ctx, userID, createdAt)
+	if err != nil {
+		logger.Warn(ctx, "Failed to get monthly summary for budget check", "error", err.Error())
+		return ""
+	}
+
+	spent := summary.ExpenseCategoryTotals[categoryName]
+	if spent <= budget {
+		return ""
+	}
+
+	logger.Info(ctx, "Category budget exceeded",
+		"category", categoryName,
+		"budget", budget,
+		"spent", spent)
+	return fmt.Sprintf("\n⚠️ 已超出%s預算 $%s", categoryName, model.FormatAmount(spent-budget))
+}
+
+// handleSetBudget handles the command to set a category's monthly budget
+func handleSetBudget(ctx context.Context, userID, categoryName, amountStr string) string {
+	ctx, span := logger.StartSpan(ctx, "handleSetBudget")
+	defer span.End()
+
+	logger.Info(ctx, "Set budget", "category", categoryName, "amount", amountStr)
+
+	amount, err := model.ParseAmount(amountStr)
+	if err != nil || amount <= 0 {
+		logger.Warn(ctx, "Budget format error", "amount", amountStr)
+		return "預算金額格式錯誤，請輸入大於 0 的數字。"
+	}
+
+	categoryID, categoryType, err := model.GetCategoryIdAndType(ctx, userID, categoryName)
+	if err != nil {
+		logger.Warn(ctx, "Category does not exist", "category", categoryName)
+		return "❌ 類別不存在，請先新增。"
+	}
+
+	if categoryType != "支出" {
+		logger.Warn(ctx, "Budget on non-expense category", "category", categoryName, "type", categoryType)
+		return "❌ 只能為支出類別設定預算。"
+	}
+
+	if err := model.SetBudget(ctx, userID, categoryID, amount); err != nil {
+		logger.Error(ctx, "Failed to set budget", "error", err.Error())
+		return "❌ 設定預算失敗，請稍後再試。"
+	}
+
+	logger.Info(ctx, "Budget set successfully", "category", categoryName, "amount", amount)
+	return fmt.Sprintf("✅ %s 每月預算已設定為 $%s", categoryName, model.FormatAmount(amount))
+}
+
+// handleListBudgets handles the command to list budgets with this month's usage
+func handleListBudgets(ctx context.Context, userID string) string {
+	ctx, span := logger.StartSpan(ctx, "handleListBudgets")
+	defer span.End()
+
+	logger.Info(ctx, "List budgets")
+
+	usages, err := model.GetBudgetUsages(ctx, userID, localNow())
+	if err != nil {
+		logger.Error(ctx, "Failed to get budget usages", "error", err.Error())
+		return "❌ 預算查詢失敗，請稍後再試。"
+	}
+
+	if len(usages) == 0 {
+		return "⚠️ 你尚未設定任何預算。"
+	}
+
+	response := "💰 本月預算使用狀況：\n"
+	for _, u := range usages {
+		response += fmt.Sprintf("・%s：$%s / $%s（%d%%）\n", u.Category, model.FormatAmount(u.Spent), model.FormatAmount(u.Amount), budgetUtilization(u))
+	}
+
+	logger.Info(ctx, "Got budget list", "count", len(usages))
+	return strings.TrimSuffix(response, "\n")
+}
+
+// projectMonthEnd projects the month-end total from the spending so far.
+// The current day counts as elapsed, so the first day of the month divides by one.
+func projectMonthEnd(spent int, now time.Time) int {
+	daysElapsed := now.Day()
+	daysInMonth := time.Date(now.Year(), now.Month()+1, 0, 0, 0, 0, 0, now.Location()).Day()
+	return spent * daysInMonth / daysElapsed
+}
+
+// handleForecast handles the command to project this month's spending per category
+func handleForecast(ctx context.Context, userID string) string {
+	ctx, span := logger.StartSpan(ctx, "handleForecast")
+	defer span.End()
+
+	now := localNow()
+	logger.Info(ctx, "Spending forecast", "day", now.Day())
+
+	summary, err := model.GetMonthlySummary(ctx, userID, now)
+	if err != nil {
+		logger.Error(ctx, "Failed to get monthly summary", "error", err.Error())
+		return "❌ 預測失敗，請稍後再試。"
+	}
+
+	usages, err := model.GetBudgetUsages(ctx, userID, now)
+	if err != nil {
+		logger.Error(ctx, "Failed to get budget usages", "error", err.Error())
+		return "❌ 預測失敗，請稍後再試。"
+	}
+	budgets := make(map[string]int, len(usages))
+	for _, u := range usages {
+		budgets[u.Category] = u.Amount
+	}
+
+	projected := make(map[string]int)
+	spent := make(map[string]int)
+	for name, amount := range summary.ExpenseCategoryTotals {
+		spent[name] = amount
+		projected[name] = projectMonthEnd(amount, now)
+	}
+
+	if len(projected) == 0 {
+		return "⚠️ 本月尚無支出紀錄，無法預測。"
+	}
+
+	daysInMonth := time.Date(now.Year(), now.Month()+1, 0, 0, 0, 0, 0, now.Location()).Day()
+	response := fmt.Sprintf("🔮 %d年%d月 支出預測（第 %d / %d 天）：\n", now.Year(), now.Month(), now.Day(), daysInMonth)
+	for _, ct := range sortCategoryTotals(projected) {
+		response += fmt.Sprintf("・%s：$%s → 預計 $%s", ct.Name, model.FormatAmount(spent[ct.Name]), model.FormatAmount(ct.Amount))
+		if budget, ok := budgets[ct.Name]; ok {
+			response += fmt.Sprintf("（預算 $%s", model.FormatAmount(budget))
+			if ct.Amount > budget {
+				response += " ⚠️ 預計超支"
+			}
+			response += "）"
+		}
+		response += "\n"
+	}
+
+	logger.Info(ctx, "Forecast completed", "categories", len(projected))
+	return strings.TrimSuffix(response, "\n")
+}
+
+// budgetUtilization returns how much of the budget has been spent, in percent
+func budgetUtilization(u model.BudgetUsage) int {
+	if u.Amount <= 0 {
+		return 0
+	}
+	return u.Spent * 100 / u.Amount
+}
+
+// budgetRiskIndicator returns 🟢 below 70%, 🟡 from 70% up to 100%, and 🔴 at or over budget
+func budgetRiskIndicator(percent int) string {
+	switch {
+	case percent >= 100:
+		return "🔴"
+	case percent >= 70:
+		return "🟡"
+	default:
+		return "🟢"
+	}
+}
+
+// sortBudgetsByRisk sorts budgets by utilization descending, then by category name
+func sortBudgetsByRisk(usages []model.BudgetUsage) {
+	sort.SliceStable(usages, func(i, j int) bool {
+		pi, pj := budgetUtilization(usages[i]), budgetUtilization(usages[j])
+		if pi != pj {
+			return pi > pj
+		}
+		return usages[i].Category < usages[j].Category
+	})
+}
+
+// handleBudgetRisk handles the command to list budgets with the most at-risk first
+func handleBudgetRisk(ctx context.Context, userID string) string {
+	ctx, span := logger.StartSpan(ctx, "handleBudgetRisk")
+	defer span.End()
+
+	logger.Info(ctx, "Budget risk")
+
+	usages, err := model.GetBudgetUsages(ctx, userID, localNow())
+	if err != nil {
+		logger.Error(ctx, "Failed to get budget usages", "error", err.Error())
+		return "❌ 預算查詢失敗，請稍後再試。"
+	}
+
+	if len(usages) == 0 {
+		return "⚠️ 你尚未設定任何預算。"
+	}
+
+	sortBudgetsByRisk(usages)
+
+	response := "🚦 本月預算風險：\n"
+	for _, u := range usages {
+		percent := budgetUtilization(u)
+		response += fmt.Sprintf("%s %s：%d%%（$%s / $%s）\n", budgetRiskIndicator(percent), u.Category, percent, model.FormatAmount(u.Spent), model.FormatAmount(u.Amount))
+	}
+
+	logger.Info(ctx, "Got budget risk list", "count", len(usages))
+	return strings.TrimSuffix(response, "\n")
+}
+
+// handleListUnbudgeted handles the command to list expense categories without a budget
+func handleListUnbudgeted(ctx context.Context, userID string) string {
+	ctx, span := logger.StartSpan(ctx, "handleListUnbudgeted")
+	defer span.End()
+
+	logger.Info(ctx, "List unbudgeted categories")
+
+	names, err := model.GetUnbudgetedCategories(ctx, userID)
+	if err != nil {
+		logger.Error(ctx, "Failed to get unbudgeted categories", "error", err.Error())
+		return "❌ 預算查詢失敗，請稍後再試。"
+	}
+
+	if len(names) == 0 {
+		return "✅ 所有支出類別都已設定預算。"
+	}
+
+	logger.Info(ctx, "Got unbudgeted categories", "count", len(names))
+	return "📋 尚未設定預算的支出類別：\n・" + strings.Join(names, "\n・")
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// maxCategoryNameLength caps category names, in runes, so they fit a quick reply label
+const maxCategoryNameLength = maxQuickReplyLabel
+
+var (
+	errEmptyCategoryName     = errors.New("category name is empty")
+	errCategoryNameSpace     = errors.New("category name contains whitespace")
+	errCategoryNameTooLong   = errors.New("category name is too long")
+	errCategoryNameInvisible = errors.New("category name contains invisible characters")
+	errReservedCategoryName  = errors.New("category name is a command keyword")
+)
+
+// reservedKeywords are every keyword in the commands registry and every help alias, sorted.
+// It is filled in init because commands refers to the handlers that check it.
+var reservedKeywords []string
+
+func init() {
+	for _, c := range commands {
+		reservedKeywords = append(reservedKeywords, c.keyword)
+	}
+	for k := range helpAliases {
+		reservedKeywords = append(reservedKeywords, k)
+	}
+	slices.Sort(reservedKeywords)
+	reservedKeywords = slices.Compact(reservedKeywords)
+}
+
+// reservedCategoryNames returns the command keywords a category may not be named after,
+// sorted. "結算 100" would run the command instead of recording a transaction.
+func reservedCategoryNames() []string {
+	return reservedKeywords
+}
+
+// normalizeCategoryName trims the surrounding spaces off name and checks that it can be
+// typed back as a single command token
+func normalizeCategoryName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errEmptyCategoryName
+	}
+	if strings.IndexFunc(name, unicode.IsSpace) >= 0 {
+		return "", errCategoryNameSpace
+	}
+	if len([]rune(name)) > maxCategoryNameLength {
+		return "", errCategoryNameTooLong
+	}
+	// Zero-width and other format characters make names that look identical but differ
+	if strings.IndexFunc(name, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0 {
+		return "", errCategoryNameInvisible
+	}
+	if slices.Contains(reservedCategoryNames(), strings.ToLower(name)) {
+		return "", errReservedCategoryName
+	}
+	return name, nil
+}
+
+// categoryNameReply explains why normalizeCategoryName rejected a name
+func categoryNameReply(err error) string {
+	switch {
+	case errors.Is(err, errEmptyCategoryName):
+		return "❌ 請輸入類別名稱，例如：新增類別 支出 早餐"
+	case errors.Is(err, errCategoryNameSpace):
+		return "❌ 類別名稱不能包含空白，例如「外食」而不是「外 食」。"
+	case errors.Is(err, errCategoryNameTooLong):
+		return fmt.Sprintf("❌ 類別名稱最多 %d 個字。", maxCategoryNameLength)
+	case errors.Is(err, errReservedCategoryName):
+		return "❌ 類別名稱不能與指令相同，以下名稱無法使用：\n" + strings.Join(reservedCategoryNames(), "、")
+	default:
+		return "❌ 類別名稱不能包含看不見的字元。"
+	}
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"accountingbot/logger"
+	"accountingbot/model"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// handleChangeCategoryType handles the command to switch a category between 收入 and 支出,
+// e.g. "變更類型 獎金 收入". Its recorded transactions switch along with it.
+func handleChangeCategoryType(ctx context.Context, userID, name, newType string) string {
+	ctx, span := logger.StartSpan(ctx, "handleChangeCategoryType")
+	defer span.End()
+
+	logger.Info(ctx, "Change category type", "name", name, "type", newType)
+
+	retyped, err := model.ChangeCategoryType(ctx, userID, name, newType)
+	switch {
+	case errors.Is(err, model.ErrInvalidCategoryType):
+		return "❌ 類別類型只能是 收入 或 支出"
+	case errors.Is(err, model.ErrCategoryNotFound):
+		return "❌ 類別不存在。"
+	case errors.Is(err, model.ErrCategoryTypeUnchanged):
+		return fmt.Sprintf("⚠️ 類別 %s 已經是%s類別。", name, newType)
+	case err != nil:
+		logger.Error(ctx, "Failed to change category type", "error", err.Error())
+		return "❌ 變更類型失敗，請稍後再試。"
+	}
+
+	return fmt.Sprintf("🔄 類別 %s 已變更為%s，%d 筆紀錄已一併更新。", name, newType, retyped)
+}
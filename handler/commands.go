@@ -0,0 +1,221 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// command is a keyword command with the number of tokens it accepts, keyword included
+type command struct {
+	keyword   string
+	minTokens int
+	maxTokens int // 0 means no upper limit
+
+	// match optionally checks the arguments, e.g. the 編號 in "刪除 編號 42"
+	match func(tokens []string) bool
+	run   func(ctx context.Context, userID string, tokens []string) Reply
+}
+
+// accepts reports whether tokens have the shape the command expects
+func (c command) accepts(tokens []string) bool {
+	if len(tokens) < c.minTokens || c.maxTokens > 0 && len(tokens) > c.maxTokens {
+		return false
+	}
+	return c.match == nil || c.match(tokens)
+}
+
+// byID matches "<keyword> 編號 N ..." forms
+func byID(tokens []string) bool {
+	return tokens[1] == "編號"
+}
+
+// text adapts a handler returning plain text to a command
+func text(run func(ctx context.Context, userID string, tokens []string) string) func(context.Context, string, []string) Reply {
+	return func(ctx context.Context, userID string, tokens []string) Reply {
+		return Reply{Text: run(ctx, userID, tokens)}
+	}
+}
+
+// commands lists every keyword command. Forms of the same keyword are tried in order,
+// so the more specific ones come first.
+var commands = []command{
+	// The rest of the line is the name, so a name with spaces is rejected instead of cut short
+	{keyword: "新增類別", minTokens: 2, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleAddCategory(ctx, userID, tokens[1], strings.Join(tokens[2:], " "))
+	})},
+	{keyword: "修改類別", minTokens: 3, maxTokens: 3, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleUpdateCategory(ctx, userID, tokens[1], tokens[2])
+	})},
+	{keyword: "刪除類別", minTokens: 2, maxTokens: 2, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleDeleteCategory(ctx, userID, tokens[1], false)
+	})},
+	{keyword: "刪除類別", minTokens: 3, maxTokens: 3, match: func(tokens []string) bool { return tokens[2] == "確認" }, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleDeleteCategory(ctx, userID, tokens[1], true)
+	})},
+	{keyword: "變更類型", minTokens: 3, maxTokens: 3, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleChangeCategoryType(ctx, userID, tokens[1], tokens[2])
+	})},
+	{keyword: "合併類別", minTokens: 3, maxTokens: 3, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleMergeCategories(ctx, userID, tokens[1], tokens[2])
+	})},
+	{keyword: "初始化", minTokens: 1, maxTokens: 1, run: text(func(ctx context.Context, userID string, _ []string) string {
+		return handleSeedCategories(ctx, userID)
+	})},
+	{keyword: "已設定類別", minTokens: 1, run: text(func(ctx context.Context, userID string, _ []string) string {
+		return handleListCategories(ctx, userID)
+	})},
+
+	{keyword: "收入", minTokens: 3, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleQuickTransaction(ctx, userID, tokens[1], tokens[2], tokens[0], strings.Join(tokens[3:], " "), localNow())
+	})},
+	{keyword: "支出", minTokens: 3, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleQuickTransaction(ctx, userID, tokens[1], tokens[2], tokens[0], strings.Join(tokens[3:], " "), localNow())
+	})},
+	{keyword: "記帳", minTokens: 4, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleBackdatedTransaction(ctx, userID, tokens[1], tokens[2], tokens[3], strings.Join(tokens[4:], " "))
+	})},
+	{keyword: "訂閱", minTokens: 1, maxTokens: 1, run: text(func(ctx context.Context, userID string, _ []string) string {
+		return handleListRecurring(ctx, userID)
+	})},
+	{keyword: "訂閱", minTokens: 4, run: text(handleAddRecurring)},
+	{keyword: "取消訂閱", minTokens: 3, maxTokens: 3, match: byID, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleCancelRecurring(ctx, userID, tokens[2])
+	})},
+	{keyword: "撤銷", minTokens: 1, maxTokens: 1, run: text(func(ctx context.Context, userID string, _ []string) string {
+		return handleUndo(ctx, userID)
+	})},
+	{keyword: "還原", minTokens: 1, maxTokens: 1, run: text(handleRestore)},
+	{keyword: "還原", minTokens: 3, maxTokens: 3, match: byID, run: text(handleRestore)},
+	{keyword: "修改類型", minTokens: 4, maxTokens: 4, match: byID, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleOverrideTransactionType(ctx, userID, tokens[2], tokens[3])
+	})},
+	{keyword: "修改", minTokens: 4, maxTokens: 4, match: byID, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleUpdateTransactionByID(ctx, userID, tokens[2], tokens[3])
+	})},
+	{keyword: "修改", minTokens: 4, maxTokens: 4, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleUpdateTransaction(ctx, userID, tokens[1], tokens[2], tokens[3])
+	})},
+	{keyword: "刪除", minTokens: 3, maxTokens: 3, match: byID, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleDeleteTransactionByID(ctx, userID, tokens[2])
+	})},
+	{keyword: "刪除", minTokens: 3, maxTokens: 3, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleDeleteTransaction(ctx, userID, tokens[1], tokens[2])
+	})},
+	{keyword: "複製", minTokens: 3, maxTokens: 3, match: byID, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleCopyTransaction(ctx, userID, tokens[2])
+	})},
+	{keyword: "附件", minTokens: 3, maxTokens: 3, match: byID, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleShowAttachment(ctx, userID, tokens[2])
+	})},
+
+	{keyword: "結算", minTokens: 3, maxTokens: 3, match: func(tokens []string) bool { return tokens[1] == "上半年" || tokens[1] == "下半年" }, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleHalfYearSummary(ctx, userID, tokens[1], tokens[2])
+	})},
+	{keyword: "結算", minTokens: 3, maxTokens: 3, match: func(tokens []string) bool { return strings.Contains(tokens[1], "-") }, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleRangeSummary(ctx, userID, tokens[1], tokens[2])
+	})},
+	{keyword: "結算", minTokens: 1, run: handleMonthlySummary},
+	{keyword: "年結", minTokens: 1, maxTokens: 2, run: text(handleAnnualSummary)},
+	{keyword: "日結", minTokens: 1, maxTokens: 2, run: text(handleDailySummary)},
+	{keyword: "週結", minTokens: 1, maxTokens: 2, run: text(handleWeeklySummary)},
+	{keyword: "狀態", minTokens: 1, run: text(func(ctx context.Context, userID string, _ []string) string {
+		return handleStatus(ctx, userID)
+	})},
+	{keyword: "連續無消費", minTokens: 1, run: text(handleNoSpendStreak)},
+	{keyword: "查詢", minTokens: 2, maxTokens: 2, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleCategoryQuery(ctx, userID, tokens[1])
+	})},
+	{keyword: "搜尋", minTokens: 2, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleSearch(ctx, userID, strings.Join(tokens[1:], " "))
+	})},
+	{keyword: "金額", minTokens: 2, maxTokens: 4, run: text(handleAmountRange)},
+	{keyword: "大額", minTokens: 2, maxTokens: 2, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleLargeTransactions(ctx, userID, tokens[1])
+	})},
+	{keyword: "缺備註", minTokens: 1, run: text(func(ctx context.Context, userID string, _ []string) string {
+		return handleMissingNotes(ctx, userID)
+	})},
+	{keyword: "平均", minTokens: 1, maxTokens: 2, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		category := ""
+		if len(tokens) == 2 {
+			category = tokens[1]
+		}
+		return handleSpendingAverages(ctx, userID, category)
+	})},
+	{keyword: "排行", minTokens: 1, maxTokens: 2, run: text(handleSpendingRanking)},
+	{keyword: "比較", minTokens: 1, maxTokens: 1, run: text(func(ctx context.Context, userID string, _ []string) string {
+		return handleMonthComparison(ctx, userID)
+	})},
+	{keyword: "匯出", minTokens: 1, run: text(handleExport)},
+	{keyword: "我的統計", minTokens: 1, run: text(handleMyStats)},
+	{keyword: "設定保留", minTokens: 2, maxTokens: 2, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleSetRetention(ctx, userID, tokens[1])
+	})},
+	{keyword: "清空", minTokens: 1, maxTokens: 1, run: text(func(ctx context.Context, userID string, _ []string) string {
+		return handlePurge(ctx, userID, false)
+	})},
+	{keyword: "清空", minTokens: 2, maxTokens: 2, match: func(tokens []string) bool { return tokens[1] == "確認" }, run: text(func(ctx context.Context, userID string, _ []string) string {
+		return handlePurge(ctx, userID, true)
+	})},
+	{keyword: "重新計算", minTokens: 1, maxTokens: 1, run: text(func(ctx context.Context, userID string, _ []string) string {
+		return handleReconcile(ctx, userID)
+	})},
+
+	{keyword: "設定預算", minTokens: 3, maxTokens: 3, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleSetBudget(ctx, userID, tokens[1], tokens[2])
+	})},
+	{keyword: "查看預算", minTokens: 1, run: text(func(ctx context.Context, userID string, _ []string) string {
+		return handleListBudgets(ctx, userID)
+	})},
+	{keyword: "未設預算", minTokens: 1, run: text(func(ctx context.Context, userID string, _ []string) string {
+		return handleListUnbudgeted(ctx, userID)
+	})},
+	{keyword: "預算風險", minTokens: 1, run: text(func(ctx context.Context, userID string, _ []string) string {
+		return handleBudgetRisk(ctx, userID)
+	})},
+	{keyword: "預測", minTokens: 1, run: text(func(ctx context.Context, userID string, _ []string) string {
+		return handleForecast(ctx, userID)
+	})},
+	{keyword: "設定總預算", minTokens: 2, maxTokens: 2, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleSetMonthlyBudget(ctx, userID, tokens[1])
+	})},
+
+	{keyword: "設定快捷", minTokens: 2, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleSetMacro(ctx, userID, strings.Join(tokens[1:], " "))
+	})},
+	{keyword: "快捷列表", minTokens: 1, run: text(func(ctx context.Context, userID string, _ []string) string {
+		return handleListMacros(ctx, userID)
+	})},
+	{keyword: "刪除快捷", minTokens: 2, maxTokens: 2, run: text(func(ctx context.Context, userID string, tokens []string) string {
+		return handleDeleteMacro(ctx, userID, tokens[1])
+	})},
+	{keyword: "指令大全", minTokens: 1, run: text(func(ctx context.Context, _ string, _ []string) string {
+		return getHelpText(ctx)
+	})},
+}
+
+// lookupCommand returns the command for tokens. known is true when the first token is a
+// command keyword, even if none of its forms accepts the arguments.
+func lookupCommand(tokens []string) (cmd *command, known bool) {
+	keyword := tokens[0]
+	if helpAliases[strings.ToLower(keyword)] {
+		keyword = "指令大全"
+	}
+
+	for i := range commands {
+		if commands[i].keyword != keyword {
+			continue
+		}
+		known = true
+		if commands[i].accepts(tokens) {
+			return &commands[i], true
+		}
+	}
+	return nil, known
+}
+
+// commandFormatReply is the reply when a command keyword has the wrong arguments
+func commandFormatReply(keyword string) string {
+	return fmt.Sprintf("⚠️ 「%s」的格式不正確，請輸入「指令大全」查看用法。", keyword)
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"accountingbot/logger"
+	"accountingbot/model"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// handleMonthComparison handles the command to compare this month with the previous one
+func handleMonthComparison(ctx context.Context, userID string) string {
+	ctx, span := logger.StartSpan(ctx, "handleMonthComparison")
+	defer span.End()
+
+	now := localNow()
+	currentStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	previousStart := currentStart.AddDate(0, -1, 0)
+
+	logger.Info(ctx, "Month comparison", "user_id", userID, "month", currentStart)
+
+	current, err := model.GetSummaryByRange(ctx, userID, currentStart, currentStart.AddDate(0, 1, 0))
+	if err != nil {
+		logger.Error(ctx, "Failed to get current month summary", "error", err.Error())
+		return "❌ 查詢失敗，請稍後再試。"
+	}
+	previous, err := model.GetSummaryByRange(ctx, userID, previousStart, currentStart)
+	if err != nil {
+		logger.Error(ctx, "Failed to get previous month summary", "error", err.Error())
+		return "❌ 查詢失敗，請稍後再試。"
+	}
+
+	return renderMonthComparison(current, previous, currentStart.Month(), previousStart.Month())
+}
+
+// renderMonthComparison renders the totals and category totals of the current month next
+// to their change from the previous month. A category recorded in only one of the months
+// is compared against 0.
+func renderMonthComparison(current, previous model.Summary, currentMonth, previousMonth time.Month) string {
+	result := fmt.Sprintf("📊 %d月與%d月比較\n", currentMonth, previousMonth)
+	result += fmt.Sprintf("收入：$%s%s\n", model.FormatAmount(current.IncomeTotal), formatDelta(current.IncomeTotal, previous.IncomeTotal))
+	result += fmt.Sprintf("支出：$%s%s\n", model.FormatAmount(current.ExpenseTotal), formatDelta(current.ExpenseTotal, previous.ExpenseTotal))
+	currentNet := current.IncomeTotal - current.ExpenseTotal
+	previousNet := previous.IncomeTotal - previous.ExpenseTotal
+	result += fmt.Sprintf("淨收益：$%s%s\n", model.FormatAmount(currentNet), formatDelta(currentNet, previousNet))
+
+	// Categories only recorded last month show up with 0 this month
+	totals := make(map[string]int, len(current.CategoryTotals)+len(previous.CategoryTotals))
+	for name := range previous.CategoryTotals {
+		totals[name] = 0
+	}
+	for name, amount := range current.CategoryTotals {
+		totals[name] = amount
+	}
+
+	if len(totals) > 0 {
+		result += "\n📂 類別：\n"
+		for _, c := range sortCategoryTotals(totals) {
+			result += fmt.Sprintf("・%s：$%s%s\n", c.Name, model.FormatAmount(c.Amount), formatDelta(c.Amount, previous.CategoryTotals[c.Name]))
+		}
+	}
+	return strings.TrimSuffix(result, "\n")
+}
+
+// formatDelta describes the change from previous to current with an ↑/↓ arrow and, when
+// previous is not 0, the rounded percentage change relative to it
+func formatDelta(current, previous int) string {
+	delta := current - previous
+	if delta == 0 {
+		return "（持平）"
+	}
+
+	arrow, sign, magnitude := "↑", "+", delta
+	if delta < 0 {
+		arrow, sign, magnitude = "↓", "-", -delta
+	}
+	if previous == 0 {
+		return fmt.Sprintf("（%s $%s）", arrow, model.FormatAmount(magnitude))
+	}
+
+	base := previous
+	if base < 0 {
+		base = -base
+	}
+	percent := (magnitude*100 + base/2) / base
+	return fmt.Sprintf("（%s $%s，%s%d%%）", arrow, model.FormatAmount(magnitude), sign, percent)
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"accountingbot/model"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// splitCurrency takes a currency code off the front of a note, so "20 USD 午餐" records
+// 20 USD with the note 午餐. Without a code the transaction is in model.DefaultCurrency.
+func splitCurrency(note string) (currency, rest string) {
+	first, rest, _ := strings.Cut(note, " ")
+	if code, ok := model.NormalizeCurrency(first); ok {
+		return code, rest
+	}
+	return model.DefaultCurrency, note
+}
+
+// formatMoney renders an amount with a $ sign in model.DefaultCurrency and with its
+// currency code otherwise, e.g. "$150" and "USD 20.50"
+func formatMoney(amount int, currency string) string {
+	if currency == "" || currency == model.DefaultCurrency {
+		return "$" + model.FormatAmount(amount)
+	}
+	return currency + " " + model.FormatAmount(amount)
+}
+
+// renderCurrencyAmounts lists amounts kept per currency, model.DefaultCurrency first, e.g.
+// "$150、USD 20"
+func renderCurrencyAmounts(amounts map[string]int) string {
+	codes := make([]string, 0, len(amounts))
+	for code := range amounts {
+		if code != model.DefaultCurrency {
+			codes = append(codes, code)
+		}
+	}
+	slices.Sort(codes)
+	if _, ok := amounts[model.DefaultCurrency]; ok || len(codes) == 0 {
+		codes = append([]string{model.DefaultCurrency}, codes...)
+	}
+
+	parts := make([]string, len(codes))
+	for i, code := range codes {
+		parts[i] = formatMoney(amounts[code], code)
+	}
+	return strings.Join(parts, "、")
+}
+
+// foreignCurrencies returns the currencies other than model.DefaultCurrency in a summary,
+// in alphabetical order
+func foreignCurrencies(summary model.Summary) []string {
+	var codes []string
+	for code := range summary.Currencies {
+		if code != model.DefaultCurrency {
+			codes = append(codes, code)
+		}
+	}
+	slices.Sort(codes)
+	return codes
+}
+
+// renderForeignTotals renders one line per foreign currency in a summary, or "" when
+// everything was in model.DefaultCurrency. Those amounts are kept out of the main totals.
+func renderForeignTotals(summary model.Summary) string {
+	codes := foreignCurrencies(summary)
+	if len(codes) == 0 {
+		return ""
+	}
+
+	result := "\n\n💱 其他幣別（未計入上方合計）："
+	for _, code := range codes {
+		totals := summary.Currencies[code]
+		result += fmt.Sprintf("\n・%s：收入 %s／支出 %s", code,
+			formatMoney(totals.Income, code), formatMoney(totals.Expense, code))
+	}
+	return result
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"accountingbot/logger"
+	"accountingbot/model"
+	"context"
+	"fmt"
+	"time"
+)
+
+// maxInlineCSV keeps an inline export comfortably under LINE's 5000-character text limit
+const maxInlineCSV = 4500
+
+// handleExport handles the command to export a month of transactions as CSV
+func handleExport(ctx context.Context, userID string, tokens []string) string {
+	ctx, span := logger.StartSpan(ctx, "handleExport")
+	defer span.End()
+
+	now := localNow()
+	year, month := now.Year(), now.Month()
+
+	switch len(tokens) {
+	case 1:
+	case 3:
+		var err error
+		year, month, err = parseYearMonth(tokens[1], tokens[2])
+		if err != nil {
+			logger.Warn(ctx, "Export format error", "year", tokens[1], "month", tokens[2])
+			return "⚠️ 匯出格式錯誤，請使用：匯出 或 匯出 2025年 5月"
+		}
+	default:
+		return "⚠️ 匯出格式錯誤，請使用：匯出 或 匯出 2025年 5月"
+	}
+
+	logger.Info(ctx, "Export transactions", "year", year, "month", month)
+
+	start := time.Date(year, month, 1, 0, 0, 0, 0, now.Location())
+	out, err := model.ExportTransactionsCSV(ctx, userID, start, start.AddDate(0, 1, 0))
+	if err != nil {
+		logger.Error(ctx, "Failed to export transactions", "error", err.Error())
+		return "❌ 匯出失敗，請稍後再試。"
+	}
+
+	// There is no file hosting yet, so large exports are not sent at all rather than truncated
+	if len(out) > maxInlineCSV {
+		logger.Warn(ctx, "Export too large to send inline", "bytes", len(out))
+		return fmt.Sprintf("⚠️ %d年%d月的資料太多，無法以訊息傳送，請改用較小的範圍。", year, month)
+	}
+
+	logger.Info(ctx, "Export completed", "bytes", len(out))
+	return fmt.Sprintf("📤 %d年%d月 交易紀錄（CSV）：\n%s", year, month, out)
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"accountingbot/model"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+// Colors of the amounts in summary bubbles
+const (
+	incomeColor  = "#1DB446"
+	expenseColor = "#E0464E"
+	mutedColor   = "#888888"
+)
+
+// summaryBubble renders a summary as a Flex bubble: the income, expense and net totals
+// followed by each side's categories, largest first, and the totals of any foreign
+// currency. It carries the same figures as renderSummary.
+func summaryBubble(title string, summary model.Summary) *linebot.BubbleContainer {
+	net := summary.IncomeTotal - summary.ExpenseTotal
+	netColor := incomeColor
+	if net < 0 {
+		netColor = expenseColor
+	}
+
+	body := []linebot.FlexComponent{
+		flexRow("收入", summary.IncomeTotal, model.DefaultCurrency, incomeColor, true),
+		flexRow("支出", summary.ExpenseTotal, model.DefaultCurrency, expenseColor, true),
+		flexRow("淨收益", net, model.DefaultCurrency, netColor, true),
+	}
+	body = append(body, flexCategorySection("💰 收入明細", summary.IncomeCategoryTotals)...)
+	body = append(body, flexCategorySection("💸 支出明細", summary.ExpenseCategoryTotals)...)
+	body = append(body, flexForeignSection(summary)...)
+
+	return &linebot.BubbleContainer{
+		Type: linebot.FlexContainerTypeBubble,
+		Header: &linebot.BoxComponent{
+			Type:   linebot.FlexComponentTypeBox,
+			Layout: linebot.FlexBoxLayoutTypeVertical,
+			Contents: []linebot.FlexComponent{
+				&linebot.TextComponent{
+					Type:   linebot.FlexComponentTypeText,
+					Text:   "📊 " + title,
+					Weight: linebot.FlexTextWeightTypeBold,
+					Size:   linebot.FlexTextSizeTypeLg,
+					Wrap:   true,
+				},
+			},
+		},
+		Body: &linebot.BoxComponent{
+			Type:     linebot.FlexComponentTypeBox,
+			Layout:   linebot.FlexBoxLayoutTypeVertical,
+			Spacing:  linebot.FlexComponentSpacingTypeSm,
+			Contents: body,
+		},
+	}
+}
+
+// flexCategorySection renders a heading and one row per category, or nothing when there
+// are no categories
+func flexCategorySection(heading string, totals map[string]int) []linebot.FlexComponent {
+	if len(totals) == 0 {
+		return nil
+	}
+
+	section := []linebot.FlexComponent{
+		&linebot.SeparatorComponent{
+			Type:   linebot.FlexComponentTypeSeparator,
+			Margin: linebot.FlexComponentMarginTypeMd,
+		},
+		&linebot.TextComponent{
+			Type:   linebot.FlexComponentTypeText,
+			Text:   heading,
+			Weight: linebot.FlexTextWeightTypeBold,
+			Size:   linebot.FlexTextSizeTypeSm,
+			Margin: linebot.FlexComponentMarginTypeMd,
+		},
+	}
+	for _, ct := range sortCategoryTotals(totals) {
+		section = append(section, flexRow(ct.Name, ct.Amount, model.DefaultCurrency, mutedColor, false))
+	}
+	return section
+}
+
+// flexForeignSection renders a heading and the income and expense of each foreign
+// currency, or nothing when the summary only has the default currency
+func flexForeignSection(summary model.Summary) []linebot.FlexComponent {
+	codes := foreignCurrencies(summary)
+	if len(codes) == 0 {
+		return nil
+	}
+
+	section := []linebot.FlexComponent{
+		&linebot.SeparatorComponent{
+			Type:   linebot.FlexComponentTypeSeparator,
+			Margin: linebot.FlexComponentMarginTypeMd,
+		},
+		&linebot.TextComponent{
+			Type:   linebot.FlexComponentTypeText,
+			Text:   "💱 其他幣別",
+			Weight: linebot.FlexTextWeightTypeBold,
+			Size:   linebot.FlexTextSizeTypeSm,
+			Margin: linebot.FlexComponentMarginTypeMd,
+		},
+	}
+	for _, code := range codes {
+		totals := summary.Currencies[code]
+		section = append(section,
+			flexRow(code+" 收入", totals.Income, code, incomeColor, false),
+			flexRow(code+" 支出", totals.Expense, code, expenseColor, false))
+	}
+	return section
+}
+
+// flexRow renders a label on the left and an amount in currency on the right
+func flexRow(label string, amount int, currency, color string, bold bool) *linebot.BoxComponent {
+	weight := linebot.FlexTextWeightTypeRegular
+	if bold {
+		weight = linebot.FlexTextWeightTypeBold
+	}
+
+	return &linebot.BoxComponent{
+		Type:   linebot.FlexComponentTypeBox,
+		Layout: linebot.FlexBoxLayoutTypeHorizontal,
+		Contents: []linebot.FlexComponent{
+			&linebot.TextComponent{
+				Type: linebot.FlexComponentTypeText,
+				Text: label,
+				Size: linebot.FlexTextSizeTypeSm,
+			},
+			&linebot.TextComponent{
+				Type:   linebot.FlexComponentTypeText,
+				Text:   formatMoney(amount, currency),
+				Size:   linebot.FlexTextSizeTypeSm,
+				Align:  linebot.FlexComponentAlignTypeEnd,
+				Color:  color,
+				Weight: weight,
+			},
+		},
+	}
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"accountingbot/logger"
+	"context"
+)
+
+// welcomeText introduces the bot to a user who just added it as a friend
+const welcomeText = `👋 歡迎使用記帳小幫手！
+
+常用指令：
+- 新增類別 支出 餐費
+- 餐費 150（快速記帳）
+- 結算（本月報表）
+- 指令大全（所有指令）
+
+還沒有類別嗎？點選下方「初始化」即可建立預設類別。`
+
+// HandleFollow handles a user adding the bot as a friend, replying with a welcome and
+// quick replies to seed the default categories or see every command
+func HandleFollow(ctx context.Context, userID string) Reply {
+	ctx, span := logger.StartSpan(ctx, "HandleFollow")
+	defer span.End()
+
+	logger.Info(ctx, "User followed", "user_id", userID)
+
+	return Reply{
+		Text: welcomeText,
+		QuickReplies: []QuickReply{
+			{Label: "初始化", Text: "初始化"},
+			{Label: "指令大全", Text: "指令大全"},
+		},
+	}
+}
+
+// HandleUnfollow handles a user blocking or removing the bot. Nothing can be sent back,
+// so the event is only logged.
+func HandleUnfollow(ctx context.Context, userID string) {
+	ctx, span := logger.StartSpan(ctx, "HandleUnfollow")
+	defer span.End()
+
+	logger.Info(ctx, "User unfollowed", "user_id", userID)
+}
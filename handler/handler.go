@@ -1,11 +1,16 @@
 package handler
 
 import (
+	"accountingbot/clock"
+	"accountingbot/config"
 	"accountingbot/logger"
 	"accountingbot/model"
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -22,52 +27,116 @@ func WebhookHandler(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	text := r.FormValue("message")
 	response := HandleMessage(ctx, userID, text)
-	fmt.Fprint(w, response)
+	fmt.Fprint(w, response.PlainText())
 }
 
-// HandleMessage handles user input messages
-func HandleMessage(ctx context.Context, userID, text string) string {
+// HandleMessage handles user input messages. userID is the key the ledger is stored
+// under: a LINE user ID for direct chats, or a group or room ID for a shared ledger.
+func HandleMessage(ctx context.Context, userID, text string) (reply Reply) {
 	ctx, span := logger.StartSpan(ctx, "HandleMessage")
 	defer span.End()
 
 	logger.Info(ctx, "Processing message", "user_id", userID, "message", text)
 
+	start := time.Now()
+	var command string
+	defer func() {
+		logger.RecordCommand(ctx, command, time.Since(start), isFailureReply(reply.Text))
+	}()
+
+	// Each line of a multi-line message is recorded as its own transaction
+	if lines := splitLines(text); len(lines) > 1 {
+		command = "記帳"
+		reply = Reply{Text: handleBatchTransactions(ctx, userID, lines)}
+		if !isFailureReply(reply.Text) {
+			recordUsage(ctx, userID, command)
+		}
+		return reply
+	}
+
 	tokens := strings.Fields(text)
 	if len(tokens) == 0 {
-		return "請輸入有效的指令。"
+		return Reply{Text: "請輸入有效的指令。", Unmatched: true}
 	}
 
-	switch {
-	case tokens[0] == "新增類別" && len(tokens) >= 3:
-		return handleAddCategory(ctx, userID, tokens[1], tokens[2])
+	tokens = expandMacros(ctx, userID, tokens)
+	command = usageCommand(tokens)
 
-	case tokens[0] == "修改類別" && len(tokens) == 3:
-		return handleUpdateCategory(ctx, userID, tokens[1], tokens[2])
+	reply, matched := dispatchCommand(ctx, userID, tokens)
 
-	case tokens[0] == "刪除類別" && len(tokens) == 2:
-		return handleDeleteCategory(ctx, userID, tokens[1])
+	// Only commands that ran and succeeded count towards 我的統計
+	if matched && !isFailureReply(reply.Text) {
+		recordUsage(ctx, userID, command)
+	}
 
-	case tokens[0] == "已設定類別":
-		return handleListCategories(ctx, userID)
+	// Let the user pick one of their categories instead of retyping the transaction
+	if command == "記帳" && reply.Text == unknownCategoryReply {
+		reply.QuickReplies = categoryQuickReplies(ctx, userID, tokens)
+		reply.Unmatched = true
+	}
+	return reply
+}
 
-	case len(tokens) == 2:
-		return handleQuickTransaction(ctx, userID, tokens[0], tokens[1])
+// dispatchCommand runs the command in tokens and returns its reply. matched is false when
+// no command or quick transaction form accepted tokens, so nothing was run.
+func dispatchCommand(ctx context.Context, userID string, tokens []string) (reply Reply, matched bool) {
+	ctx, span := logger.StartSpan(ctx, "dispatchCommand")
+	defer span.End()
 
-	case tokens[0] == "修改" && len(tokens) == 4:
-		return handleUpdateTransaction(ctx, userID, tokens[1], tokens[2], tokens[3])
+	// Commands are matched on keyword and arity before the quick transaction forms, so a
+	// command with the wrong arguments is never recorded as a transaction
+	if cmd, known := lookupCommand(tokens); cmd != nil {
+		return cmd.run(ctx, userID, tokens), true
+	} else if known {
+		logger.Warn(ctx, "Command format error", "tokens", tokens)
+		return Reply{Text: commandFormatReply(tokens[0])}, false
+	}
 
-	case tokens[0] == "刪除" && len(tokens) == 3:
-		return handleDeleteTransaction(ctx, userID, tokens[1], tokens[2])
+	switch {
+	// Quick transactions come last so they never shadow a two-token command
+	case len(tokens) == 2 && isNumber(tokens[0]):
+		logger.Warn(ctx, "Numeric category name", "category", tokens[0], "amount", tokens[1])
+		return Reply{Text: "請輸入『類別 金額』格式，例如：午餐 150", Unmatched: true}, false
 
-	case tokens[0] == "結算":
-		return handleMonthlySummary(ctx, userID, tokens)
+	case len(tokens) == 2:
+		return Reply{Text: handleQuickTransaction(ctx, userID, tokens[0], tokens[1], "", "", localNow())}, true
 
-	case tokens[0] == "指令大全":
-		return getHelpText(ctx)
+	case len(tokens) >= 3 && isNumber(tokens[1]):
+		// Quick transaction with a note, e.g. "午餐 150 便當店"
+		return Reply{Text: handleQuickTransaction(ctx, userID, tokens[0], tokens[1], "", strings.Join(tokens[2:], " "), localNow())}, true
 	}
 
 	logger.Info(ctx, "Unrecognized command", "command", tokens[0])
-	return "❓ 指令不正確，請重新輸入。"
+	if suggestion := suggestCommand(tokens[0]); suggestion != "" {
+		return Reply{Text: fmt.Sprintf("❓ 指令不正確，您是指「%s」嗎？", suggestion), Unmatched: true}, false
+	}
+	return Reply{Text: "❓ 指令不正確，請重新輸入。", Unmatched: true}, false
+}
+
+// attachmentWindow is how long after recording a transaction an image is linked to it
+const attachmentWindow = 10 * time.Minute
+
+// HandleImage links an image message to the user's most recent transaction
+func HandleImage(ctx context.Context, userID, messageID string) string {
+	ctx, span := logger.StartSpan(ctx, "HandleImage")
+	defer span.End()
+
+	logger.Info(ctx, "Processing image", "user_id", userID, "message_id", messageID)
+
+	// Keep a reference to the LINE message content rather than the image itself
+	attachment := "line:" + messageID
+	detail, err := model.AttachToLatestTransaction(ctx, userID, attachment, Clock.Now().Add(-attachmentWindow))
+	if errors.Is(err, model.ErrTransactionNotFound) {
+		logger.Info(ctx, "No recent transaction for image")
+		return "⚠️ 找不到最近的記帳紀錄，請先記帳再傳送收據照片。"
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to attach image", "error", err.Error())
+		return "❌ 附加圖片失敗，請稍後再試。"
+	}
+
+	logger.Info(ctx, "Image attached", "transaction_id", detail.ID)
+	return fmt.Sprintf("📎 已將圖片附加到 %s %s（編號 %d）", detail.Category, formatMoney(detail.Amount, detail.Currency), detail.ID)
 }
 
 func handleAddCategory(ctx context.Context, userID, typeName, name string) string {
@@ -76,6 +145,18 @@ func handleAddCategory(ctx context.Context, userID, typeName, name string) strin
 
 	logger.Info(ctx, "Add category", "type", typeName, "name", name)
 
+	if !model.IsValidCategoryType(typeName) {
+		logger.Warn(ctx, "Invalid category type", "type", typeName)
+		return "❌ 類別類型只能是 收入 或 支出"
+	}
+
+	normalized, err := normalizeCategoryName(name)
+	if err != nil {
+		logger.Warn(ctx, "Invalid category name", "name", name, "error", err.Error())
+		return categoryNameReply(err)
+	}
+	name = normalized
+
 	// Check if category name already exists
 	exists, err := model.CheckCategoryExists(ctx, userID, name, typeName)
 	if err != nil {
@@ -95,6 +176,7 @@ func handleAddCategory(ctx context.Context, userID, typeName, name string) strin
 		return "❌ 新增類別失敗，請稍後再試。"
 	}
 
+	logger.RecordCategory(ctx, typeName)
 	logger.Info(ctx, "Category added successfully", "name", name, "type", typeName)
 	return fmt.Sprintf("✅ 類別 %s 已新增！", name)
 }
@@ -106,6 +188,13 @@ func handleUpdateCategory(ctx context.Context, userID, oldName, newName string)
 
 	logger.Info(ctx, "Update category", "old_name", oldName, "new_name", newName)
 
+	normalized, err := normalizeCategoryName(newName)
+	if err != nil {
+		logger.Warn(ctx, "Invalid category name", "name", newName, "error", err.Error())
+		return categoryNameReply(err)
+	}
+	newName = normalized
+
 	// Update category using model.UpdateCategory
 	updated, err := model.UpdateCategory(ctx, userID, oldName, newName)
 	if err != nil {
@@ -123,11 +212,24 @@ func handleUpdateCategory(ctx context.Context, userID, oldName, newName string)
 }
 
 // handleDeleteCategory handles the command to delete a category
-func handleDeleteCategory(ctx context.Context, userID, name string) string {
+func handleDeleteCategory(ctx context.Context, userID, name string, confirmed bool) string {
 	ctx, span := logger.StartSpan(ctx, "handleDeleteCategory")
 	defer span.End()
 
-	logger.Info(ctx, "Delete category", "name", name)
+	logger.Info(ctx, "Delete category", "name", name, "confirmed", confirmed)
+
+	// Deleting a category cascades to its transactions, so that needs an explicit 確認
+	if !confirmed {
+		count, err := model.CountTransactionsByCategory(ctx, userID, name)
+		if err != nil {
+			logger.Error(ctx, "Failed to count category transactions", "error", err.Error())
+			return "❌ 刪除失敗，請稍後再試。"
+		}
+		if count > 0 {
+			logger.Warn(ctx, "Category deletion needs confirmation", "name", name, "count", count)
+			return fmt.Sprintf("⚠️ 類別 %s 有 %d 筆紀錄，刪除後會一併刪除。確定要刪除請輸入：刪除類別 %s 確認", name, count, name)
+		}
+	}
 
 	// Delete category using model.DeleteCategory
 	deleted, err := model.DeleteCategory(ctx, userID, name)
@@ -145,6 +247,67 @@ func handleDeleteCategory(ctx context.Context, userID, name string) string {
 	return fmt.Sprintf("🗑️ 類別 %s 已刪除", name)
 }
 
+// handleMergeCategories handles the command to merge one category into another
+func handleMergeCategories(ctx context.Context, userID, sourceName, targetName string) string {
+	ctx, span := logger.StartSpan(ctx, "handleMergeCategories")
+	defer span.End()
+
+	logger.Info(ctx, "Merge categories", "source", sourceName, "target", targetName)
+
+	moved, err := model.MergeCategories(ctx, userID, sourceName, targetName)
+	switch {
+	case errors.Is(err, model.ErrSameCategory):
+		return "❌ 無法將類別合併到自己。"
+	case errors.Is(err, model.ErrCategoryNotFound):
+		return "❌ 類別不存在，請確認兩個類別名稱。"
+	case errors.Is(err, model.ErrCategoryTypeDiffers):
+		return "❌ 只能合併相同類型（收入/支出）的類別。"
+	case err != nil:
+		logger.Error(ctx, "Failed to merge categories", "error", err.Error())
+		return "❌ 合併失敗，請稍後再試。"
+	}
+
+	logger.Info(ctx, "Categories merged successfully", "source", sourceName, "target", targetName,
+		"moved", moved.Transactions, "recurring", moved.Recurring)
+	reply := fmt.Sprintf("🔀 已將 %s 合併到 %s，移動了 %d 筆紀錄", sourceName, targetName, moved.Transactions)
+	if moved.Recurring > 0 {
+		reply += fmt.Sprintf("、%d 筆訂閱", moved.Recurring)
+	}
+	return reply + "。"
+}
+
+// handleSeedCategories handles the command to create the default categories
+func handleSeedCategories(ctx context.Context, userID string) string {
+	ctx, span := logger.StartSpan(ctx, "handleSeedCategories")
+	defer span.End()
+
+	logger.Info(ctx, "Seed default categories")
+
+	created, skipped, err := model.SeedDefaultCategories(ctx, userID)
+	if err != nil {
+		logger.Error(ctx, "Failed to seed default categories", "error", err.Error())
+		return "❌ 初始化失敗，請稍後再試。"
+	}
+
+	if len(created) == 0 {
+		return "⚠️ 預設類別都已存在，沒有新增任何類別。"
+	}
+
+	for _, c := range model.DefaultCategories {
+		if slices.Contains(created, c.Name) {
+			logger.RecordCategory(ctx, c.Type)
+		}
+	}
+
+	response := fmt.Sprintf("✅ 已新增預設類別：%s", strings.Join(created, "、"))
+	if len(skipped) > 0 {
+		response += fmt.Sprintf("\n⏭️ 已存在而略過：%s", strings.Join(skipped, "、"))
+	}
+
+	logger.Info(ctx, "Default categories seeded", "created", len(created), "skipped", len(skipped))
+	return response
+}
+
 // handleListCategories handles the command to list categories
 func handleListCategories(ctx context.Context, userID string) string {
 	ctx, span := logger.StartSpan(ctx, "handleListCategories")
@@ -164,7 +327,7 @@ func handleListCategories(ctx context.Context, userID string) string {
 
 	if len(incomeList) == 0 && len(expenseList) == 0 {
 		logger.Warn(ctx, "No categories yet")
-		return "⚠️ 你尚未新增任何類別。"
+		return "⚠️ 你尚未新增任何類別。\n輸入『初始化』可建立預設類別。"
 	}
 
 	response := "📂 你的可用類別：\n"
@@ -187,39 +350,182 @@ func handleListCategories(ctx context.Context, userID string) string {
 	return response
 }
 
-// handleQuickTransaction handles the command for quick transaction recording
-func handleQuickTransaction(ctx context.Context, userID, categoryName, amountStr string) string {
+// isNumber reports whether s is a plain decimal number such as "150" or "45.5". It also
+// accepts amounts model.ParseAmount rejects for their precision, so those get a clear reply.
+func isNumber(s string) bool {
+	_, err := model.ParseAmount(s)
+	return err == nil || errors.Is(err, model.ErrAmountPrecision)
+}
+
+// amountErrorReply explains why model.ParseAmount rejected an amount
+func amountErrorReply(err error) string {
+	switch {
+	case errors.Is(err, model.ErrAmountPrecision):
+		return "金額最多只能有兩位小數"
+	case errors.Is(err, model.ErrNegativeAmount):
+		return "金額必須大於 0"
+	}
+	return "金額格式錯誤"
+}
+
+// handleQuickTransaction handles the command for quick transaction recording.
+// If forcedType is not empty, the category must be of that type. A currency code at the
+// start of the note, as in "餐費 20 USD", sets the transaction's currency.
+func handleQuickTransaction(ctx context.Context, userID, categoryName, amountStr, forcedType, note string, createdAt time.Time) string {
 	ctx, span := logger.StartSpan(ctx, "handleQuickTransaction")
 	defer span.End()
 
-	logger.Info(ctx, "Quick transaction", "category", categoryName, "amount", amountStr)
+	currency, note := splitCurrency(note)
+	logger.Info(ctx, "Quick transaction",
+		"category", categoryName,
+		"amount", amountStr,
+		"currency", currency,
+		"forced_type", forcedType,
+		"note", note,
+		"created_at", createdAt)
 
-	amount, err := strconv.Atoi(amountStr)
+	amount, err := model.ParseAmount(amountStr)
 	if err != nil {
-		logger.Warn(ctx, "Amount format error", "amount", amountStr)
-		return "金額格式錯誤"
+		logger.Warn(ctx, "Amount format error", "amount", amountStr, "error", err.Error())
+		return amountErrorReply(err)
+	}
+
+	if amount <= 0 {
+		logger.Warn(ctx, "Non-positive amount", "amount", amount)
+		return "金額必須大於 0"
 	}
 
 	// Get category ID and Type
 	categoryID, categoryType, err := model.GetCategoryIdAndType(ctx, userID, categoryName)
 	if err != nil {
 		logger.Warn(ctx, "Category does not exist", "category", categoryName)
-		return "❌ 類別不存在，請先新增。"
+		return unknownCategoryReply
+	}
+
+	if forcedType != "" && forcedType != categoryType {
+		logger.Warn(ctx, "Category type does not match explicit type",
+			"category", categoryName,
+			"category_type", categoryType,
+			"forced_type", forcedType)
+		return fmt.Sprintf("❌ 類別 %s 不是%s類別。", categoryName, forcedType)
 	}
 
 	// Add transaction record
-	transaction, err := model.AddTransaction(ctx, userID, categoryID, categoryType, amount)
+	transaction, err := model.AddTransactionInCurrency(ctx, userID, categoryID, categoryType, amount, currency, note, createdAt)
 	if err != nil {
 		logger.Error(ctx, "Failed to record transaction", "error", err.Error())
 		return "記錄失敗，請稍後再試。"
 	}
 
+	logger.RecordTransaction(ctx, categoryType)
 	logger.Info(ctx, "Transaction recorded successfully",
 		"transaction_id", transaction.ID,
 		"type", categoryType,
 		"amount", amount,
 		"category", categoryName)
-	return fmt.Sprintf("✅ %s $%d 類別：%s 已記錄！", categoryType, amount, categoryName)
+	response := fmt.Sprintf("✅ %s %s 類別：%s 已記錄！", categoryType, formatMoney(amount, currency), categoryName)
+	if note != "" {
+		response += fmt.Sprintf("\n📝 備註：%s", note)
+	}
+	if !sameDay(createdAt, localNow()) {
+		response += fmt.Sprintf("\n📅 日期：%s", createdAt.Format("2006-01-02"))
+	}
+
+	// Budgets are in the default currency, which a foreign expense does not count towards
+	if categoryType == "支出" && currency == model.DefaultCurrency {
+		response += checkCategoryBudget(ctx, userID, categoryID, categoryName, createdAt)
+		response += checkMonthlyBudget(ctx, userID, amount, createdAt)
+	}
+	return response
+}
+
+// handleBackdatedTransaction handles the command for recording a transaction on a past date.
+// Today is accepted, dates after it are not.
+func handleBackdatedTransaction(ctx context.Context, userID, dateStr, categoryName, amountStr, note string) string {
+	ctx, span := logger.StartSpan(ctx, "handleBackdatedTransaction")
+	defer span.End()
+
+	logger.Info(ctx, "Backdated transaction", "date", dateStr, "category", categoryName, "amount", amountStr)
+
+	// time.Parse rejects impossible dates such as 2025-02-30
+	date, err := time.ParseInLocation("2006-01-02", dateStr, config.Location())
+	if err != nil {
+		logger.Warn(ctx, "Date format error", "date", dateStr)
+		return "⚠️ 日期格式錯誤，請使用：記帳 2025-05-03 類別名稱 金額"
+	}
+
+	now := localNow()
+	if date.After(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())) {
+		logger.Warn(ctx, "Backdated transaction in the future", "date", dateStr)
+		return "⚠️ 不能記錄未來日期的帳目，請輸入今天或更早的日期。"
+	}
+
+	return handleQuickTransaction(ctx, userID, categoryName, amountStr, "", note, date)
+}
+
+// Clock is where commands get the current time, such as the month 結算 reports and the time
+// a transaction is recorded at. Tests replace it with a clock.Fake to fix the date.
+var Clock clock.Clock = clock.Real{}
+
+// localNow returns the current time in the configured timezone
+func localNow() time.Time {
+	return Clock.Now().In(config.Location())
+}
+
+// sameDay reports whether a and b fall on the same calendar day
+func sameDay(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
+
+// checkMonthlyBudget returns a warning when the latest expense pushes
+// the month's total expense over the overall budget
+func checkMonthlyBudget(ctx context.Context, userID string, amount int, createdAt time.Time) string {
+	ctx, span := logger.StartSpan(ctx, "checkMonthlyBudget")
+	defer span.End()
+
+	budget, err := model.GetMonthlyBudget(ctx, userID)
+	if err != nil || budget <= 0 {
+		return ""
+	}
+
+	summary, err := model.GetMonthlySummary(ctx, userID, createdAt)
+	if err != nil {
+		logger.Warn(ctx, "Failed to get monthly summary for budget check", "error", err.Error())
+		return ""
+	}
+
+	// Only warn on the transaction that crosses the budget
+	previous := summary.ExpenseTotal - amount
+	if previous > budget || summary.ExpenseTotal <= budget {
+		return ""
+	}
+
+	logger.Info(ctx, "Monthly budget exceeded",
+		"budget", budget,
+		"expense_total", summary.ExpenseTotal)
+	return fmt.Sprintf("\n⚠️ 本月總支出 $%s 已超出總預算 $%s", model.FormatAmount(summary.ExpenseTotal), model.FormatAmount(budget))
+}
+
+// handleSetMonthlyBudget handles the command to set the overall monthly budget
+func handleSetMonthlyBudget(ctx context.Context, userID, amountStr string) string {
+	ctx, span := logger.StartSpan(ctx, "handleSetMonthlyBudget")
+	defer span.End()
+
+	logger.Info(ctx, "Set monthly budget", "amount", amountStr)
+
+	amount, err := model.ParseAmount(amountStr)
+	if err != nil || amount <= 0 {
+		logger.Warn(ctx, "Budget format error", "amount", amountStr)
+		return "預算金額格式錯誤，請輸入大於 0 的數字。"
+	}
+
+	if err := model.SetMonthlyBudget(ctx, userID, amount); err != nil {
+		logger.Error(ctx, "Failed to set monthly budget", "error", err.Error())
+		return "❌ 設定總預算失敗，請稍後再試。"
+	}
+
+	logger.Info(ctx, "Monthly budget set successfully", "amount", amount)
+	return fmt.Sprintf("✅ 本月總預算已設定為 $%s", model.FormatAmount(amount))
 }
 
 // handleUpdateTransaction handles the command to update a transaction
@@ -232,8 +538,12 @@ func handleUpdateTransaction(ctx context.Context, userID, category, oldAmountStr
 		"old_amount", oldAmountStr,
 		"new_amount", newAmountStr)
 
-	oldAmount, err1 := strconv.Atoi(oldAmountStr)
-	newAmount, err2 := strconv.Atoi(newAmountStr)
+	oldAmount, err1 := model.ParseAmount(oldAmountStr)
+	newAmount, err2 := model.ParseAmount(newAmountStr)
+	if err1 == nil && errors.Is(err2, model.ErrNegativeAmount) {
+		logger.Warn(ctx, "Non-positive amount", "new_amount", newAmountStr)
+		return "金額必須大於 0"
+	}
 	if err1 != nil || err2 != nil {
 		logger.Warn(ctx, "Amount format error",
 			"old_amount", oldAmountStr,
@@ -241,14 +551,28 @@ func handleUpdateTransaction(ctx context.Context, userID, category, oldAmountStr
 		return "金額格式錯誤，請輸入數字。"
 	}
 
+	if newAmount <= 0 {
+		logger.Warn(ctx, "Non-positive amount", "new_amount", newAmount)
+		return "金額必須大於 0"
+	}
+
 	// Find transaction record
-	transactionID, err := model.FindTransactionID(ctx, userID, category, oldAmount)
+	ids, err := model.FindTransactionIDs(ctx, userID, category, oldAmount)
 	if err != nil {
+		logger.Error(ctx, "Failed to find transaction", "error", err.Error())
+		return "❌ 修改失敗，請稍後再試。"
+	}
+	if len(ids) == 0 {
 		logger.Warn(ctx, "No matching transaction record found",
 			"category", category,
 			"amount", oldAmount)
 		return "❌ 找不到符合條件的紀錄。"
 	}
+	if len(ids) > 1 {
+		logger.Warn(ctx, "Ambiguous transaction to update", "category", category, "amount", oldAmount, "matches", len(ids))
+		return ambiguousTransactionReply(category, oldAmount, ids, fmt.Sprintf("修改 編號 %d %s", ids[0], model.FormatAmount(newAmount)))
+	}
+	transactionID := ids[0]
 
 	// Update transaction
 	err = model.UpdateTransaction(ctx, transactionID, newAmount)
@@ -262,7 +586,7 @@ func handleUpdateTransaction(ctx context.Context, userID, category, oldAmountStr
 		"category", category,
 		"old_amount", oldAmount,
 		"new_amount", newAmount)
-	return fmt.Sprintf("✅ 已將 %s 的金額從 $%d 修改為 $%d。", category, oldAmount, newAmount)
+	return fmt.Sprintf("✅ 已將 %s 的金額從 $%s 修改為 $%s。", category, model.FormatAmount(oldAmount), model.FormatAmount(newAmount))
 }
 
 // handleDeleteTransaction handles the command to delete a transaction
@@ -272,20 +596,29 @@ func handleDeleteTransaction(ctx context.Context, userID, category, amountStr st
 
 	logger.Info(ctx, "Delete transaction", "category", category, "amount", amountStr)
 
-	amount, err := strconv.Atoi(amountStr)
+	amount, err := model.ParseAmount(amountStr)
 	if err != nil {
 		logger.Warn(ctx, "Amount format error", "amount", amountStr)
 		return "金額格式錯誤，請輸入數字。"
 	}
 
 	// Find transaction record
-	transactionID, err := model.FindTransactionID(ctx, userID, category, amount)
+	ids, err := model.FindTransactionIDs(ctx, userID, category, amount)
 	if err != nil {
+		logger.Error(ctx, "Failed to find transaction", "error", err.Error())
+		return "❌ 刪除失敗，請稍後再試。"
+	}
+	if len(ids) == 0 {
 		logger.Warn(ctx, "No matching transaction record found",
 			"category", category,
 			"amount", amount)
 		return "❌ 找不到符合條件的紀錄。"
 	}
+	if len(ids) > 1 {
+		logger.Warn(ctx, "Ambiguous transaction to delete", "category", category, "amount", amount, "matches", len(ids))
+		return ambiguousTransactionReply(category, amount, ids, fmt.Sprintf("刪除 編號 %d", ids[0]))
+	}
+	transactionID := ids[0]
 
 	// Delete transaction
 	err = model.DeleteTransaction(ctx, transactionID)
@@ -298,87 +631,616 @@ func handleDeleteTransaction(ctx context.Context, userID, category, amountStr st
 		"transaction_id", transactionID,
 		"category", category,
 		"amount", amount)
-	return fmt.Sprintf("🗑️ 已刪除 %s $%d 的紀錄。", category, amount)
+	return fmt.Sprintf("🗑️ 已刪除 %s $%s 的紀錄。", category, model.FormatAmount(amount))
+}
+
+// ambiguousTransactionReply asks the user to pick one of several matching transactions by ID
+func ambiguousTransactionReply(category string, amount int, ids []int, example string) string {
+	idStrs := make([]string, len(ids))
+	for i, id := range ids {
+		idStrs[i] = strconv.Itoa(id)
+	}
+	return fmt.Sprintf("⚠️ 找到 %d 筆 %s $%s 的紀錄（編號：%s），請指定編號，例如：%s",
+		len(ids), category, model.FormatAmount(amount), strings.Join(idStrs, "、"), example)
+}
+
+// handleUpdateTransactionByID handles the command to update a transaction by its ID
+func handleUpdateTransactionByID(ctx context.Context, userID, idStr, newAmountStr string) string {
+	ctx, span := logger.StartSpan(ctx, "handleUpdateTransactionByID")
+	defer span.End()
+
+	logger.Info(ctx, "Update transaction by ID", "id", idStr, "new_amount", newAmountStr)
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logger.Warn(ctx, "Transaction ID format error", "id", idStr)
+		return "編號格式錯誤，請輸入數字。"
+	}
+
+	newAmount, err := model.ParseAmount(newAmountStr)
+	if errors.Is(err, model.ErrNegativeAmount) {
+		logger.Warn(ctx, "Non-positive amount", "new_amount", newAmountStr)
+		return "金額必須大於 0"
+	}
+	if err != nil {
+		logger.Warn(ctx, "Amount format error", "new_amount", newAmountStr)
+		return "金額格式錯誤，請輸入數字。"
+	}
+	if newAmount <= 0 {
+		logger.Warn(ctx, "Non-positive amount", "new_amount", newAmount)
+		return "金額必須大於 0"
+	}
+
+	original, err := model.GetTransactionByID(ctx, userID, id)
+	if errors.Is(err, model.ErrTransactionNotFound) {
+		return "❌ 找不到符合條件的紀錄。"
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to get transaction", "error", err.Error())
+		return "❌ 修改失敗，請稍後再試。"
+	}
+
+	if err := model.UpdateTransaction(ctx, id, newAmount); err != nil {
+		logger.Error(ctx, "Failed to update transaction", "error", err.Error())
+		return "❌ 修改失敗，請稍後再試。"
+	}
+
+	logger.Info(ctx, "Transaction updated successfully",
+		"transaction_id", id,
+		"old_amount", original.Amount,
+		"new_amount", newAmount)
+	return fmt.Sprintf("✅ 已將編號 %d 的金額從 %s 修改為 %s。", id, formatMoney(original.Amount, original.Currency), formatMoney(newAmount, original.Currency))
+}
+
+// handleOverrideTransactionType handles the command to set one transaction's type,
+// regardless of its category's type
+func handleOverrideTransactionType(ctx context.Context, userID, idStr, transType string) string {
+	ctx, span := logger.StartSpan(ctx, "handleOverrideTransactionType")
+	defer span.End()
+
+	logger.Info(ctx, "Override transaction type", "id", idStr, "type", transType)
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logger.Warn(ctx, "Transaction ID format error", "id", idStr)
+		return "編號格式錯誤，請輸入數字。"
+	}
+
+	if transType != "收入" && transType != "支出" {
+		logger.Warn(ctx, "Invalid transaction type", "type", transType)
+		return "❌ 類型只能是 收入 或 支出"
+	}
+
+	updated, err := model.UpdateTransactionType(ctx, userID, id, transType)
+	if errors.Is(err, model.ErrTransactionNotFound) {
+		return "❌ 找不到符合條件的紀錄。"
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to override transaction type", "error", err.Error())
+		return "❌ 修改失敗，請稍後再試。"
+	}
+
+	logger.Info(ctx, "Transaction type overridden", "transaction_id", id, "type", transType)
+	return fmt.Sprintf("✅ 已將編號 %d（%s %s）改為%s。", id, updated.Category, formatMoney(updated.Amount, updated.Currency), transType)
+}
+
+// handleDeleteTransactionByID handles the command to delete a transaction by its ID
+func handleDeleteTransactionByID(ctx context.Context, userID, idStr string) string {
+	ctx, span := logger.StartSpan(ctx, "handleDeleteTransactionByID")
+	defer span.End()
+
+	logger.Info(ctx, "Delete transaction by ID", "id", idStr)
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logger.Warn(ctx, "Transaction ID format error", "id", idStr)
+		return "編號格式錯誤，請輸入數字。"
+	}
+
+	original, err := model.GetTransactionByID(ctx, userID, id)
+	if errors.Is(err, model.ErrTransactionNotFound) {
+		return "❌ 找不到符合條件的紀錄。"
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to get transaction", "error", err.Error())
+		return "❌ 刪除失敗，請稍後再試。"
+	}
+
+	if err := model.DeleteTransaction(ctx, id); err != nil {
+		logger.Error(ctx, "Failed to delete transaction", "error", err.Error())
+		return "❌ 刪除失敗，請稍後再試。"
+	}
+
+	logger.Info(ctx, "Transaction deleted successfully", "transaction_id", id, "amount", original.Amount)
+	return fmt.Sprintf("🗑️ 已刪除編號 %d 的紀錄 %s。", id, formatMoney(original.Amount, original.Currency))
+}
+
+// handleUndo handles the command to delete the most recent transaction
+func handleUndo(ctx context.Context, userID string) string {
+	ctx, span := logger.StartSpan(ctx, "handleUndo")
+	defer span.End()
+
+	logger.Info(ctx, "Undo last transaction")
+
+	deleted, err := model.DeleteLastTransaction(ctx, userID)
+	if errors.Is(err, model.ErrTransactionNotFound) {
+		return "⚠️ 目前沒有可撤銷的紀錄。"
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to undo transaction", "error", err.Error())
+		return "❌ 撤銷失敗，請稍後再試。"
+	}
+
+	logger.Info(ctx, "Transaction undone", "transaction_id", deleted.ID)
+	return fmt.Sprintf("↩️ 已撤銷 %s %s", deleted.Category, formatMoney(deleted.Amount, deleted.Currency))
 }
 
 // handleMonthlySummary handles the command for monthly summary
-func handleMonthlySummary(ctx context.Context, userID string, tokens []string) string {
+func handleMonthlySummary(ctx context.Context, userID string, tokens []string) Reply {
 	ctx, span := logger.StartSpan(ctx, "handleMonthlySummary")
 	defer span.End()
 
 	var targetMonth time.Time
 	var monthSpec string
 
-	if len(tokens) == 3 {
-		// Try to parse format: "結算 2025年 5月"
-		yearStr := strings.TrimSuffix(tokens[1], "年")
-		monthStr := strings.TrimSuffix(tokens[2], "月")
-		monthSpec = yearStr + "年" + monthStr + "月"
+	// Pick out the optional flags: "結算 2025年 5月 明細 排序金額", "結算 支出", "結算 含封存",
+	// every token after 排除 is a category to leave out: "結算 排除 投資 保險"
+	var args []string
+	var filter model.SummaryFilter
+	showDetail, sortByAmount := false, false
+	for i, token := range tokens[1:] {
+		if token == "排除" {
+			filter.ExcludeCategories = tokens[i+2:]
+			break
+		}
+		switch token {
+		case "明細":
+			showDetail = true
+		case "排序金額":
+			showDetail = true
+			sortByAmount = true
+		case "收入", "支出":
+			filter.Type = token
+		case "含封存":
+			filter.IncludeArchived = true
+		default:
+			args = append(args, token)
+		}
+	}
 
-		logger.Info(ctx, "Specified month summary", "year", yearStr, "month", monthStr)
-		year, yErr := strconv.Atoi(yearStr)
-		month, mErr := strconv.Atoi(monthStr)
+	if filter.ExcludeCategories != nil && len(filter.ExcludeCategories) == 0 {
+		logger.Warn(ctx, "No categories to exclude")
+		return Reply{Text: "⚠️ 請指定要排除的類別，例如：結算 排除 投資"}
+	}
 
-		if yErr != nil || mErr != nil || month < 1 || month > 12 {
-			logger.Warn(ctx, "Summary format error", "year", yearStr, "month", monthStr)
-			return "⚠️ 結算格式錯誤，請使用：結算 或 結算 2025年 5月"
+	if len(args) == 2 {
+		// Try to parse format: "結算 2025年 5月", suffixes are optional
+		year, month, err := parseYearMonth(args[0], args[1])
+		if err != nil {
+			logger.Warn(ctx, "Summary format error", "year", args[0], "month", args[1])
+			return Reply{Text: "⚠️ 結算格式錯誤，請使用：結算 或 結算 2025年 5月"}
 		}
+		monthSpec = fmt.Sprintf("%d年%d月", year, month)
+
+		logger.Info(ctx, "Specified month summary", "year", year, "month", month)
 
 		// Create the corresponding month's start time (UTC)
-		targetMonth = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+		targetMonth = time.Date(year, month, 1, 0, 0, 0, 0, config.Location())
 	} else {
 		// Default to current month
-		targetMonth = time.Now().UTC()
+		targetMonth = localNow()
 		monthSpec = "當月"
 		logger.Info(ctx, "Current month summary")
 	}
 
-	// Get monthly summary using model.GetMonthlySummary
-	summary, err := model.GetMonthlySummary(ctx, userID, targetMonth)
+	start := time.Date(targetMonth.Year(), targetMonth.Month(), 1, 0, 0, 0, 0, targetMonth.Location())
+	end := start.AddDate(0, 1, 0)
+
+	summary, err := model.GetFilteredSummaryByRange(ctx, userID, start, end, filter)
 	if err != nil {
 		logger.Error(ctx, "Failed to get summary", "error", err.Error())
+		return Reply{Text: "取得報表失敗，請稍後再試。"}
+	}
+
+	title := fmt.Sprintf("%d年%d月", targetMonth.Year(), targetMonth.Month())
+	if len(filter.ExcludeCategories) > 0 {
+		title += fmt.Sprintf("（排除：%s）", strings.Join(filter.ExcludeCategories, "、"))
+	}
+	if filter.IncludeArchived {
+		title += "（含封存）"
+	}
+	var result string
+	if filter.Type != "" {
+		result = renderTypeSummary(title, summary, filter.Type)
+	} else {
+		result = renderSummary(title, summary)
+	}
+
+	// Add transaction-level detail
+	if showDetail {
+		details, err := model.GetTransactionDetailsWithArchive(ctx, userID, start, end, filter.IncludeArchived)
+		if err != nil {
+			logger.Error(ctx, "Failed to get transaction details", "error", err.Error())
+			return Reply{Text: "取得報表失敗，請稍後再試。"}
+		}
+		result += "\n\n" + renderTransactionDetails(filterDetails(details, filter), sortByAmount)
+	}
+
+	logger.Info(ctx, "Summary completed",
+		"month_spec", monthSpec,
+		"income", summary.IncomeTotal,
+		"expense", summary.ExpenseTotal)
+
+	reply := Reply{Text: result}
+	// The bubble has no room for transaction details and always shows both sides
+	if !showDetail && filter.Type == "" {
+		reply.Flex = summaryBubble(title, summary)
+	}
+	return reply
+}
+
+// filterDetails drops the transactions the summary filter leaves out
+func filterDetails(details []model.TransactionDetail, filter model.SummaryFilter) []model.TransactionDetail {
+	if len(filter.ExcludeCategories) == 0 && filter.Type == "" {
+		return details
+	}
+
+	skip := make(map[string]bool, len(filter.ExcludeCategories))
+	for _, name := range filter.ExcludeCategories {
+		skip[name] = true
+	}
+
+	kept := make([]model.TransactionDetail, 0, len(details))
+	for _, d := range details {
+		if !skip[d.Category] && (filter.Type == "" || d.Type == filter.Type) {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
+
+// handleWeeklySummary handles the command for the current or previous ISO week (Monday–Sunday)
+func handleWeeklySummary(ctx context.Context, userID string, tokens []string) string {
+	ctx, span := logger.StartSpan(ctx, "handleWeeklySummary")
+	defer span.End()
+
+	now := localNow()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	daysSinceMonday := (int(today.Weekday()) + 6) % 7
+	start := today.AddDate(0, 0, -daysSinceMonday)
+
+	if len(tokens) == 2 {
+		if tokens[1] != "上週" {
+			logger.Warn(ctx, "Weekly summary format error", "week", tokens[1])
+			return "⚠️ 週結格式錯誤，請使用：週結 或 週結 上週"
+		}
+		start = start.AddDate(0, 0, -7)
+	}
+	end := start.AddDate(0, 0, 7)
+
+	logger.Info(ctx, "Weekly summary", "start", start, "end", end)
+
+	summary, err := model.GetSummaryByRange(ctx, userID, start, end)
+	if err != nil {
+		logger.Error(ctx, "Failed to get weekly summary", "error", err.Error())
 		return "取得報表失敗，請稍後再試。"
 	}
 
-	// Create basic report header
-	result := fmt.Sprintf("📊 %d年%d月\n收入：$%d\n支出：$%d\n\n",
-		targetMonth.Year(), targetMonth.Month(), summary.IncomeTotal, summary.ExpenseTotal)
-
-	// Organize income and expense categories separately
-	incomeCategories := make(map[string]int)
-	expenseCategories := make(map[string]int)
-
-	// Get category info from models
-	categoriesInfo, err := model.GetCategoriesInfo(ctx, userID)
-	if err != nil {
-		logger.Warn(ctx, "Failed to get category info", "error", err.Error())
-		// Continue, since we at least have amount data
-	}
-
-	// Group by category type
-	for cat, amt := range summary.CategoryTotals {
-		// Check if we have type info for this category
-		if catType, ok := categoriesInfo[cat]; ok {
-			if catType == "收入" {
-				incomeCategories[cat] = amt
-			} else {
-				expenseCategories[cat] = amt
-			}
-		} else {
-			// If no type info, judge by amount (temporary solution)
-			if amt > 0 {
-				incomeCategories[cat] = amt
-			} else {
-				expenseCategories[cat] = amt
-			}
+	title := fmt.Sprintf("%s - %s", start.Format("2006/01/02"), end.AddDate(0, 0, -1).Format("2006/01/02"))
+
+	logger.Info(ctx, "Weekly summary completed",
+		"income", summary.IncomeTotal,
+		"expense", summary.ExpenseTotal)
+	return renderSummary(title, summary)
+}
+
+// handleRangeSummary handles the command for a summary between two dates, both inclusive
+func handleRangeSummary(ctx context.Context, userID, startStr, endStr string) string {
+	ctx, span := logger.StartSpan(ctx, "handleRangeSummary")
+	defer span.End()
+
+	logger.Info(ctx, "Range summary", "start", startStr, "end", endStr)
+
+	start, sErr := time.ParseInLocation("2006-01-02", startStr, config.Location())
+	end, eErr := time.ParseInLocation("2006-01-02", endStr, config.Location())
+	if sErr != nil || eErr != nil {
+		logger.Warn(ctx, "Range summary date format error", "start", startStr, "end", endStr)
+		return "⚠️ 日期格式錯誤，請使用：結算 2025-05-01 2025-05-15"
+	}
+
+	if start.After(end) {
+		logger.Warn(ctx, "Range summary start after end", "start", startStr, "end", endStr)
+		return "⚠️ 開始日期必須早於結束日期。"
+	}
+
+	summary, err := model.GetSummaryByRange(ctx, userID, start, end.AddDate(0, 0, 1))
+	if err != nil {
+		logger.Error(ctx, "Failed to get range summary", "error", err.Error())
+		return "取得報表失敗，請稍後再試。"
+	}
+
+	title := fmt.Sprintf("%s - %s", start.Format("2006/01/02"), end.Format("2006/01/02"))
+
+	logger.Info(ctx, "Range summary completed",
+		"income", summary.IncomeTotal,
+		"expense", summary.ExpenseTotal)
+	return renderSummary(title, summary)
+}
+
+// handleDailySummary handles the command for today's summary or, with a YYYY-MM-DD
+// argument, a specific day's
+func handleDailySummary(ctx context.Context, userID string, tokens []string) string {
+	ctx, span := logger.StartSpan(ctx, "handleDailySummary")
+	defer span.End()
+
+	now := localNow()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	isToday := true
+	if len(tokens) == 2 {
+		parsed, err := time.ParseInLocation("2006-01-02", tokens[1], config.Location())
+		if err != nil {
+			logger.Warn(ctx, "Daily summary date format error", "date", tokens[1])
+			return "⚠️ 日期格式錯誤，請使用：日結 或 日結 2025-05-03"
+		}
+		isToday = sameDay(parsed, day)
+		day = parsed
+	}
+
+	logger.Info(ctx, "Daily summary", "user_id", userID, "day", day)
+
+	summary, err := model.GetSummaryByRange(ctx, userID, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		logger.Error(ctx, "Failed to get daily summary", "error", err.Error())
+		return "取得報表失敗，請稍後再試。"
+	}
+
+	if len(summary.Currencies) == 0 {
+		if isToday {
+			return "📭 今天還沒有任何紀錄"
+		}
+		return fmt.Sprintf("📭 %s 沒有任何紀錄", day.Format("2006/01/02"))
+	}
+
+	logger.Info(ctx, "Daily summary completed",
+		"income", summary.IncomeTotal,
+		"expense", summary.ExpenseTotal)
+	return renderSummary(day.Format("2006/01/02"), summary)
+}
+
+// handleAnnualSummary handles the command for a year's summary, the current year by default
+func handleAnnualSummary(ctx context.Context, userID string, tokens []string) string {
+	ctx, span := logger.StartSpan(ctx, "handleAnnualSummary")
+	defer span.End()
+
+	year := localNow().Year()
+	if len(tokens) == 2 {
+		parsed, err := strconv.Atoi(strings.TrimSuffix(tokens[1], "年"))
+		if err != nil || parsed < 1 {
+			logger.Warn(ctx, "Annual summary format error", "year", tokens[1])
+			return "⚠️ 年結格式錯誤，請使用：年結 或 年結 2025年"
+		}
+		year = parsed
+	}
+
+	logger.Info(ctx, "Annual summary", "user_id", userID, "year", year)
+
+	annual, err := model.GetAnnualSummary(ctx, userID, year)
+	if err != nil {
+		logger.Error(ctx, "Failed to get annual summary", "error", err.Error())
+		return "取得報表失敗，請稍後再試。"
+	}
+
+	return renderAnnualSummary(annual)
+}
+
+// renderAnnualSummary renders one row per month followed by the year's category totals
+func renderAnnualSummary(annual model.AnnualSummary) string {
+	result := fmt.Sprintf("📊 %d年 年度報表\n📅 每月明細（收入／支出）：\n", annual.Year)
+	for i, m := range annual.Months {
+		result += fmt.Sprintf("・%2d月：$%s／$%s\n", i+1, model.FormatAmount(m.Income), model.FormatAmount(m.Expense))
+	}
+	result += "\n"
+
+	return result + renderSummary(fmt.Sprintf("%d年 合計", annual.Year), annual.Total)
+}
+
+// handleHalfYearSummary handles the command for a half-year summary
+func handleHalfYearSummary(ctx context.Context, userID, half, yearStr string) string {
+	ctx, span := logger.StartSpan(ctx, "handleHalfYearSummary")
+	defer span.End()
+
+	logger.Info(ctx, "Half-year summary", "half", half, "year", yearStr)
+
+	year, err := strconv.Atoi(strings.TrimSuffix(yearStr, "年"))
+	if err != nil || year < 1 {
+		logger.Warn(ctx, "Half-year summary format error", "year", yearStr)
+		return "⚠️ 結算格式錯誤，請使用：結算 上半年 2025 或 結算 下半年 2025"
+	}
+
+	startMonth := time.January
+	if half == "下半年" {
+		startMonth = time.July
+	}
+	start := time.Date(year, startMonth, 1, 0, 0, 0, 0, config.Location())
+	end := start.AddDate(0, 6, 0)
+
+	summary, err := model.GetSummaryByRange(ctx, userID, start, end)
+	if err != nil {
+		logger.Error(ctx, "Failed to get half-year summary", "error", err.Error())
+		return "取得報表失敗，請稍後再試。"
+	}
+
+	result := fmt.Sprintf("📊 %d年 %s\n收入：$%s\n支出：$%s\n\n📅 每月明細：\n",
+		year, half, model.FormatAmount(summary.IncomeTotal), model.FormatAmount(summary.ExpenseTotal))
+
+	for month := start; month.Before(end); month = month.AddDate(0, 1, 0) {
+		monthSummary, err := model.GetMonthlySummary(ctx, userID, month)
+		if err != nil {
+			logger.Error(ctx, "Failed to get monthly summary", "month", month.Month(), "error", err.Error())
+			return "取得報表失敗，請稍後再試。"
 		}
+		result += fmt.Sprintf("・%d月：收入 $%s／支出 $%s\n",
+			month.Month(), model.FormatAmount(monthSummary.IncomeTotal), model.FormatAmount(monthSummary.ExpenseTotal))
 	}
 
+	result += fmt.Sprintf("\n💰 淨收益：$%s", model.FormatAmount(summary.IncomeTotal-summary.ExpenseTotal))
+
+	logger.Info(ctx, "Half-year summary completed",
+		"year", year,
+		"half", half,
+		"income", summary.IncomeTotal,
+		"expense", summary.ExpenseTotal)
+	return result
+}
+
+// handleCopyTransaction handles the command to duplicate a transaction with the current time
+func handleCopyTransaction(ctx context.Context, userID, idStr string) string {
+	ctx, span := logger.StartSpan(ctx, "handleCopyTransaction")
+	defer span.End()
+
+	logger.Info(ctx, "Copy transaction", "id", idStr)
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logger.Warn(ctx, "Transaction ID format error", "id", idStr)
+		return "編號格式錯誤，請輸入數字。"
+	}
+
+	// Copied in one statement so an overridden type carries over instead of failing the type check
+	copied, err := model.CopyTransaction(ctx, userID, id, Clock.Now())
+	if errors.Is(err, model.ErrTransactionNotFound) {
+		return "❌ 找不到符合條件的紀錄。"
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to copy transaction", "error", err.Error())
+		return "❌ 複製失敗，請稍後再試。"
+	}
+
+	logger.RecordTransaction(ctx, copied.Type)
+	logger.Info(ctx, "Transaction copied successfully", "original_id", id, "new_id", copied.ID)
+	return fmt.Sprintf("📄 已複製編號 %d 的紀錄 %s，新編號：%d", id, formatMoney(copied.Amount, copied.Currency), copied.ID)
+}
+
+// handleShowAttachment handles the command to view a transaction's attachment reference
+func handleShowAttachment(ctx context.Context, userID, idStr string) string {
+	ctx, span := logger.StartSpan(ctx, "handleShowAttachment")
+	defer span.End()
+
+	logger.Info(ctx, "Show attachment", "id", idStr)
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logger.Warn(ctx, "Transaction ID format error", "id", idStr)
+		return "編號格式錯誤，請輸入數字。"
+	}
+
+	attachment, err := model.GetTransactionAttachment(ctx, userID, id)
+	if errors.Is(err, model.ErrTransactionNotFound) {
+		return "❌ 找不到符合條件的紀錄。"
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to get attachment", "error", err.Error())
+		return "❌ 查詢附件失敗，請稍後再試。"
+	}
+
+	if attachment == "" {
+		return fmt.Sprintf("📎 編號 %d 沒有附件。", id)
+	}
+	return fmt.Sprintf("📎 編號 %d 的附件：%s", id, attachment)
+}
+
+// handleStatus handles the command for a compact snapshot of this month and today
+func handleStatus(ctx context.Context, userID string) string {
+	ctx, span := logger.StartSpan(ctx, "handleStatus")
+	defer span.End()
+
+	logger.Info(ctx, "Status snapshot")
+
+	now := localNow()
+	monthSummary, err := model.GetMonthlySummary(ctx, userID, now)
+	if err != nil {
+		logger.Error(ctx, "Failed to get monthly summary", "error", err.Error())
+		return "取得狀態失敗，請稍後再試。"
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	todaySummary, err := model.GetSummaryByRange(ctx, userID, today, today.AddDate(0, 0, 1))
+	if err != nil {
+		logger.Error(ctx, "Failed to get today's summary", "error", err.Error())
+		return "取得狀態失敗，請稍後再試。"
+	}
+
+	budget, err := model.GetMonthlyBudget(ctx, userID)
+	if err != nil {
+		logger.Error(ctx, "Failed to get monthly budget", "error", err.Error())
+		return "取得狀態失敗，請稍後再試。"
+	}
+
+	usages, err := model.GetBudgetUsages(ctx, userID, now)
+	if err != nil {
+		logger.Error(ctx, "Failed to get budget usages", "error", err.Error())
+		return "取得狀態失敗，請稍後再試。"
+	}
+
+	net := monthSummary.IncomeTotal - monthSummary.ExpenseTotal
+	response := fmt.Sprintf("📌 本月淨收益：$%s\n💸 今日支出：$%s", model.FormatAmount(net), model.FormatAmount(todaySummary.ExpenseTotal))
+
+	// Budget lines are left out entirely for users who never set one
+	if budget > 0 {
+		response += "\n💰 總預算" + budgetRemaining(budget, monthSummary.ExpenseTotal)
+	}
+	for _, u := range usages {
+		response += fmt.Sprintf("\n・%s預算%s", u.Category, budgetRemaining(u.Amount, u.Spent))
+	}
+
+	logger.Info(ctx, "Status snapshot completed",
+		"month_net", net,
+		"today_expense", todaySummary.ExpenseTotal,
+		"monthly_budget", budget,
+		"category_budgets", len(usages))
+	return response
+}
+
+// budgetRemaining describes what is left of a budget, or by how much it is exceeded
+func budgetRemaining(budget, spent int) string {
+	if spent > budget {
+		return "已超出 $" + model.FormatAmount(spent-budget)
+	}
+	return "剩餘 $" + model.FormatAmount(budget-spent)
+}
+
+// parseYearMonth parses a year and month such as "2025年" and "5月", with or without the suffixes
+func parseYearMonth(yearStr, monthStr string) (int, time.Month, error) {
+	yearStr = strings.TrimSuffix(strings.TrimSpace(yearStr), "年")
+	monthStr = strings.TrimSuffix(strings.TrimSpace(monthStr), "月")
+
+	year, err := strconv.Atoi(yearStr)
+	if err != nil || year < 1 || year > 9999 {
+		return 0, 0, fmt.Errorf("invalid year %q", yearStr)
+	}
+
+	month, err := strconv.Atoi(monthStr)
+	if err != nil || month < 1 || month > 12 {
+		return 0, 0, fmt.Errorf("invalid month %q", monthStr)
+	}
+
+	return year, time.Month(month), nil
+}
+
+// renderSummary renders the totals and per-category breakdown of a summary
+func renderSummary(title string, summary model.Summary) string {
+	// Create basic report header
+	result := fmt.Sprintf("📊 %s\n收入：$%s\n支出：$%s\n\n",
+		title, model.FormatAmount(summary.IncomeTotal), model.FormatAmount(summary.ExpenseTotal))
+
+	incomeCategories := summary.IncomeCategoryTotals
+	expenseCategories := summary.ExpenseCategoryTotals
+
 	// Add income section
 	if len(incomeCategories) > 0 {
 		result += "💰 收入明細：\n"
-		for cat, amt := range incomeCategories {
-			result += fmt.Sprintf("・%s：$%d\n", cat, amt)
+		for _, ct := range sortCategoryTotals(incomeCategories) {
+			result += fmt.Sprintf("・%s：$%s\n", ct.Name, model.FormatAmount(ct.Amount))
 		}
 		result += "\n"
 	}
@@ -386,23 +1248,82 @@ func handleMonthlySummary(ctx context.Context, userID string, tokens []string) s
 	// Add expense section
 	if len(expenseCategories) > 0 {
 		result += "💸 支出明細：\n"
-		for cat, amt := range expenseCategories {
-			result += fmt.Sprintf("・%s：$%d\n", cat, amt)
+		for _, ct := range sortCategoryTotals(expenseCategories) {
+			result += fmt.Sprintf("・%s：$%s\n", ct.Name, model.FormatAmount(ct.Amount))
 		}
 		result += "\n"
 	}
 
 	// Add net income
-	result += fmt.Sprintf("💰 淨收益：$%d", summary.IncomeTotal-summary.ExpenseTotal)
+	result += fmt.Sprintf("💰 淨收益：$%s", model.FormatAmount(summary.IncomeTotal-summary.ExpenseTotal))
 
-	logger.Info(ctx, "Summary completed",
-		"month_spec", monthSpec,
-		"income", summary.IncomeTotal,
-		"expense", summary.ExpenseTotal,
-		"income_categories", len(incomeCategories),
-		"expense_categories", len(expenseCategories))
+	return result + renderForeignTotals(summary)
+}
 
-	return result
+// renderTypeSummary renders a summary limited to one transaction type. Only that type's
+// section is shown and the net-income line is left out, since the other side of the
+// ledger is not part of the report.
+func renderTypeSummary(title string, summary model.Summary, transType string) string {
+	total, categories, heading := summary.ExpenseTotal, summary.ExpenseCategoryTotals, "💸 支出明細："
+	if transType == "收入" {
+		total, categories, heading = summary.IncomeTotal, summary.IncomeCategoryTotals, "💰 收入明細："
+	}
+
+	result := fmt.Sprintf("📊 %s（僅%s）\n%s：$%s", title, transType, transType, model.FormatAmount(total))
+	if len(categories) > 0 {
+		result += "\n\n" + heading
+		for _, ct := range sortCategoryTotals(categories) {
+			result += fmt.Sprintf("\n・%s：$%s", ct.Name, model.FormatAmount(ct.Amount))
+		}
+	}
+	return result + renderForeignTotals(summary)
+}
+
+// categoryTotal is a category name with its total amount
+type categoryTotal struct {
+	Name   string
+	Amount int
+}
+
+// sortCategoryTotals orders category totals by amount descending, then by name
+func sortCategoryTotals(totals map[string]int) []categoryTotal {
+	sorted := make([]categoryTotal, 0, len(totals))
+	for name, amount := range totals {
+		sorted = append(sorted, categoryTotal{Name: name, Amount: amount})
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Amount != sorted[j].Amount {
+			return sorted[i].Amount > sorted[j].Amount
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// renderTransactionDetails renders one line per transaction, in time order
+// or by amount descending
+func renderTransactionDetails(details []model.TransactionDetail, sortByAmount bool) string {
+	if len(details) == 0 {
+		return "🧾 交易明細：無"
+	}
+
+	if sortByAmount {
+		sort.SliceStable(details, func(i, j int) bool {
+			return details[i].Amount > details[j].Amount
+		})
+	}
+
+	result := "🧾 交易明細：\n"
+	for _, d := range details {
+		createdAt := d.CreatedAt.In(config.Location())
+		line := fmt.Sprintf("・%d/%d %s %s %s", createdAt.Month(), createdAt.Day(), d.Type, d.Category, formatMoney(d.Amount, d.Currency))
+		if d.Note != "" {
+			line += " " + d.Note
+		}
+		result += line + "\n"
+	}
+	return strings.TrimSuffix(result, "\n")
 }
 
 // getHelpText returns the help text for commands
@@ -412,19 +1333,78 @@ func getHelpText(ctx context.Context) string {
 
 	logger.Info(ctx, "Show help text")
 
-	return `📖 指令大全：
+	return `📖 指令大全（也可輸入 help、幫助 或 ?）：
 
 📂 類別管理
 - 新增類別 支出/收入 類別名稱
 - 修改類別 舊名稱 新名稱
-- 刪除類別 名稱
+- 刪除類別 名稱 [確認]（有紀錄的類別需加上 確認，紀錄會一併刪除）
+- 合併類別 來源名稱 目標名稱（移動紀錄與訂閱並刪除來源類別）
+- 變更類型 類別名稱 收入/支出（類別與既有紀錄一併改為收入或支出）
 - 已設定類別（查看目前所有可用類別）
+- 初始化（建立預設類別：薪資、獎金、餐費、交通、娛樂、日用品）
 
 📝 記帳與查詢
-- 類別名稱 金額（快速記帳）
+- 類別名稱 金額 [備註]（快速記帳，金額可到小數兩位）
+- 類別名稱 金額 USD [備註]（以其他幣別記帳）
+- 一次輸入多行「類別名稱 金額」（批次記帳）
+- 支出/收入 類別名稱 金額 [備註]（指定類型記帳）
+- 記帳 2025-05-03 類別名稱 金額 [備註]（補記過去日期）
+- 訂閱 房租 15000 每月1號 [備註]（每月固定自動記帳）
+- 訂閱（查看訂閱列表）／取消訂閱 編號 3
+- 記帳後 10 分鐘內傳送照片（附加收據）
+- 附件 編號 42（查看附件）
+- 複製 編號 42（以現在時間複製一筆紀錄）
 - 修改 類別名稱 原金額 新金額
+- 修改 編號 42 新金額
+- 修改類型 編號 42 收入/支出（只改這筆紀錄的類型，例如退款）
 - 刪除 類別名稱 金額
+- 刪除 編號 42
+- 撤銷（刪除最後一筆紀錄）
+- 還原 / 還原 編號 42（復原 24 小時內刪除的紀錄）
 
 📊 月結報表
-- 結算 2025年 5月 (指定年月)`
+- 結算 2025年 5月 (指定年月)
+- 結算 2025年 5月 明細 [排序金額]（含交易明細）
+- 結算 [2025年 5月] 排除 投資（排除指定類別）
+- 結算 [2025年 5月] 支出 / 收入（只看支出或收入）
+- 結算 [2025年 5月] 含封存（包含已封存的紀錄）
+- 結算 上半年 2025 / 結算 下半年 2025（半年報表）
+- 結算 2025-05-01 2025-05-15（指定日期區間）
+- 年結 / 年結 2025年（年度報表，含已封存紀錄）
+- 日結 / 日結 2025-05-03（今天或指定日期報表）
+- 週結 / 週結 上週（本週或上週報表）
+- 狀態（本月淨收益、今日支出與預算剩餘）
+- 連續無消費 [全部]（最長連續無支出天數）
+- 查詢 餐費（類別本月合計與最近紀錄）
+- 搜尋 便當（依備註搜尋所有紀錄）
+- 大額 1000（本月 1000 元以上的紀錄）
+- 缺備註（本月沒有備註的紀錄）
+- 金額 100 [500] [餐費]（金額介於區間的紀錄，可指定類別）
+- 平均 / 平均 餐費（每個記帳日與每月的平均支出）
+- 排行 [5]（本月支出最多的類別與占比）
+- 比較（本月與上月的收支與各類別變化）
+- 匯出 [2025年 5月]（以 CSV 匯出當月紀錄）
+- 我的統計 [全部]（最常使用的指令）
+- 設定保留 24個月（自動封存較舊的紀錄，0 表示不封存）
+- 重新計算（依類別重新核對每筆紀錄的收支類型）
+- 清空 確認（刪除所有記帳紀錄與類別，無法還原）
+
+💰 預算
+- 設定預算 類別名稱 金額（類別每月預算）
+- 查看預算（本月預算使用率）
+- 預算風險（依使用率排序，🟢<70% 🟡<100% 🔴超支）
+- 未設預算（列出尚未設定預算的支出類別）
+- 預測（依目前花費速度預估月底支出）
+- 設定總預算 金額（每月總支出上限）
+
+⚡ 快捷
+- 設定快捷 午=午餐 150
+- 快捷列表
+- 刪除快捷 名稱`
+}
+
+// isFailureReply reports whether a reply tells the user that a command failed
+func isFailureReply(reply string) bool {
+	return strings.HasPrefix(reply, "❌") || strings.Contains(reply, "請稍後再試")
 }
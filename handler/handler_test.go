@@ -1,26 +1,41 @@
 package handler
 
 import (
+	"accountingbot/clock"
+	"accountingbot/config"
 	"accountingbot/db"
 	"accountingbot/logger"
+	"accountingbot/model"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 )
 
-func TestHandleMessageDirectly(t *testing.T) {
+func TestMain(m *testing.M) {
 	ctx := context.Background()
 
 	shutdown := logger.Init()
-	defer func() {
+	testDBName := db.SetupTestDB(ctx)
+
+	code := m.Run()
+
+	db.CleanupTestDB(ctx, testDBName)
+	if shutdown != nil {
 		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 		defer cancel()
 		_ = shutdown(ctx)
-	}()
+	}
+	os.Exit(code)
+}
 
-	testDBName := db.SetupTestDB(ctx)
-	defer db.CleanupTestDB(ctx, testDBName)
+func TestHandleMessageDirectly(t *testing.T) {
+	ctx := context.Background()
 
 	commands := []struct {
 		name     string
@@ -50,11 +65,31 @@ func TestHandleMessageDirectly(t *testing.T) {
 			input:    "新增類別 支出 午餐",
 			contains: "✅ 類別 午餐 已新增！",
 		},
+		{
+			name:     "新增類別類型錯誤",
+			input:    "新增類別 foo 午餐",
+			contains: "❌ 類別類型只能是 收入 或 支出",
+		},
 		{
 			name:     "新增支出類別",
 			input:    "新增類別 支出 餐費",
 			contains: "✅ 類別 餐費 已新增！",
 		},
+		{
+			name:     "新增類別名稱含空白",
+			input:    "新增類別 支出 外 食",
+			contains: "❌ 類別名稱不能包含空白",
+		},
+		{
+			name:     "新增類別名稱過長",
+			input:    "新增類別 支出 " + strings.Repeat("長", 21),
+			contains: "❌ 類別名稱最多 20 個字。",
+		},
+		{
+			name:     "新增類別名稱空白",
+			input:    "新增類別 支出",
+			contains: "❌ 請輸入類別名稱",
+		},
 		{
 			name:     "新增已存在類別",
 			input:    "新增類別 收入 獎金",
@@ -135,6 +170,35 @@ func TestHandleMessageDirectly(t *testing.T) {
 			contains: "⚠️ 結算格式錯誤，請使用：結算 或 結算 2025年 5月",
 		},
 
+		// Explicit type transaction tests
+		{
+			name:     "指定類型記帳-支出",
+			input:    "支出 午餐 100",
+			contains: "✅ 支出 $100 類別：午餐 已記錄！",
+		},
+		{
+			name:     "指定類型記帳-收入",
+			input:    "收入 獎金 300",
+			contains: "✅ 收入 $300 類別：獎金 已記錄！",
+		},
+		{
+			name:     "指定類型記帳-類型不符",
+			input:    "收入 午餐 100",
+			contains: "❌ 類別 午餐 不是收入類別。",
+		},
+
+		// Transaction note tests
+		{
+			name:     "快速記帳-含備註",
+			input:    "午餐 80 公司 樓下 便當",
+			contains: "📝 備註：公司 樓下 便當",
+		},
+		{
+			name:     "指定類型記帳-含備註",
+			input:    "支出 午餐 90 便當店",
+			contains: "✅ 支出 $90 類別：午餐 已記錄！\n📝 備註：便當店",
+		},
+
 		// documentation test
 		{
 			name:     "取得說明",
@@ -147,7 +211,7 @@ func TestHandleMessageDirectly(t *testing.T) {
 
 	for _, cmd := range commands {
 		t.Run(cmd.name, func(t *testing.T) {
-			response := HandleMessage(ctx, userID, cmd.input)
+			response := HandleMessage(ctx, userID, cmd.input).Text
 
 			if !strings.Contains(response, cmd.contains) {
 				t.Errorf("Response %q does not contain expected %q", response, cmd.contains)
@@ -155,3 +219,2253 @@ func TestHandleMessageDirectly(t *testing.T) {
 		})
 	}
 }
+
+func TestStatus(t *testing.T) {
+	ctx := context.Background()
+	userID := "status_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 午餐")
+	HandleMessage(ctx, userID, "新增類別 收入 薪水")
+	HandleMessage(ctx, userID, "午餐 150")
+	HandleMessage(ctx, userID, "薪水 5000")
+
+	response := HandleMessage(ctx, userID, "狀態").Text
+
+	for _, expected := range []string{"本月淨收益：$4850", "今日支出：$150"} {
+		if !strings.Contains(response, expected) {
+			t.Errorf("Response %q does not contain expected %q", response, expected)
+		}
+	}
+	if strings.Contains(response, "預算") {
+		t.Errorf("Response %q mentions a budget before any is set", response)
+	}
+
+	HandleMessage(ctx, userID, "新增類別 支出 交通")
+	HandleMessage(ctx, userID, "交通 300")
+	HandleMessage(ctx, userID, "設定總預算 1000")
+	HandleMessage(ctx, userID, "設定預算 午餐 100")
+	HandleMessage(ctx, userID, "設定預算 交通 500")
+
+	response = HandleMessage(ctx, userID, "狀態").Text
+
+	for _, expected := range []string{"總預算剩餘 $550", "午餐預算已超出 $50", "交通預算剩餘 $200"} {
+		if !strings.Contains(response, expected) {
+			t.Errorf("Response %q does not contain expected %q", response, expected)
+		}
+	}
+}
+
+func TestMonthlyBudget(t *testing.T) {
+	ctx := context.Background()
+	userID := "monthly_budget_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 午餐")
+
+	steps := []struct {
+		name        string
+		input       string
+		contains    string
+		notContains string
+	}{
+		{
+			name:     "設定總預算",
+			input:    "設定總預算 1000",
+			contains: "✅ 本月總預算已設定為 $1000",
+		},
+		{
+			name:     "總預算格式錯誤",
+			input:    "設定總預算 abc",
+			contains: "預算金額格式錯誤",
+		},
+		{
+			name:        "未超出總預算",
+			input:       "午餐 600",
+			notContains: "總預算",
+		},
+		{
+			name:     "超出總預算",
+			input:    "午餐 500",
+			contains: "⚠️ 本月總支出 $1100 已超出總預算 $1000",
+		},
+		{
+			name:        "已超出後不再重複提醒",
+			input:       "午餐 100",
+			notContains: "總預算",
+		},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			response := HandleMessage(ctx, userID, step.input).Text
+
+			if step.contains != "" && !strings.Contains(response, step.contains) {
+				t.Errorf("Response %q does not contain expected %q", response, step.contains)
+			}
+			if step.notContains != "" && strings.Contains(response, step.notContains) {
+				t.Errorf("Response %q should not contain %q", response, step.notContains)
+			}
+		})
+	}
+}
+
+func TestHalfYearSummary(t *testing.T) {
+	ctx := context.Background()
+	userID := "half_year_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 午餐")
+	HandleMessage(ctx, userID, "午餐 150")
+
+	now := localNow()
+	currentHalf, otherHalf := "上半年", "下半年"
+	if now.Month() > time.June {
+		currentHalf, otherHalf = otherHalf, currentHalf
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		contains []string
+	}{
+		{
+			name:  "本期半年",
+			input: fmt.Sprintf("結算 %s %d", currentHalf, now.Year()),
+			contains: []string{
+				fmt.Sprintf("📊 %d年 %s", now.Year(), currentHalf),
+				"支出：$150",
+				fmt.Sprintf("・%d月：收入 $0／支出 $150", now.Month()),
+				"💰 淨收益：$-150",
+			},
+		},
+		{
+			name:     "另一個半年",
+			input:    fmt.Sprintf("結算 %s %d年", otherHalf, now.Year()),
+			contains: []string{"支出：$0", "💰 淨收益：$0"},
+		},
+		{
+			name:     "年份格式錯誤",
+			input:    "結算 上半年 abc",
+			contains: []string{"⚠️ 結算格式錯誤"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := HandleMessage(ctx, userID, tt.input).Text
+
+			for _, expected := range tt.contains {
+				if !strings.Contains(response, expected) {
+					t.Errorf("Response %q does not contain expected %q", response, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestSummaryDetailSortedByAmount(t *testing.T) {
+	ctx := context.Background()
+	userID := "summary_detail_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 午餐")
+	HandleMessage(ctx, userID, "新增類別 支出 交通")
+	HandleMessage(ctx, userID, "午餐 50")
+	HandleMessage(ctx, userID, "交通 300")
+	HandleMessage(ctx, userID, "午餐 120 便當")
+
+	now := localNow()
+	response := HandleMessage(ctx, userID, fmt.Sprintf("結算 %d年 %d月 明細 排序金額", now.Year(), now.Month())).Text
+
+	if !strings.Contains(response, "🧾 交易明細") {
+		t.Fatalf("Response %q does not contain transaction details", response)
+	}
+
+	expectedOrder := []string{"交通 $300", "午餐 $120 便當", "午餐 $50"}
+	last := -1
+	for _, line := range expectedOrder {
+		idx := strings.Index(response, line)
+		if idx == -1 {
+			t.Fatalf("Response %q does not contain %q", response, line)
+		}
+		if idx < last {
+			t.Errorf("Expected %q to appear after the previous detail line in %q", line, response)
+		}
+		last = idx
+	}
+}
+
+func TestBackdatedTransaction(t *testing.T) {
+	ctx := context.Background()
+	userID := "backdated_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 午餐")
+
+	today := localNow()
+	tomorrow := today.AddDate(0, 0, 1)
+
+	tests := []struct {
+		name     string
+		input    string
+		contains string
+	}{
+		{
+			name:     "補記過去日期",
+			input:    "記帳 2025-05-03 午餐 150",
+			contains: "📅 日期：2025-05-03",
+		},
+		{
+			name:     "補記月底含備註",
+			input:    "記帳 2025-05-31 午餐 50 聚餐",
+			contains: "📝 備註：聚餐",
+		},
+		{
+			name:     "不存在的日期",
+			input:    "記帳 2025-02-30 午餐 150",
+			contains: "⚠️ 日期格式錯誤",
+		},
+		{
+			name:     "日期格式錯誤",
+			input:    "記帳 2025/05/03 午餐 150",
+			contains: "⚠️ 日期格式錯誤",
+		},
+		{
+			name:     "補記今天",
+			input:    "記帳 " + today.Format("2006-01-02") + " 午餐 10",
+			contains: "✅ 支出 $10 類別：午餐 已記錄！",
+		},
+		{
+			name:     "未來日期",
+			input:    "記帳 " + tomorrow.Format("2006-01-02") + " 午餐 150",
+			contains: "⚠️ 不能記錄未來日期的帳目",
+		},
+		{
+			name:     "補記歸入正確月份",
+			input:    "結算 2025年 5月",
+			contains: "支出：$200",
+		},
+		{
+			name:     "下個月不含補記",
+			input:    "結算 2025年 6月",
+			contains: "支出：$0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := HandleMessage(ctx, userID, tt.input).Text
+
+			if !strings.Contains(response, tt.contains) {
+				t.Errorf("Response %q does not contain expected %q", response, tt.contains)
+			}
+		})
+	}
+}
+
+func TestImageAttachment(t *testing.T) {
+	ctx := context.Background()
+	userID := "image_user"
+
+	if response := HandleImage(ctx, userID, "100"); !strings.Contains(response, "找不到最近的記帳紀錄") {
+		t.Errorf("Unexpected response without transactions: %q", response)
+	}
+
+	HandleMessage(ctx, userID, "新增類別 支出 午餐")
+	HandleMessage(ctx, userID, "午餐 150")
+
+	response := HandleImage(ctx, userID, "12345")
+	if !strings.Contains(response, "📎 已將圖片附加到 午餐 $150") {
+		t.Fatalf("Unexpected attach response: %q", response)
+	}
+
+	var id int
+	if _, err := fmt.Sscanf(response[strings.Index(response, "編號"):], "編號 %d", &id); err != nil {
+		t.Fatalf("Failed to parse transaction ID from %q: %v", response, err)
+	}
+
+	response = HandleMessage(ctx, userID, fmt.Sprintf("附件 編號 %d", id)).Text
+	if !strings.Contains(response, "line:12345") {
+		t.Errorf("Response %q does not contain the attachment reference", response)
+	}
+}
+
+func TestCopyTransaction(t *testing.T) {
+	ctx := context.Background()
+	userID := "copy_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 咖啡")
+	HandleMessage(ctx, userID, "咖啡 60 拿鐵")
+
+	transactions, err := model.GetTransactions(ctx, userID, 1)
+	if err != nil || len(transactions) != 1 {
+		t.Fatalf("Failed to get recorded transaction: %v", err)
+	}
+	original := transactions[0]
+
+	response := HandleMessage(ctx, userID, fmt.Sprintf("複製 編號 %d", original.ID)).Text
+	if !strings.Contains(response, "📄 已複製編號") {
+		t.Fatalf("Unexpected copy response: %q", response)
+	}
+
+	if response := HandleMessage(ctx, "someone_else", fmt.Sprintf("複製 編號 %d", original.ID)).Text; !strings.Contains(response, "❌ 找不到符合條件的紀錄。") {
+		t.Errorf("Expected ownership check to fail, got %q", response)
+	}
+
+	// Deleting the original must leave the copy untouched
+	if err := model.DeleteTransaction(ctx, original.ID); err != nil {
+		t.Fatalf("DeleteTransaction failed: %v", err)
+	}
+
+	transactions, err = model.GetTransactions(ctx, userID, 10)
+	if err != nil {
+		t.Fatalf("GetTransactions failed: %v", err)
+	}
+	if len(transactions) != 1 {
+		t.Fatalf("Expected 1 remaining transaction, got %d", len(transactions))
+	}
+
+	copied := transactions[0]
+	if copied.ID == original.ID || copied.Amount != 6000 || copied.Note != "拿鐵" || copied.CategoryID != original.CategoryID {
+		t.Errorf("Unexpected copied transaction: %+v", copied)
+	}
+
+	// A record whose type was overridden copies with the override intact
+	HandleMessage(ctx, userID, fmt.Sprintf("修改類型 編號 %d 收入", copied.ID))
+	response = HandleMessage(ctx, userID, fmt.Sprintf("複製 編號 %d", copied.ID)).Text
+	if !strings.Contains(response, "📄 已複製編號") {
+		t.Fatalf("Unexpected copy response for an overridden record: %q", response)
+	}
+	if _, err := model.ReconcileTransactionTypes(ctx, userID); err != nil {
+		t.Fatalf("ReconcileTransactionTypes failed: %v", err)
+	}
+	transactions, err = model.GetTransactions(ctx, userID, 10)
+	if err != nil {
+		t.Fatalf("GetTransactions failed: %v", err)
+	}
+	if len(transactions) != 2 || transactions[0].Type != "收入" || transactions[1].Type != "收入" {
+		t.Errorf("Expected both records to keep the overridden type, got %+v", transactions)
+	}
+}
+
+func TestSummaryCategoryOrder(t *testing.T) {
+	ctx := context.Background()
+	userID := "summary_order_user"
+
+	for _, name := range []string{"午餐", "交通", "娛樂", "日用品"} {
+		HandleMessage(ctx, userID, "新增類別 支出 "+name)
+	}
+	HandleMessage(ctx, userID, "午餐 200")
+	HandleMessage(ctx, userID, "交通 500")
+	HandleMessage(ctx, userID, "娛樂 200")
+	HandleMessage(ctx, userID, "日用品 80")
+
+	expectedOrder := []string{"・交通：$500", "・午餐：$200", "・娛樂：$200", "・日用品：$80"}
+
+	// Repeat to make sure the order does not depend on map iteration
+	for range 5 {
+		response := HandleMessage(ctx, userID, "結算").Text
+
+		last := -1
+		for _, line := range expectedOrder {
+			idx := strings.Index(response, line)
+			if idx == -1 {
+				t.Fatalf("Response %q does not contain %q", response, line)
+			}
+			if idx < last {
+				t.Fatalf("Expected %q to appear after the previous category in %q", line, response)
+			}
+			last = idx
+		}
+	}
+}
+
+func TestMacros(t *testing.T) {
+	ctx := context.Background()
+	userID := "macro_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 午餐")
+
+	tests := []struct {
+		name     string
+		input    string
+		contains string
+	}{
+		{
+			name:     "設定快捷",
+			input:    "設定快捷 午=午餐 150",
+			contains: "✅ 已設定快捷：午 → 午餐 150",
+		},
+		{
+			name:     "使用快捷",
+			input:    "午",
+			contains: "✅ 支出 $150 類別：午餐 已記錄！",
+		},
+		{
+			name:     "快捷加上備註",
+			input:    "午 便當",
+			contains: "📝 備註：便當",
+		},
+		{
+			name:     "巢狀快捷",
+			input:    "設定快捷 中午=午",
+			contains: "✅ 已設定快捷",
+		},
+		{
+			name:     "使用巢狀快捷",
+			input:    "中午",
+			contains: "✅ 支出 $150 類別：午餐 已記錄！",
+		},
+		{
+			name:     "自我循環",
+			input:    "設定快捷 循環=循環 100",
+			contains: "❌ 快捷 循環 會形成循環",
+		},
+		{
+			name:     "互相循環",
+			input:    "設定快捷 午=中午",
+			contains: "❌ 快捷 午 會形成循環",
+		},
+		{
+			name:     "快捷格式錯誤",
+			input:    "設定快捷 午餐150",
+			contains: "⚠️ 格式錯誤",
+		},
+		{
+			name:     "快捷名稱為指令",
+			input:    "設定快捷 結算=午餐 150",
+			contains: "❌ 快捷名稱不能與指令相同",
+		},
+		{
+			name:     "快捷名稱為說明別名",
+			input:    "設定快捷 Help=結算",
+			contains: "❌ 快捷名稱不能與指令相同",
+		},
+		{
+			name:     "指令未被快捷取代",
+			input:    "結算",
+			contains: "支出：$",
+		},
+		{
+			name:     "快捷列表",
+			input:    "快捷列表",
+			contains: "・午 → 午餐 150",
+		},
+		{
+			name:     "刪除快捷",
+			input:    "刪除快捷 中午",
+			contains: "🗑️ 快捷 中午 已刪除",
+		},
+		{
+			name:     "刪除不存在快捷",
+			input:    "刪除快捷 中午",
+			contains: "❌ 快捷不存在。",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := HandleMessage(ctx, userID, tt.input).Text
+
+			if !strings.Contains(response, tt.contains) {
+				t.Errorf("Response %q does not contain expected %q", response, tt.contains)
+			}
+		})
+	}
+}
+
+func TestApplyMacrosStopsOnLoop(t *testing.T) {
+	// Loops cannot be stored through the command, but expansion must still terminate
+	macros := map[string]string{"甲": "乙 1", "乙": "甲 2"}
+
+	tokens := applyMacros(macros, []string{"甲"})
+	if len(tokens) > maxMacroDepth+1 {
+		t.Errorf("Expansion did not stop: %v", tokens)
+	}
+}
+
+func TestWeeklySummary(t *testing.T) {
+	ctx := context.Background()
+	userID := "weekly_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 午餐")
+	HandleMessage(ctx, userID, "午餐 150")
+
+	// The same weekday one week ago always falls in the previous ISO week
+	lastWeek := localNow().AddDate(0, 0, -7).Format("2006-01-02")
+	HandleMessage(ctx, userID, fmt.Sprintf("記帳 %s 午餐 70", lastWeek))
+
+	tests := []struct {
+		name     string
+		input    string
+		contains []string
+	}{
+		{
+			name:     "本週",
+			input:    "週結",
+			contains: []string{"支出：$150", "・午餐：$150"},
+		},
+		{
+			name:     "上週",
+			input:    "週結 上週",
+			contains: []string{"支出：$70", "・午餐：$70"},
+		},
+		{
+			name:     "格式錯誤",
+			input:    "週結 下週",
+			contains: []string{"⚠️ 週結格式錯誤"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := HandleMessage(ctx, userID, tt.input).Text
+
+			for _, expected := range tt.contains {
+				if !strings.Contains(response, expected) {
+					t.Errorf("Response %q does not contain expected %q", response, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestCategoryBudget(t *testing.T) {
+	ctx := context.Background()
+	userID := "category_budget_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+	HandleMessage(ctx, userID, "新增類別 收入 薪水")
+
+	steps := []struct {
+		name        string
+		input       string
+		contains    string
+		notContains string
+	}{
+		{
+			name:     "設定預算",
+			input:    "設定預算 餐費 5000",
+			contains: "✅ 餐費 每月預算已設定為 $5000",
+		},
+		{
+			name:     "收入類別不可設定預算",
+			input:    "設定預算 薪水 5000",
+			contains: "❌ 只能為支出類別設定預算。",
+		},
+		{
+			name:     "類別不存在",
+			input:    "設定預算 不存在 5000",
+			contains: "❌ 類別不存在，請先新增。",
+		},
+		{
+			name:     "預算金額錯誤",
+			input:    "設定預算 餐費 -1",
+			contains: "預算金額格式錯誤",
+		},
+		{
+			name:        "未超出預算",
+			input:       "餐費 4000",
+			notContains: "預算",
+		},
+		{
+			name:     "查看預算",
+			input:    "查看預算",
+			contains: "・餐費：$4000 / $5000（80%）",
+		},
+		{
+			name:     "超出預算",
+			input:    "餐費 1300",
+			contains: "⚠️ 已超出餐費預算 $300",
+		},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			response := HandleMessage(ctx, userID, step.input).Text
+
+			if step.contains != "" && !strings.Contains(response, step.contains) {
+				t.Errorf("Response %q does not contain expected %q", response, step.contains)
+			}
+			if step.notContains != "" && strings.Contains(response, step.notContains) {
+				t.Errorf("Response %q should not contain %q", response, step.notContains)
+			}
+		})
+	}
+}
+
+func TestParseYearMonth(t *testing.T) {
+	tests := []struct {
+		name      string
+		yearStr   string
+		monthStr  string
+		wantYear  int
+		wantMonth time.Month
+		wantErr   bool
+	}{
+		{name: "年月都有", yearStr: "2025年", monthStr: "5月", wantYear: 2025, wantMonth: time.May},
+		{name: "只有年", yearStr: "2025年", monthStr: "5", wantYear: 2025, wantMonth: time.May},
+		{name: "只有月", yearStr: "2025", monthStr: "5月", wantYear: 2025, wantMonth: time.May},
+		{name: "都沒有", yearStr: "2025", monthStr: "12", wantYear: 2025, wantMonth: time.December},
+		{name: "月份超出範圍", yearStr: "2025", monthStr: "13月", wantErr: true},
+		{name: "重複後綴", yearStr: "2025年年", monthStr: "5", wantErr: true},
+		{name: "非數字", yearStr: "今年", monthStr: "5月", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			year, month, err := parseYearMonth(tt.yearStr, tt.monthStr)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error for %q %q, got %d %d", tt.yearStr, tt.monthStr, year, month)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if year != tt.wantYear || month != tt.wantMonth {
+				t.Errorf("Got %d/%d, expected %d/%d", year, month, tt.wantYear, tt.wantMonth)
+			}
+		})
+	}
+}
+
+func TestProjectMonthEnd(t *testing.T) {
+	tests := []struct {
+		name  string
+		spent int
+		now   time.Time
+		want  int
+	}{
+		{name: "月中", spent: 1000, now: time.Date(2025, 4, 10, 12, 0, 0, 0, time.UTC), want: 3000},
+		{name: "月初第一天", spent: 100, now: time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC), want: 3100},
+		{name: "月底", spent: 2800, now: time.Date(2025, 2, 28, 23, 0, 0, 0, time.UTC), want: 2800},
+		{name: "閏年二月", spent: 290, now: time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC), want: 841},
+		{name: "無支出", spent: 0, now: time.Date(2025, 5, 15, 0, 0, 0, 0, time.UTC), want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := projectMonthEnd(tt.spent, tt.now); got != tt.want {
+				t.Errorf("projectMonthEnd(%d, %v) = %d, expected %d", tt.spent, tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRangeSummary(t *testing.T) {
+	ctx := context.Background()
+	userID := "range_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 交通")
+	HandleMessage(ctx, userID, "記帳 2025-05-01 交通 100")
+	HandleMessage(ctx, userID, "記帳 2025-05-15 交通 200")
+	HandleMessage(ctx, userID, "記帳 2025-05-16 交通 400")
+
+	tests := []struct {
+		name     string
+		input    string
+		contains []string
+	}{
+		{
+			name:     "包含頭尾日期",
+			input:    "結算 2025-05-01 2025-05-15",
+			contains: []string{"📊 2025/05/01 - 2025/05/15", "支出：$300", "・交通：$300"},
+		},
+		{
+			name:     "單日",
+			input:    "結算 2025-05-16 2025-05-16",
+			contains: []string{"支出：$400"},
+		},
+		{
+			name:     "開始晚於結束",
+			input:    "結算 2025-05-15 2025-05-01",
+			contains: []string{"⚠️ 開始日期必須早於結束日期。"},
+		},
+		{
+			name:     "日期格式錯誤",
+			input:    "結算 2025-13-01 2025-05-15",
+			contains: []string{"⚠️ 日期格式錯誤"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := HandleMessage(ctx, userID, tt.input).Text
+
+			for _, expected := range tt.contains {
+				if !strings.Contains(response, expected) {
+					t.Errorf("Response %q does not contain expected %q", response, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestBudgetRiskOrder(t *testing.T) {
+	usages := []model.BudgetUsage{
+		{Category: "娛樂", Amount: 1000, Spent: 100},
+		{Category: "餐費", Amount: 5000, Spent: 5500},
+		{Category: "交通", Amount: 2000, Spent: 1400},
+		{Category: "購物", Amount: 1000, Spent: 990},
+	}
+
+	sortBudgetsByRisk(usages)
+
+	expectedOrder := []string{"餐費", "購物", "交通", "娛樂"}
+	expectedIndicators := []string{"🔴", "🟡", "🟡", "🟢"}
+	for i, u := range usages {
+		if u.Category != expectedOrder[i] {
+			t.Errorf("Position %d: got %q, expected %q", i, u.Category, expectedOrder[i])
+		}
+		if got := budgetRiskIndicator(budgetUtilization(u)); got != expectedIndicators[i] {
+			t.Errorf("Indicator for %q: got %s, expected %s", u.Category, got, expectedIndicators[i])
+		}
+	}
+}
+
+func TestBudgetRiskIndicatorThresholds(t *testing.T) {
+	tests := []struct {
+		percent int
+		want    string
+	}{
+		{0, "🟢"},
+		{69, "🟢"},
+		{70, "🟡"},
+		{99, "🟡"},
+		{100, "🔴"},
+		{150, "🔴"},
+	}
+
+	for _, tt := range tests {
+		if got := budgetRiskIndicator(tt.percent); got != tt.want {
+			t.Errorf("budgetRiskIndicator(%d) = %s, expected %s", tt.percent, got, tt.want)
+		}
+	}
+}
+
+func TestRejectNonPositiveAmounts(t *testing.T) {
+	ctx := context.Background()
+	userID := "amount_validation_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+	HandleMessage(ctx, userID, "餐費 100")
+
+	tests := []struct {
+		name     string
+		input    string
+		contains string
+	}{
+		{name: "負數金額", input: "餐費 -50", contains: "金額必須大於 0"},
+		{name: "零元", input: "餐費 0", contains: "金額必須大於 0"},
+		{name: "非數字金額", input: "餐費 abc", contains: "金額格式錯誤"},
+		{name: "修改為負數", input: "修改 餐費 100 -50", contains: "金額必須大於 0"},
+		{name: "修改為零元", input: "修改 餐費 100 0", contains: "金額必須大於 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := HandleMessage(ctx, userID, tt.input).Text
+			if !strings.Contains(response, tt.contains) {
+				t.Errorf("Response %q does not contain expected %q", response, tt.contains)
+			}
+		})
+	}
+
+	// The rejected amounts must not reach the totals
+	response := HandleMessage(ctx, userID, "結算").Text
+	if !strings.Contains(response, "・餐費：$100") {
+		t.Errorf("Rejected amounts changed the summary: %q", response)
+	}
+}
+
+func TestDuplicateAmountTransactions(t *testing.T) {
+	ctx := context.Background()
+	userID := "duplicate_amount_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+	for i := 0; i < 3; i++ {
+		HandleMessage(ctx, userID, "餐費 150")
+	}
+
+	response := HandleMessage(ctx, userID, "刪除 餐費 150").Text
+	if !strings.Contains(response, "⚠️ 找到 3 筆 餐費 $150 的紀錄") {
+		t.Errorf("Expected ambiguous delete to be rejected, got %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "修改 餐費 150 200").Text
+	if !strings.Contains(response, "⚠️ 找到 3 筆 餐費 $150 的紀錄") {
+		t.Errorf("Expected ambiguous update to be rejected, got %q", response)
+	}
+
+	ids, err := model.FindTransactionIDs(ctx, userID, "餐費", 150)
+	if err != nil || len(ids) != 3 {
+		t.Fatalf("Expected 3 matching IDs, got %v (err: %v)", ids, err)
+	}
+
+	response = HandleMessage(ctx, userID, fmt.Sprintf("刪除 編號 %d", ids[0])).Text
+	if !strings.Contains(response, fmt.Sprintf("🗑️ 已刪除編號 %d 的紀錄 $150。", ids[0])) {
+		t.Errorf("Unexpected delete by ID response: %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, fmt.Sprintf("修改 編號 %d 200", ids[1])).Text
+	if !strings.Contains(response, fmt.Sprintf("✅ 已將編號 %d 的金額從 $150 修改為 $200。", ids[1])) {
+		t.Errorf("Unexpected update by ID response: %q", response)
+	}
+
+	// Only one $150 record is left, so the amount-based command works again
+	response = HandleMessage(ctx, userID, "刪除 餐費 150").Text
+	if !strings.Contains(response, "🗑️ 已刪除 餐費 $150 的紀錄。") {
+		t.Errorf("Expected the remaining record to be deleted, got %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, fmt.Sprintf("刪除 編號 %d", ids[0])).Text
+	if !strings.Contains(response, "❌ 找不到符合條件的紀錄。") {
+		t.Errorf("Expected deleted ID to be missing, got %q", response)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	ctx := context.Background()
+	userID := "undo_user"
+
+	response := HandleMessage(ctx, userID, "撤銷").Text
+	if !strings.Contains(response, "⚠️ 目前沒有可撤銷的紀錄。") {
+		t.Errorf("Expected no-transaction message, got %q", response)
+	}
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+	HandleMessage(ctx, userID, "新增類別 支出 交通")
+	HandleMessage(ctx, userID, "餐費 100")
+	HandleMessage(ctx, userID, "交通 150")
+
+	response = HandleMessage(ctx, userID, "撤銷").Text
+	if !strings.Contains(response, "已撤銷 交通 $150") {
+		t.Errorf("Expected the latest record to be undone, got %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "撤銷").Text
+	if !strings.Contains(response, "已撤銷 餐費 $100") {
+		t.Errorf("Expected the earlier record to be undone next, got %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "撤銷").Text
+	if !strings.Contains(response, "⚠️ 目前沒有可撤銷的紀錄。") {
+		t.Errorf("Expected nothing left to undo, got %q", response)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	ctx := context.Background()
+	userID := "restore_user"
+
+	response := HandleMessage(ctx, userID, "還原").Text
+	if !strings.Contains(response, "⚠️ 找不到 24 小時內刪除的紀錄。") {
+		t.Errorf("Expected nothing to restore, got %q", response)
+	}
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+	HandleMessage(ctx, userID, "餐費 120")
+	HandleMessage(ctx, userID, "撤銷")
+
+	response = HandleMessage(ctx, userID, "結算").Text
+	if strings.Contains(response, "120") {
+		t.Errorf("Expected the undone record to be left out of the summary, got %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "還原").Text
+	if !strings.Contains(response, "餐費 $120") {
+		t.Errorf("Expected the undone record to be restored, got %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "結算").Text
+	if !strings.Contains(response, "120") {
+		t.Errorf("Expected the restored record in the summary, got %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "還原 編號 abc").Text
+	if !strings.Contains(response, "編號格式錯誤") {
+		t.Errorf("Expected an ID format error, got %q", response)
+	}
+}
+
+func TestSpendingAverages(t *testing.T) {
+	ctx := context.Background()
+	userID := "averages_handler_user"
+
+	response := HandleMessage(ctx, userID, "平均").Text
+	if !strings.Contains(response, "支出目前沒有紀錄") {
+		t.Errorf("Expected no-data message, got %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "平均 不存在").Text
+	if !strings.Contains(response, "❌ 類別不存在。") {
+		t.Errorf("Expected unknown category message, got %q", response)
+	}
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+	HandleMessage(ctx, userID, "餐費 100")
+	HandleMessage(ctx, userID, "餐費 50")
+
+	response = HandleMessage(ctx, userID, "平均 餐費").Text
+	if !strings.Contains(response, "每個記帳日：$150（1 天）") || !strings.Contains(response, "每月：$150（1 個月）") {
+		t.Errorf("Unexpected single-day averages: %q", response)
+	}
+}
+
+func TestRenderSpendingRanking(t *testing.T) {
+	summary := model.Summary{
+		ExpenseTotal: 100000,
+		ExpenseCategoryTotals: map[string]int{
+			"交通": 15000, "餐費": 50000, "娛樂": 20000, "購物": 15000,
+		},
+	}
+
+	got := renderSpendingRanking(summary, 3)
+	want := "🏆 本月支出排行（共 $1000）：\n" +
+		"🥇 餐費 $500（50%）\n" +
+		"🥈 娛樂 $200（20%）\n" +
+		"🥉 交通 $150（15%）"
+	if got != want {
+		t.Errorf("Unexpected ranking:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Past the medals the rank is numbered
+	if got := renderSpendingRanking(summary, 10); !strings.HasSuffix(got, "4. 購物 $150（15%）") {
+		t.Errorf("Expected the fourth category numbered, got %q", got)
+	}
+
+	if got := renderSpendingRanking(model.Summary{}, 5); got != "🏆 本月還沒有支出紀錄。" {
+		t.Errorf("Expected the empty message, got %q", got)
+	}
+
+	// Shares are rounded, not truncated
+	if share := expenseShare(2, 3); share != 67 {
+		t.Errorf("Expected 2/3 to round to 67%%, got %d%%", share)
+	}
+}
+
+func TestSpendingRanking(t *testing.T) {
+	ctx := context.Background()
+	userID := "ranking_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+	HandleMessage(ctx, userID, "新增類別 支出 交通")
+	HandleMessage(ctx, userID, "餐費 300")
+	HandleMessage(ctx, userID, "交通 100")
+
+	response := HandleMessage(ctx, userID, "排行 1").Text
+	if !strings.Contains(response, "🥇 餐費 $300（75%）") || strings.Contains(response, "交通") {
+		t.Errorf("Expected only the top category, got %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "排行 0").Text
+	if !strings.Contains(response, "⚠️ 名次必須大於 0") {
+		t.Errorf("Expected an invalid size message, got %q", response)
+	}
+}
+
+func TestMonthComparison(t *testing.T) {
+	ctx := context.Background()
+	userID := "comparison_user"
+
+	now := localNow()
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 12, 0, 0, 0, now.Location())
+	lastMonth := thisMonth.AddDate(0, -1, 0)
+	record := func(day time.Time, category string, amount int) {
+		HandleMessage(ctx, userID, fmt.Sprintf("記帳 %s %s %d", day.Format("2006-01-02"), category, amount))
+	}
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+	HandleMessage(ctx, userID, "新增類別 支出 交通")
+	HandleMessage(ctx, userID, "新增類別 支出 娛樂")
+	HandleMessage(ctx, userID, "新增類別 收入 薪水")
+
+	record(lastMonth, "薪水", 1000)
+	record(lastMonth, "餐費", 200)
+	record(lastMonth, "交通", 100)
+	record(thisMonth, "薪水", 1000)
+	record(thisMonth, "餐費", 300)
+	record(thisMonth, "娛樂", 50)
+
+	response := HandleMessage(ctx, userID, "比較").Text
+	for _, want := range []string{
+		fmt.Sprintf("📊 %d月與%d月比較", thisMonth.Month(), lastMonth.Month()),
+		"收入：$1000（持平）",
+		"支出：$350（↑ $50，+17%）",
+		"淨收益：$650（↓ $50，-7%）",
+		"・餐費：$300（↑ $100，+50%）",
+		// Only this month
+		"・娛樂：$50（↑ $50）",
+		// Only last month
+		"・交通：$0（↓ $100，-100%）",
+	} {
+		if !strings.Contains(response, want) {
+			t.Errorf("Expected %q in comparison, got %q", want, response)
+		}
+	}
+}
+
+func TestNormalizeCategoryName(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		err   error
+	}{
+		{input: "  餐費 ", want: "餐費"},
+		{input: "🍜拉麵", want: "🍜拉麵"},
+		{input: strings.Repeat("長", 20), want: strings.Repeat("長", 20)},
+		{input: "", err: errEmptyCategoryName},
+		{input: " \u3000 ", err: errEmptyCategoryName},
+		{input: "外 食", err: errCategoryNameSpace},
+		{input: "外\u3000食", err: errCategoryNameSpace},
+		{input: strings.Repeat("長", 21), err: errCategoryNameTooLong},
+		{input: "餐\u200b費", err: errCategoryNameInvisible},
+		{input: "修改", err: errReservedCategoryName},
+		{input: "Help", err: errReservedCategoryName},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeCategoryName(tt.input)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("normalizeCategoryName(%q) = %q, %v; want %q, %v", tt.input, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestReservedCategoryName(t *testing.T) {
+	ctx := context.Background()
+	userID := "reserved_category_user"
+
+	response := HandleMessage(ctx, userID, "新增類別 支出 結算").Text
+	if !strings.HasPrefix(response, "❌ 類別名稱不能與指令相同") || !strings.Contains(response, "結算") {
+		t.Errorf("Expected a reserved name error listing 結算, got %q", response)
+	}
+
+	if response := HandleMessage(ctx, userID, "已設定類別").Text; strings.Contains(response, "結算") {
+		t.Errorf("Expected 結算 not to be created, got %q", response)
+	}
+}
+
+func TestReservedCategoryNamesFollowRegistry(t *testing.T) {
+	// A keyword added to the registry is reserved without any other list to update
+	for _, c := range commands {
+		if _, err := normalizeCategoryName(c.keyword); !errors.Is(err, errReservedCategoryName) {
+			t.Errorf("Expected command keyword %s to be reserved, got %v", c.keyword, err)
+		}
+	}
+	for alias := range helpAliases {
+		if _, err := normalizeCategoryName(alias); !errors.Is(err, errReservedCategoryName) {
+			t.Errorf("Expected help alias %s to be reserved, got %v", alias, err)
+		}
+	}
+
+	names := reservedCategoryNames()
+	if !slices.IsSorted(names) || len(slices.Compact(slices.Clone(names))) != len(names) {
+		t.Errorf("Expected reserved names sorted without duplicates, got %v", names)
+	}
+}
+
+func TestDecimalAmounts(t *testing.T) {
+	ctx := context.Background()
+	userID := "decimal_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 咖啡")
+
+	tests := []struct {
+		input    string
+		contains string
+	}{
+		{input: "咖啡 45.5", contains: "✅ 支出 $45.50 類別：咖啡 已記錄！"},
+		{input: "咖啡 45", contains: "✅ 支出 $45 類別：咖啡 已記錄！"},
+		{input: "咖啡 45.50 拿鐵", contains: "✅ 支出 $45.50 類別：咖啡 已記錄！"},
+		// More than two decimals is rejected rather than rounded
+		{input: "咖啡 45.555", contains: "金額最多只能有兩位小數"},
+	}
+	for _, tt := range tests {
+		if response := HandleMessage(ctx, userID, tt.input).Text; !strings.Contains(response, tt.contains) {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.contains, response)
+		}
+	}
+
+	response := HandleMessage(ctx, userID, "結算").Text
+	if !strings.Contains(response, "支出：$136") {
+		t.Errorf("Expected the decimal amounts to add up to $136, got %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "修改 咖啡 45 12.3").Text
+	if !strings.Contains(response, "從 $45 修改為 $12.30") {
+		t.Errorf("Expected a decimal update, got %q", response)
+	}
+}
+
+func TestForeignCurrencyTransactions(t *testing.T) {
+	ctx := context.Background()
+	userID := "currency_handler_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+
+	tests := []struct {
+		input    string
+		contains string
+	}{
+		{input: "餐費 150", contains: "✅ 支出 $150 類別：餐費 已記錄！"},
+		{input: "餐費 20 USD", contains: "✅ 支出 USD 20 類別：餐費 已記錄！"},
+		{input: "餐費 5.5 usd 咖啡", contains: "✅ 支出 USD 5.50 類別：餐費 已記錄！\n📝 備註：咖啡"},
+		{input: "餐費 1000 JPY", contains: "✅ 支出 JPY 1000 類別：餐費 已記錄！"},
+		// Not a currency code, so it stays part of the note
+		{input: "餐費 30 ABC", contains: "✅ 支出 $30 類別：餐費 已記錄！\n📝 備註：ABC"},
+	}
+	for _, tt := range tests {
+		if response := HandleMessage(ctx, userID, tt.input).Text; !strings.Contains(response, tt.contains) {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.contains, response)
+		}
+	}
+
+	response := HandleMessage(ctx, userID, "結算 明細").Text
+	for _, want := range []string{
+		"支出：$180",
+		"💱 其他幣別（未計入上方合計）：",
+		"・JPY：收入 JPY 0／支出 JPY 1000",
+		"・USD：收入 USD 0／支出 USD 25.50",
+	} {
+		if !strings.Contains(response, want) {
+			t.Errorf("Expected %q in summary, got %q", want, response)
+		}
+	}
+
+	response = HandleMessage(ctx, userID, "撤銷").Text
+	if !strings.Contains(response, "已撤銷 餐費 $30") {
+		t.Errorf("Expected the TWD record to be undone, got %q", response)
+	}
+	response = HandleMessage(ctx, userID, "撤銷").Text
+	if !strings.Contains(response, "已撤銷 餐費 JPY 1000") {
+		t.Errorf("Expected the JPY record to be undone with its currency, got %q", response)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	userID := "search_handler_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 午餐")
+	HandleMessage(ctx, userID, "午餐 90 排骨便當")
+	HandleMessage(ctx, userID, "午餐 120 牛肉麵")
+
+	response := HandleMessage(ctx, userID, "搜尋 便當").Text
+	if !strings.Contains(response, "午餐 $90 排骨便當") || strings.Contains(response, "牛肉麵") {
+		t.Errorf("Expected only the 便當 record, got %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "搜尋 披薩").Text
+	if !strings.Contains(response, "🔍 找不到備註包含「披薩」的紀錄。") {
+		t.Errorf("Expected no matches, got %q", response)
+	}
+
+	for i := 0; i < searchResultLimit; i++ {
+		HandleMessage(ctx, userID, fmt.Sprintf("午餐 %d 便當", 100+i))
+	}
+	response = HandleMessage(ctx, userID, "搜尋 便當").Text
+	if !strings.Contains(response, fmt.Sprintf("只顯示最新 %d 筆", searchResultLimit)) {
+		t.Errorf("Expected a note that more matches exist, got %q", response)
+	}
+}
+
+func TestAmountRange(t *testing.T) {
+	ctx := context.Background()
+	userID := "amount_range_handler_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+	HandleMessage(ctx, userID, "新增類別 支出 交通")
+	HandleMessage(ctx, userID, "餐費 100")
+	HandleMessage(ctx, userID, "餐費 500")
+	HandleMessage(ctx, userID, "餐費 501")
+	HandleMessage(ctx, userID, "交通 300")
+
+	response := HandleMessage(ctx, userID, "金額 100 500").Text
+	if !strings.Contains(response, "（3 筆）") || !strings.Contains(response, "餐費 $100") ||
+		!strings.Contains(response, "餐費 $500") || strings.Contains(response, "$501") {
+		t.Errorf("Expected the inclusive range 100 to 500, got %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "金額 100 500 餐費").Text
+	if !strings.Contains(response, "（2 筆）") || strings.Contains(response, "交通") {
+		t.Errorf("Expected only 餐費 in range, got %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "金額 500").Text
+	if !strings.Contains(response, "$500 以上") || !strings.Contains(response, "（2 筆）") {
+		t.Errorf("Expected the open-ended range, got %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "金額 300 交通").Text
+	if !strings.Contains(response, "（1 筆）") || !strings.Contains(response, "交通 $300") {
+		t.Errorf("Expected the open-ended category range, got %q", response)
+	}
+
+	if response := HandleMessage(ctx, userID, "金額 500 100").Text; response != "⚠️ 最小值不能大於最大值，例如：金額 100 500" {
+		t.Errorf("Expected a min above max error, got %q", response)
+	}
+	if response := HandleMessage(ctx, userID, "金額 abc").Text; response != amountRangeFormatReply {
+		t.Errorf("Expected a format error, got %q", response)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	ctx := context.Background()
+	userID := "purge_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+	HandleMessage(ctx, userID, "新增類別 收入 薪水")
+	HandleMessage(ctx, userID, "餐費 100")
+	HandleMessage(ctx, userID, "薪水 5000")
+
+	// Without 確認 nothing is deleted
+	if response := HandleMessage(ctx, userID, "清空").Text; response != purgeWarningReply {
+		t.Errorf("Expected the purge warning, got %q", response)
+	}
+	if response := HandleMessage(ctx, userID, "已設定類別").Text; !strings.Contains(response, "餐費") {
+		t.Errorf("Expected categories to be kept, got %q", response)
+	}
+
+	response := HandleMessage(ctx, userID, "清空 確認").Text
+	if response != "🗑️ 已清空 2 筆記帳紀錄與 2 個類別。" {
+		t.Errorf("Unexpected purge reply: %q", response)
+	}
+	if response := HandleMessage(ctx, userID, "撤銷").Text; response != "⚠️ 目前沒有可撤銷的紀錄。" {
+		t.Errorf("Expected no transactions left, got %q", response)
+	}
+	if response := HandleMessage(ctx, userID, "已設定類別").Text; strings.Contains(response, "餐費") {
+		t.Errorf("Expected no categories left, got %q", response)
+	}
+}
+
+func TestRecurring(t *testing.T) {
+	ctx := context.Background()
+	userID := "recurring_handler_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 房租")
+
+	response := HandleMessage(ctx, userID, "訂閱 房租 15000 每月1號").Text
+	if !strings.HasPrefix(response, "🔁 已設定訂閱：房租 $15000，每月 1 號自動記帳") {
+		t.Errorf("Unexpected reply: %q", response)
+	}
+
+	for input, want := range map[string]string{
+		"訂閱 房租 15000 每月32號": recurringFormatReply,
+		"訂閱 房租 15000 每週1":   recurringFormatReply,
+		"訂閱 房租 abc 每月1號":    "金額格式錯誤",
+		"訂閱 不存在 100 每月1號":   unknownCategoryReply,
+	} {
+		if response := HandleMessage(ctx, userID, input).Text; !strings.HasPrefix(response, want) {
+			t.Errorf("%q: expected %q, got %q", input, want, response)
+		}
+	}
+
+	response = HandleMessage(ctx, userID, "訂閱").Text
+	if !strings.Contains(response, "・每月 1 號 房租 $15000") {
+		t.Errorf("Expected the rent in the list, got %q", response)
+	}
+
+	if response := HandleMessage(ctx, userID, "取消訂閱 編號 999999").Text; response != "❌ 找不到符合條件的訂閱。" {
+		t.Errorf("Expected not found, got %q", response)
+	}
+}
+
+func TestParseDayOfMonth(t *testing.T) {
+	tests := []struct {
+		input string
+		day   int
+		ok    bool
+	}{
+		{input: "每月1號", day: 1, ok: true},
+		{input: "每月31日", day: 31, ok: true},
+		{input: "每月0號", ok: false},
+		{input: "每月32號", ok: false},
+		{input: "1號", ok: false},
+	}
+
+	for _, tt := range tests {
+		day, ok := parseDayOfMonth(tt.input)
+		if ok != tt.ok || ok && day != tt.day {
+			t.Errorf("parseDayOfMonth(%q) = %d, %v; want %d, %v", tt.input, day, ok, tt.day, tt.ok)
+		}
+	}
+}
+
+func TestMonthlySummaryWithFixedClock(t *testing.T) {
+	ctx := context.Background()
+	userID := "fixed_clock_user"
+
+	original := Clock
+	Clock = clock.NewFake(time.Date(2024, time.February, 10, 12, 0, 0, 0, config.Location()))
+	defer func() { Clock = original }()
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+	HandleMessage(ctx, userID, "餐費 120")
+
+	// The current month follows the clock, not the real date
+	response := HandleMessage(ctx, userID, "結算").Text
+	if !strings.Contains(response, "2024年2月") || !strings.Contains(response, "支出：$120") {
+		t.Errorf("Expected the February 2024 summary with the expense, got %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "結算 2024年 2月").Text
+	if !strings.Contains(response, "支出：$120") {
+		t.Errorf("Expected the expense to be recorded in February 2024, got %q", response)
+	}
+
+	Clock.(*clock.Fake).Set(time.Date(2024, time.March, 1, 0, 0, 0, 0, config.Location()))
+	response = HandleMessage(ctx, userID, "結算").Text
+	if !strings.Contains(response, "2024年3月") || strings.Contains(response, "$120") {
+		t.Errorf("Expected an empty March 2024 summary, got %q", response)
+	}
+}
+
+func TestChangeCategoryType(t *testing.T) {
+	ctx := context.Background()
+	userID := "change_type_user"
+
+	// 獎金 was created as an expense by mistake
+	HandleMessage(ctx, userID, "新增類別 支出 獎金")
+	HandleMessage(ctx, userID, "新增類別 收入 薪水")
+	HandleMessage(ctx, userID, "設定預算 獎金 1000")
+	HandleMessage(ctx, userID, "獎金 300")
+	HandleMessage(ctx, userID, "獎金 200")
+	HandleMessage(ctx, userID, "薪水 5000")
+
+	response := HandleMessage(ctx, userID, "結算").Text
+	if !strings.Contains(response, "支出：$500") {
+		t.Fatalf("Expected the bonus counted as expense first, got %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "變更類型 獎金 收入").Text
+	if response != "🔄 類別 獎金 已變更為收入，2 筆紀錄已一併更新。" {
+		t.Errorf("Unexpected reply: %q", response)
+	}
+
+	// The summary reclassifies the existing records
+	response = HandleMessage(ctx, userID, "結算").Text
+	if !strings.Contains(response, "收入：$5500") || !strings.Contains(response, "支出：$0") {
+		t.Errorf("Expected the bonus reclassified as income, got %q", response)
+	}
+	if response := HandleMessage(ctx, userID, "查看預算").Text; strings.Contains(response, "獎金") {
+		t.Errorf("Expected the budget to be dropped with the expense type, got %q", response)
+	}
+
+	for input, want := range map[string]string{
+		"變更類型 獎金 收入":  "⚠️ 類別 獎金 已經是收入類別。",
+		"變更類型 不存在 收入": "❌ 類別不存在。",
+		"變更類型 獎金 其他":  "❌ 類別類型只能是 收入 或 支出",
+	} {
+		if response := HandleMessage(ctx, userID, input).Text; response != want {
+			t.Errorf("%q: expected %q, got %q", input, want, response)
+		}
+	}
+}
+
+func TestMissingNotes(t *testing.T) {
+	ctx := context.Background()
+	userID := "missing_note_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+
+	response := HandleMessage(ctx, userID, "缺備註").Text
+	if !strings.Contains(response, "本月每筆紀錄都有備註") {
+		t.Errorf("Expected no records without a note, got %q", response)
+	}
+
+	HandleMessage(ctx, userID, "餐費 120 便當")
+	HandleMessage(ctx, userID, "餐費 80")
+	HandleMessage(ctx, userID, "餐費 65")
+
+	response = HandleMessage(ctx, userID, "缺備註").Text
+	if !strings.Contains(response, "（2 筆）") {
+		t.Errorf("Expected 2 records without a note, got %q", response)
+	}
+	for _, expected := range []string{"餐費 $80（編號", "餐費 $65（編號"} {
+		if !strings.Contains(response, expected) {
+			t.Errorf("Response %q does not contain expected %q", response, expected)
+		}
+	}
+	if strings.Contains(response, "$120") {
+		t.Errorf("Expected the noted record to be excluded, got %q", response)
+	}
+}
+
+func TestSummaryIncludeArchived(t *testing.T) {
+	ctx := context.Background()
+	userID := "archived_summary_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 午餐")
+	HandleMessage(ctx, userID, "記帳 2024-03-05 午餐 150 舊帳")
+	HandleMessage(ctx, userID, "設定保留 1個月")
+
+	if _, err := model.ArchiveOldTransactions(ctx, time.Now()); err != nil {
+		t.Fatalf("ArchiveOldTransactions failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		contains string
+	}{
+		{
+			name:     "預設不含封存",
+			input:    "結算 2024年 3月",
+			contains: "支出：$0",
+		},
+		{
+			name:     "含封存",
+			input:    "結算 2024年 3月 含封存",
+			contains: "支出：$150",
+		},
+		{
+			name:     "含封存標題",
+			input:    "結算 2024年 3月 含封存",
+			contains: "（含封存）",
+		},
+		{
+			name:     "含封存明細",
+			input:    "結算 2024年 3月 明細 含封存",
+			contains: "午餐 $150 舊帳",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := HandleMessage(ctx, userID, tt.input).Text
+
+			if !strings.Contains(response, tt.contains) {
+				t.Errorf("Response %q does not contain expected %q", response, tt.contains)
+			}
+		})
+	}
+}
+
+func TestUnmatchedReplies(t *testing.T) {
+	ctx := context.Background()
+	userID := "unmatched_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 午餐")
+
+	tests := []struct {
+		name      string
+		input     string
+		unmatched bool
+	}{
+		{name: "未知指令", input: "哈哈", unmatched: true},
+		{name: "相近指令", input: "結酸", unmatched: true},
+		{name: "類別不存在", input: "晚餐 100", unmatched: true},
+		{name: "數字類別", input: "100 午餐", unmatched: true},
+		{name: "指令格式錯誤", input: "新增類別 支出", unmatched: false},
+		{name: "記帳", input: "午餐 100", unmatched: false},
+		{name: "金額錯誤", input: "午餐 abc", unmatched: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply := HandleMessage(ctx, userID, tt.input)
+			if reply.Unmatched != tt.unmatched {
+				t.Errorf("Unmatched = %v for %q (reply %q), expected %v", reply.Unmatched, tt.input, reply.Text, tt.unmatched)
+			}
+		})
+	}
+}
+
+func TestLookupCommand(t *testing.T) {
+	tests := []struct {
+		input     string
+		keyword   string
+		known     bool
+		minTokens int
+	}{
+		{input: "新增類別 支出", keyword: "新增類別", known: true, minTokens: 2},
+		{input: "刪除 編號 42", keyword: "刪除", known: true, minTokens: 3},
+		{input: "修改 編號 42 100", keyword: "修改", known: true, minTokens: 4},
+		{input: "結算 上半年 2025", keyword: "結算", known: true, minTokens: 3},
+		{input: "HELP", keyword: "指令大全", known: true, minTokens: 1},
+		{input: "修改 150", known: true},
+		{input: "刪除類別 餐費 不要", known: true},
+		{input: "午餐 150", known: false},
+	}
+
+	for _, tt := range tests {
+		cmd, known := lookupCommand(strings.Fields(tt.input))
+		if known != tt.known {
+			t.Errorf("%q: expected known=%v, got %v", tt.input, tt.known, known)
+		}
+		if tt.keyword == "" {
+			if cmd != nil {
+				t.Errorf("%q: expected no matching command, got %q", tt.input, cmd.keyword)
+			}
+			continue
+		}
+		if cmd == nil || cmd.keyword != tt.keyword || cmd.minTokens != tt.minTokens {
+			t.Errorf("%q: expected %s with %d tokens, got %+v", tt.input, tt.keyword, tt.minTokens, cmd)
+		}
+	}
+
+	// Every command is counted in 我的統計 and offered as a suggestion
+	for _, c := range commands {
+		if !usageCommands[c.keyword] && c.keyword != "收入" && c.keyword != "支出" {
+			t.Errorf("Command %s is missing from usageCommands", c.keyword)
+		}
+	}
+}
+
+func TestCommandKeywordsNeverRecordTransactions(t *testing.T) {
+	ctx := context.Background()
+	userID := "command_conflict_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+
+	// A command keyword with the wrong arguments is a format error, not a transaction
+	for _, input := range []string{"修改 150", "刪除類別 餐費 不要", "撤銷 150"} {
+		response := HandleMessage(ctx, userID, input).Text
+		want := commandFormatReply(strings.Fields(input)[0])
+		if response != want {
+			t.Errorf("%q: expected %q, got %q", input, want, response)
+		}
+	}
+
+	response := HandleMessage(ctx, userID, "新增類別 支出").Text
+	if !strings.Contains(response, "類別名稱") {
+		t.Errorf("Expected a category name error, got %q", response)
+	}
+
+	if response := HandleMessage(ctx, userID, "撤銷").Text; response != "⚠️ 目前沒有可撤銷的紀錄。" {
+		t.Errorf("Expected no transaction recorded, got %q", response)
+	}
+}
+
+func TestUnbudgetedCategories(t *testing.T) {
+	ctx := context.Background()
+	userID := "unbudgeted_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+	HandleMessage(ctx, userID, "新增類別 支出 交通")
+	HandleMessage(ctx, userID, "新增類別 支出 娛樂")
+	HandleMessage(ctx, userID, "新增類別 收入 薪水")
+	HandleMessage(ctx, userID, "設定預算 餐費 5000")
+
+	response := HandleMessage(ctx, userID, "未設預算").Text
+	for _, expected := range []string{"・交通", "・娛樂"} {
+		if !strings.Contains(response, expected) {
+			t.Errorf("Response %q does not contain expected %q", response, expected)
+		}
+	}
+	for _, unexpected := range []string{"餐費", "薪水"} {
+		if strings.Contains(response, unexpected) {
+			t.Errorf("Response %q should not contain %q", response, unexpected)
+		}
+	}
+
+	HandleMessage(ctx, userID, "設定預算 交通 2000")
+	HandleMessage(ctx, userID, "設定預算 娛樂 1000")
+
+	response = HandleMessage(ctx, userID, "未設預算").Text
+	if !strings.Contains(response, "✅ 所有支出類別都已設定預算。") {
+		t.Errorf("Expected all categories to be budgeted, got %q", response)
+	}
+}
+
+func TestBatchTransactions(t *testing.T) {
+	ctx := context.Background()
+	userID := "batch_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 早餐")
+	HandleMessage(ctx, userID, "新增類別 支出 午餐")
+	HandleMessage(ctx, userID, "新增類別 支出 晚餐")
+
+	response := HandleMessage(ctx, userID, "早餐 80\n午餐 150\n\n晚餐 220 火鍋").Text
+	if !strings.Contains(response, "✅ 已記錄 3 筆，共 $450") {
+		t.Errorf("Unexpected batch response: %q", response)
+	}
+	if strings.Contains(response, "失敗") {
+		t.Errorf("Expected no failures, got %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "早餐 50\n宵夜 100\n午餐 abc\n晚餐 0").Text
+	expected := []string{
+		"✅ 已記錄 1 筆，共 $50",
+		"⚠️ 3 筆失敗",
+		"第 2 行「宵夜 100」：類別 宵夜 不存在",
+		"第 3 行「午餐 abc」：格式錯誤",
+		"第 4 行「晚餐 0」：金額必須大於 0",
+	}
+	for _, e := range expected {
+		if !strings.Contains(response, e) {
+			t.Errorf("Response %q does not contain expected %q", response, e)
+		}
+	}
+
+	response = HandleMessage(ctx, userID, "結算").Text
+	if !strings.Contains(response, "支出：$500") {
+		t.Errorf("Expected batch records in the summary, got %q", response)
+	}
+}
+
+func TestNumericCategoryToken(t *testing.T) {
+	ctx := context.Background()
+	userID := "numeric_category_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 午餐")
+
+	tests := []struct {
+		name     string
+		input    string
+		contains string
+	}{
+		{name: "兩個數字", input: "150 300", contains: "請輸入『類別 金額』格式"},
+		{name: "正常記帳", input: "午餐 150", contains: "✅ 支出 $150 類別：午餐 已記錄！"},
+		{name: "兩個詞的指令不被當成記帳", input: "設定總預算 1000", contains: "✅"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := HandleMessage(ctx, userID, tt.input).Text
+			if !strings.Contains(response, tt.contains) {
+				t.Errorf("Response %q does not contain expected %q", response, tt.contains)
+			}
+		})
+	}
+}
+
+func TestSummaryExcludeCategories(t *testing.T) {
+	ctx := context.Background()
+	userID := "exclude_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+	HandleMessage(ctx, userID, "新增類別 支出 投資")
+	HandleMessage(ctx, userID, "新增類別 收入 薪水")
+	HandleMessage(ctx, userID, "餐費 300")
+	HandleMessage(ctx, userID, "投資 10000")
+	HandleMessage(ctx, userID, "薪水 50000")
+
+	response := HandleMessage(ctx, userID, "結算 排除 投資").Text
+	for _, expected := range []string{"（排除：投資）", "收入：$50000", "支出：$300", "・餐費：$300", "淨收益：$49700"} {
+		if !strings.Contains(response, expected) {
+			t.Errorf("Response %q does not contain expected %q", response, expected)
+		}
+	}
+	if strings.Contains(response, "投資：") {
+		t.Errorf("Excluded category should not be listed: %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "結算 明細 排除 投資").Text
+	if strings.Contains(response, "$10000") {
+		t.Errorf("Excluded category should not appear in the detail: %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "結算").Text
+	if !strings.Contains(response, "支出：$10300") {
+		t.Errorf("Unfiltered summary should include every category: %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "結算 排除").Text
+	if !strings.Contains(response, "⚠️ 請指定要排除的類別") {
+		t.Errorf("Expected an error for a missing category list, got %q", response)
+	}
+}
+
+func TestMergeCategories(t *testing.T) {
+	ctx := context.Background()
+	userID := "merge_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 外食")
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+	HandleMessage(ctx, userID, "新增類別 收入 薪水")
+	HandleMessage(ctx, userID, "外食 100")
+	HandleMessage(ctx, userID, "外食 200")
+	HandleMessage(ctx, userID, "餐費 50")
+	HandleMessage(ctx, userID, "訂閱 外食 300 每月1號")
+
+	tests := []struct {
+		name     string
+		input    string
+		contains string
+	}{
+		{name: "類型不同", input: "合併類別 外食 薪水", contains: "❌ 只能合併相同類型"},
+		{name: "來源不存在", input: "合併類別 不存在 餐費", contains: "❌ 類別不存在"},
+		{name: "合併到自己", input: "合併類別 餐費 餐費", contains: "❌ 無法將類別合併到自己。"},
+		{name: "合併成功", input: "合併類別 外食 餐費", contains: "🔀 已將 外食 合併到 餐費，移動了 2 筆紀錄、1 筆訂閱。"},
+		{name: "來源已刪除", input: "外食 100", contains: "❌ 類別不存在"},
+		{name: "紀錄已移動", input: "結算", contains: "・餐費：$350"},
+		{name: "訂閱已移動", input: "訂閱", contains: "・每月 1 號 餐費 $300"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := HandleMessage(ctx, userID, tt.input).Text
+			if !strings.Contains(response, tt.contains) {
+				t.Errorf("Response %q does not contain expected %q", response, tt.contains)
+			}
+		})
+	}
+}
+
+func TestOverrideTransactionType(t *testing.T) {
+	ctx := context.Background()
+	userID := "override_type_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 購物")
+	HandleMessage(ctx, userID, "購物 1000")
+	HandleMessage(ctx, userID, "購物 300")
+
+	ids, err := model.FindTransactionIDs(ctx, userID, "購物", 300)
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("Expected one $300 record, got %v (err: %v)", ids, err)
+	}
+
+	response := HandleMessage(ctx, userID, fmt.Sprintf("修改類型 編號 %d 收入", ids[0])).Text
+	if !strings.Contains(response, fmt.Sprintf("✅ 已將編號 %d（購物 $300）改為收入。", ids[0])) {
+		t.Fatalf("Unexpected override response: %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "結算").Text
+	for _, expected := range []string{"收入：$300", "支出：$1000", "💰 收入明細：\n・購物：$300", "💸 支出明細：\n・購物：$1000"} {
+		if !strings.Contains(response, expected) {
+			t.Errorf("Response %q does not contain expected %q", response, expected)
+		}
+	}
+
+	response = HandleMessage(ctx, userID, fmt.Sprintf("修改類型 編號 %d 退款", ids[0])).Text
+	if !strings.Contains(response, "❌ 類型只能是 收入 或 支出") {
+		t.Errorf("Expected invalid type to be rejected, got %q", response)
+	}
+}
+
+func TestLongestNoSpendStreak(t *testing.T) {
+	day := func(d, hour int) time.Time {
+		return time.Date(2025, 5, d, hour, 0, 0, 0, time.UTC)
+	}
+	from, to := day(1, 0), day(31, 0)
+
+	tests := []struct {
+		name     string
+		expenses []time.Time
+		want     int
+	}{
+		{name: "沒有支出", expenses: nil, want: 31},
+		{name: "每天都有支出", expenses: func() []time.Time {
+			var all []time.Time
+			for d := 1; d <= 31; d++ {
+				all = append(all, day(d, 12))
+			}
+			return all
+		}(), want: 0},
+		// Gaps: 5/2-5/4 (3 days), 5/6-5/12 (7 days), 5/14-5/31 (18 days)
+		{name: "已知間隔", expenses: []time.Time{day(1, 9), day(5, 23), day(5, 8), day(13, 0)}, want: 18},
+		{name: "月初月底有支出", expenses: []time.Time{day(1, 0), day(10, 12), day(31, 23)}, want: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := longestNoSpendStreak(tt.expenses, from, to); got != tt.want {
+				t.Errorf("longestNoSpendStreak() = %d, expected %d", got, tt.want)
+			}
+		})
+	}
+
+	// Days are bucketed in the location of from: 2025-05-01 23:00 UTC is 5/2 in Taipei
+	taipei := time.FixedZone("Asia/Taipei", 8*60*60)
+	localFrom := time.Date(2025, 5, 1, 0, 0, 0, 0, taipei)
+	localTo := time.Date(2025, 5, 3, 0, 0, 0, 0, taipei)
+	if got := longestNoSpendStreak([]time.Time{day(1, 23)}, localFrom, localTo); got != 1 {
+		t.Errorf("Expected the expense to land on 5/2 in Taipei, got streak %d", got)
+	}
+}
+
+func TestSeedDefaultCategories(t *testing.T) {
+	ctx := context.Background()
+	userID := "seed_user"
+
+	response := HandleMessage(ctx, userID, "已設定類別").Text
+	if !strings.Contains(response, "初始化") {
+		t.Errorf("Expected a hint to seed categories, got %q", response)
+	}
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+
+	response = HandleMessage(ctx, userID, "初始化").Text
+	if !strings.Contains(response, "✅ 已新增預設類別：薪資、獎金、交通、娛樂、日用品") {
+		t.Errorf("Unexpected seed response: %q", response)
+	}
+	if !strings.Contains(response, "已存在而略過：餐費") {
+		t.Errorf("Expected 餐費 to be skipped, got %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "初始化").Text
+	if !strings.Contains(response, "⚠️ 預設類別都已存在") {
+		t.Errorf("Expected nothing to be created the second time, got %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "薪資 50000").Text
+	if !strings.Contains(response, "✅ 收入 $50000 類別：薪資 已記錄！") {
+		t.Errorf("Expected seeded category to be usable, got %q", response)
+	}
+}
+
+func TestMyStats(t *testing.T) {
+	ctx := context.Background()
+	userID := "stats_user"
+
+	// A command is counted once it has run, so the first report is empty
+	response := HandleMessage(ctx, userID, "我的統計").Text
+	if !strings.Contains(response, "尚無指令使用紀錄") {
+		t.Errorf("Expected no usage before any command ran, got %q", response)
+	}
+
+	history := []string{
+		"新增類別 支出 午餐",
+		"午餐 100",
+		"支出 午餐 80",
+		"午餐 60 便當",
+		"結算",
+		"結算 明細",
+		"刪除 午餐 100",
+		"無效指令",
+		"大額 1000 2000",
+		"刪除 午餐 999",
+		"修改 午餐 999 1",
+	}
+	for _, msg := range history {
+		HandleMessage(ctx, userID, msg)
+	}
+
+	response = HandleMessage(ctx, userID, "我的統計").Text
+	expectedOrder := []string{"1. 記帳：3 次", "2. 結算：2 次"}
+	last := -1
+	for _, expected := range expectedOrder {
+		idx := strings.Index(response, expected)
+		if idx == -1 {
+			t.Fatalf("Response %q does not contain expected %q", response, expected)
+		}
+		if idx < last {
+			t.Errorf("Expected %q to come after the previous entry in %q", expected, response)
+		}
+		last = idx
+	}
+	for _, expected := range []string{"刪除：1 次", "新增類別：1 次", "我的統計：1 次"} {
+		if !strings.Contains(response, expected) {
+			t.Errorf("Response %q does not contain expected %q", response, expected)
+		}
+	}
+	if strings.Contains(response, "無效指令") {
+		t.Errorf("Unrecognized messages should not be counted: %q", response)
+	}
+	// Format errors and failed commands are not counted either
+	if strings.Contains(response, "大額") || strings.Contains(response, "修改") {
+		t.Errorf("Format errors and failed commands should not be counted: %q", response)
+	}
+}
+
+func TestLargeTransactions(t *testing.T) {
+	ctx := context.Background()
+	userID := "large_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+	HandleMessage(ctx, userID, "新增類別 支出 家電")
+	HandleMessage(ctx, userID, "新增類別 收入 薪水")
+	HandleMessage(ctx, userID, "餐費 999")
+	HandleMessage(ctx, userID, "家電 1000")
+	HandleMessage(ctx, userID, "家電 12000")
+	HandleMessage(ctx, userID, "收入 薪水 50000")
+
+	response := HandleMessage(ctx, userID, "大額 1000").Text
+	if !strings.Contains(response, "（3 筆）") {
+		t.Errorf("Expected 3 records at or above the threshold, got %q", response)
+	}
+	if strings.Contains(response, "$999") {
+		t.Errorf("Expected records below the threshold to be excluded, got %q", response)
+	}
+	salary := strings.Index(response, "薪水 $50000")
+	tv := strings.Index(response, "家電 $12000")
+	fan := strings.Index(response, "家電 $1000")
+	if salary < 0 || tv < 0 || fan < 0 || !(salary < tv && tv < fan) {
+		t.Errorf("Expected records sorted by amount descending, got %q", response)
+	}
+
+	today := localNow()
+	if !strings.Contains(response, fmt.Sprintf("%d/%d", today.Month(), today.Day())) {
+		t.Errorf("Expected records to show their date, got %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "大額 100000").Text
+	if !strings.Contains(response, "本月沒有 $100000 以上的紀錄") {
+		t.Errorf("Expected no records above a high threshold, got %q", response)
+	}
+
+	for _, input := range []string{"大額 0", "大額 -5", "大額 abc"} {
+		response = HandleMessage(ctx, userID, input).Text
+		if !strings.Contains(response, "金額必須大於 0") {
+			t.Errorf("Expected invalid threshold error for %q, got %q", input, response)
+		}
+	}
+}
+
+func TestDailySummary(t *testing.T) {
+	ctx := context.Background()
+	userID := "daily_user"
+
+	response := HandleMessage(ctx, userID, "日結").Text
+	if !strings.Contains(response, "今天還沒有任何紀錄") {
+		t.Errorf("Expected empty-day message, got %q", response)
+	}
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+	HandleMessage(ctx, userID, "新增類別 收入 薪水")
+	HandleMessage(ctx, userID, "餐費 120")
+	HandleMessage(ctx, userID, "餐費 80")
+	HandleMessage(ctx, userID, "收入 薪水 1000")
+
+	today := localNow()
+	for _, input := range []string{"日結", "日結 " + today.Format("2006-01-02")} {
+		response = HandleMessage(ctx, userID, input).Text
+		for _, want := range []string{today.Format("2006/01/02"), "收入：$1000", "支出：$200", "・餐費：$200", "・薪水：$1000", "淨收益：$800"} {
+			if !strings.Contains(response, want) {
+				t.Errorf("%q: expected %q in response, got %q", input, want, response)
+			}
+		}
+	}
+
+	response = HandleMessage(ctx, userID, "日結 2020-01-01").Text
+	if !strings.Contains(response, "2020/01/01 沒有任何紀錄") {
+		t.Errorf("Expected no records for a past day, got %q", response)
+	}
+
+	response = HandleMessage(ctx, userID, "日結 2025/05/03").Text
+	if !strings.Contains(response, "日期格式錯誤") {
+		t.Errorf("Expected date format error, got %q", response)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	userID := "reconcile_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+	HandleMessage(ctx, userID, "餐費 100")
+	HandleMessage(ctx, userID, "餐費 250")
+
+	response := HandleMessage(ctx, userID, "重新計算").Text
+	if !strings.Contains(response, "沒有發現不一致") {
+		t.Errorf("Expected no discrepancies, got %q", response)
+	}
+
+	// Seed a discrepancy that bypasses the model layer
+	if _, err := db.ExecContext(ctx, `
+        UPDATE transactions SET type = '收入' WHERE user_id = $1 AND amount = 25000
+    `, userID); err != nil {
+		t.Fatalf("Failed to seed discrepancy: %v", err)
+	}
+
+	response = HandleMessage(ctx, userID, "重新計算").Text
+	if !strings.Contains(response, "已修正 1 筆") || !strings.Contains(response, "餐費 $250：收入 → 支出") {
+		t.Errorf("Expected the drifted record to be reported, got %q", response)
+	}
+
+	summary, err := model.GetMonthlySummary(ctx, userID, localNow())
+	if err != nil {
+		t.Fatalf("GetMonthlySummary failed: %v", err)
+	}
+	if summary.IncomeTotal != 0 || summary.ExpenseTotal != 35000 {
+		t.Errorf("Expected totals 0/350 after reconciling, got %d/%d", summary.IncomeTotal, summary.ExpenseTotal)
+	}
+
+	response = HandleMessage(ctx, userID, "重新計算").Text
+	if !strings.Contains(response, "沒有發現不一致") {
+		t.Errorf("Expected reconciling to be idempotent, got %q", response)
+	}
+}
+
+func TestIsFailureReply(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  bool
+	}{
+		{reply: "❌ 新增類別失敗，請稍後再試。", want: true},
+		{reply: "記錄失敗，請稍後再試。", want: true},
+		{reply: "取得報表失敗，請稍後再試。", want: true},
+		{reply: "✅ 類別 餐費 已新增！", want: false},
+		{reply: "⚠️ 目前沒有可撤銷的紀錄。", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isFailureReply(tt.reply); got != tt.want {
+			t.Errorf("isFailureReply(%q) = %v, want %v", tt.reply, got, tt.want)
+		}
+	}
+}
+
+func TestHelpAliases(t *testing.T) {
+	ctx := context.Background()
+	userID := "help_alias_user"
+
+	for _, input := range []string{"指令大全", "help", "HELP", "幫助", "?", "？"} {
+		response := HandleMessage(ctx, userID, input).Text
+		if !strings.Contains(response, "📖 指令大全") {
+			t.Errorf("Expected help text for %q, got %q", input, response)
+		}
+	}
+}
+
+func TestUnknownCommandSuggestion(t *testing.T) {
+	ctx := context.Background()
+	userID := "suggest_user"
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "指令", want: "您是指「指令大全」嗎？"},
+		{input: "結箅", want: "您是指「結算」嗎？"},
+		{input: "撤消", want: "您是指「撤銷」嗎？"},
+		{input: "週節", want: "您是指「週結」嗎？"},
+		{input: "設定預箅 餐費 abc", want: "您是指「設定預算」嗎？"},
+		{input: "abc", want: "❓ 指令不正確，請重新輸入。"},
+	}
+
+	for _, tt := range tests {
+		response := HandleMessage(ctx, userID, tt.input).Text
+		if !strings.Contains(response, tt.want) {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.want, response)
+		}
+	}
+}
+
+func TestSummaryTypeFilter(t *testing.T) {
+	ctx := context.Background()
+	userID := "summary_type_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+	HandleMessage(ctx, userID, "新增類別 收入 薪水")
+	HandleMessage(ctx, userID, "餐費 300")
+	HandleMessage(ctx, userID, "收入 薪水 5000")
+
+	response := HandleMessage(ctx, userID, "結算 支出").Text
+	for _, want := range []string{"（僅支出）", "支出：$300", "・餐費：$300"} {
+		if !strings.Contains(response, want) {
+			t.Errorf("Expected %q in expense-only summary, got %q", want, response)
+		}
+	}
+	for _, unwanted := range []string{"薪水", "收入", "淨收益"} {
+		if strings.Contains(response, unwanted) {
+			t.Errorf("Expected no %q in expense-only summary, got %q", unwanted, response)
+		}
+	}
+
+	response = HandleMessage(ctx, userID, "結算 收入 明細").Text
+	for _, want := range []string{"（僅收入）", "收入：$5000", "・薪水：$5000", "收入 薪水 $5000"} {
+		if !strings.Contains(response, want) {
+			t.Errorf("Expected %q in income-only summary, got %q", want, response)
+		}
+	}
+	for _, unwanted := range []string{"餐費", "支出", "淨收益"} {
+		if strings.Contains(response, unwanted) {
+			t.Errorf("Expected no %q in income-only summary, got %q", unwanted, response)
+		}
+	}
+}
+
+func TestCategoryQuery(t *testing.T) {
+	ctx := context.Background()
+	userID := "category_query_user"
+
+	response := HandleMessage(ctx, userID, "查詢 餐費").Text
+	if !strings.Contains(response, "類別不存在") {
+		t.Errorf("Expected category not found, got %q", response)
+	}
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+	HandleMessage(ctx, userID, "新增類別 支出 交通")
+
+	response = HandleMessage(ctx, userID, "查詢 餐費").Text
+	if !strings.Contains(response, "餐費 本月：$0（0 筆）") {
+		t.Errorf("Expected an empty total, got %q", response)
+	}
+
+	for _, input := range []string{"餐費 100 早餐", "餐費 200 午餐", "交通 50", "餐費 300 晚餐", "餐費 400 宵夜"} {
+		HandleMessage(ctx, userID, input)
+	}
+
+	response = HandleMessage(ctx, userID, "查詢 餐費").Text
+	if !strings.Contains(response, "餐費 本月：$1000（4 筆）") {
+		t.Errorf("Expected total and count, got %q", response)
+	}
+	if strings.Contains(response, "$50") || strings.Contains(response, "早餐") {
+		t.Errorf("Expected only the latest three 餐費 entries, got %q", response)
+	}
+	late, dinner, lunch := strings.Index(response, "宵夜"), strings.Index(response, "晚餐"), strings.Index(response, "午餐")
+	if late < 0 || dinner < 0 || lunch < 0 || !(late < dinner && dinner < lunch) {
+		t.Errorf("Expected the latest entries newest first, got %q", response)
+	}
+}
+
+func TestDeleteCategoryConfirmation(t *testing.T) {
+	ctx := context.Background()
+	userID := "delete_category_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+	HandleMessage(ctx, userID, "新增類別 支出 交通")
+	HandleMessage(ctx, userID, "餐費 100")
+	HandleMessage(ctx, userID, "餐費 200")
+
+	response := HandleMessage(ctx, userID, "刪除類別 餐費").Text
+	if !strings.Contains(response, "有 2 筆紀錄") || !strings.Contains(response, "刪除類別 餐費 確認") {
+		t.Errorf("Expected a confirmation prompt, got %q", response)
+	}
+
+	transactions, err := model.GetTransactions(ctx, userID, 10)
+	if err != nil {
+		t.Fatalf("GetTransactions failed: %v", err)
+	}
+	if len(transactions) != 2 {
+		t.Errorf("Expected the guarded delete to keep both records, got %d", len(transactions))
+	}
+
+	response = HandleMessage(ctx, userID, "刪除類別 餐費 確認").Text
+	if !strings.Contains(response, "🗑️ 類別 餐費 已刪除") {
+		t.Errorf("Expected the confirmed delete to succeed, got %q", response)
+	}
+
+	transactions, err = model.GetTransactions(ctx, userID, 10)
+	if err != nil {
+		t.Fatalf("GetTransactions failed: %v", err)
+	}
+	if len(transactions) != 0 {
+		t.Errorf("Expected the records to be deleted with the category, got %d", len(transactions))
+	}
+
+	// A category without records is deleted straight away
+	response = HandleMessage(ctx, userID, "刪除類別 交通").Text
+	if !strings.Contains(response, "🗑️ 類別 交通 已刪除") {
+		t.Errorf("Expected an empty category to be deleted without confirmation, got %q", response)
+	}
+}
+
+func TestUnknownCategoryQuickReplies(t *testing.T) {
+	ctx := context.Background()
+	userID := "quick_reply_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+	HandleMessage(ctx, userID, "新增類別 支出 交通")
+	HandleMessage(ctx, userID, "新增類別 收入 薪水")
+
+	reply := HandleMessage(ctx, userID, "宵夜 150 鹹酥雞")
+	if reply.Text != "❌ 類別不存在，請先新增。" {
+		t.Errorf("Expected the unknown category text unchanged, got %q", reply.Text)
+	}
+	want := []QuickReply{
+		{Label: "交通", Text: "交通 150 鹹酥雞"},
+		{Label: "薪水", Text: "薪水 150 鹹酥雞"},
+		{Label: "餐費", Text: "餐費 150 鹹酥雞"},
+	}
+	if fmt.Sprint(reply.QuickReplies) != fmt.Sprint(want) {
+		t.Errorf("Expected quick replies %v, got %v", want, reply.QuickReplies)
+	}
+
+	// An explicit type only offers categories of that type
+	reply = HandleMessage(ctx, userID, "收入 獎金 1000")
+	if len(reply.QuickReplies) != 1 || reply.QuickReplies[0].Text != "收入 薪水 1000" {
+		t.Errorf("Expected only income categories, got %v", reply.QuickReplies)
+	}
+
+	// Other replies carry no quick replies
+	reply = HandleMessage(ctx, userID, "餐費 150")
+	if len(reply.QuickReplies) != 0 || !strings.Contains(reply.Text, "已記錄") {
+		t.Errorf("Expected a plain recorded reply, got %+v", reply)
+	}
+	reply = HandleMessage(ctx, userID, "設定預算 宵夜 1000")
+	if len(reply.QuickReplies) != 0 {
+		t.Errorf("Expected no quick replies outside transactions, got %v", reply.QuickReplies)
+	}
+}
+
+func TestSummaryBubble(t *testing.T) {
+	summary := model.Summary{
+		IncomeTotal:           500000,
+		ExpenseTotal:          80050,
+		IncomeCategoryTotals:  map[string]int{"薪水": 500000},
+		ExpenseCategoryTotals: map[string]int{"餐費": 50000, "交通": 30050},
+	}
+
+	data, err := json.Marshal(summaryBubble("2025年5月", summary))
+	if err != nil {
+		t.Fatalf("Failed to marshal summary bubble: %v", err)
+	}
+
+	var bubble struct {
+		Type   string `json:"type"`
+		Header struct {
+			Contents []struct {
+				Text string `json:"text"`
+			} `json:"contents"`
+		} `json:"header"`
+		Body struct {
+			Contents []json.RawMessage `json:"contents"`
+		} `json:"body"`
+	}
+	if err := json.Unmarshal(data, &bubble); err != nil {
+		t.Fatalf("Failed to unmarshal summary bubble: %v", err)
+	}
+	if bubble.Type != "bubble" || len(bubble.Header.Contents) != 1 || bubble.Header.Contents[0].Text != "📊 2025年5月" {
+		t.Errorf("Unexpected bubble header: %s", data)
+	}
+	// Three totals, then a separator and heading per side plus one row per category
+	if len(bubble.Body.Contents) != 3+2+1+2+2 {
+		t.Errorf("Expected 10 body components, got %d: %s", len(bubble.Body.Contents), data)
+	}
+	for _, want := range []string{`"$5000"`, `"$800.50"`, `"$4199.50"`, `"餐費"`, `"交通"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected %s in bubble, got %s", want, data)
+		}
+	}
+	if strings.Index(string(data), `"餐費"`) > strings.Index(string(data), `"交通"`) {
+		t.Errorf("Expected categories largest first, got %s", data)
+	}
+}
+
+func TestMonthlySummaryFlex(t *testing.T) {
+	ctx := context.Background()
+	userID := "summary_flex_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 餐費")
+	HandleMessage(ctx, userID, "餐費 150")
+
+	reply := HandleMessage(ctx, userID, "結算")
+	if reply.Flex == nil {
+		t.Fatal("Expected a Flex bubble for the monthly summary")
+	}
+	summary, err := model.GetMonthlySummary(ctx, userID, localNow())
+	if err != nil {
+		t.Fatalf("GetMonthlySummary failed: %v", err)
+	}
+	now := localNow()
+	if want := renderSummary(fmt.Sprintf("%d年%d月", now.Year(), now.Month()), summary); reply.Text != want {
+		t.Errorf("Expected the text fallback unchanged:\nwant %q\ngot  %q", want, reply.Text)
+	}
+
+	for _, input := range []string{"結算 明細", "結算 支出"} {
+		if reply := HandleMessage(ctx, userID, input); reply.Flex != nil {
+			t.Errorf("Expected no Flex bubble for %q", input)
+		}
+	}
+}
+
+func TestHandleFollow(t *testing.T) {
+	ctx := context.Background()
+	userID := "follow_user"
+
+	reply := HandleFollow(ctx, userID)
+	if !strings.Contains(reply.Text, "歡迎") || !strings.Contains(reply.Text, "初始化") {
+		t.Errorf("Expected a welcome mentioning 初始化, got %q", reply.Text)
+	}
+	if len(reply.QuickReplies) == 0 || reply.QuickReplies[0].Text != "初始化" {
+		t.Fatalf("Expected an 初始化 quick reply, got %v", reply.QuickReplies)
+	}
+
+	// Tapping the quick reply seeds the default categories
+	response := HandleMessage(ctx, userID, reply.QuickReplies[0].Text).Text
+	if !strings.Contains(response, "✅ 已新增預設類別") {
+		t.Errorf("Expected the quick reply to seed categories, got %q", response)
+	}
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"accountingbot/db"
+	"accountingbot/logger"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// startTime is used to report the process uptime
+var startTime = time.Now()
+
+// HealthStatus is the JSON body returned by the health endpoint
+type HealthStatus struct {
+	Status        string `json:"status"`
+	DB            string `json:"db,omitempty"`
+	UptimeSeconds int64  `json:"uptime_seconds"`
+}
+
+// HealthHandler reports the health of the service and its components
+func HealthHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := logger.StartSpan(r.Context(), "HealthHandler")
+	defer span.End()
+
+	status := HealthStatus{
+		Status:        "ok",
+		DB:            "up",
+		UptimeSeconds: int64(time.Since(startTime).Seconds()),
+	}
+	code := http.StatusOK
+
+	pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	if err := db.Ping(pingCtx); err != nil {
+		logger.Warn(ctx, "Health check database ping failed", "error", err.Error())
+		status.Status = "degraded"
+		status.DB = "down"
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
+
+// ReadinessStatus is the JSON body returned by the readiness endpoint
+type ReadinessStatus struct {
+	Status     string `json:"status"`
+	DB         string `json:"db"`
+	Migrations string `json:"migrations"`
+}
+
+// LivezHandler reports that the process is up. It never touches the database, so a
+// slow or unreachable database does not get the process restarted.
+func LivezHandler(w http.ResponseWriter, r *http.Request) {
+	_, span := logger.StartSpan(r.Context(), "LivezHandler")
+	defer span.End()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(HealthStatus{
+		Status:        "ok",
+		UptimeSeconds: int64(time.Since(startTime).Seconds()),
+	})
+}
+
+// ReadyzHandler reports whether the service can take traffic: the database must be
+// reachable and every migration applied. Until db.Init has finished it returns 503.
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := logger.StartSpan(r.Context(), "ReadyzHandler")
+	defer span.End()
+
+	status := ReadinessStatus{Status: "ready", DB: "up", Migrations: "applied"}
+	code := http.StatusOK
+
+	checkCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	if !db.Ready() {
+		// Still connecting or migrating, which is expected during startup
+		status = ReadinessStatus{Status: "not_ready", DB: "starting", Migrations: "unknown"}
+		code = http.StatusServiceUnavailable
+	} else if err := db.Ping(checkCtx); err != nil {
+		logger.Warn(ctx, "Readiness check database ping failed", "error", err.Error())
+		status = ReadinessStatus{Status: "not_ready", DB: "down", Migrations: "unknown"}
+		code = http.StatusServiceUnavailable
+	} else if pending, err := db.PendingMigrations(checkCtx); err != nil || pending > 0 {
+		if err != nil {
+			logger.Warn(ctx, "Readiness check failed to read migrations", "error", err.Error())
+		}
+		status.Status = "not_ready"
+		status.Migrations = "pending"
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
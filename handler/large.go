@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"accountingbot/config"
+	"accountingbot/logger"
+	"accountingbot/model"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// handleLargeTransactions handles the command to list this month's transactions at or above
+// a threshold, largest first
+func handleLargeTransactions(ctx context.Context, userID, thresholdStr string) string {
+	ctx, span := logger.StartSpan(ctx, "handleLargeTransactions")
+	defer span.End()
+
+	threshold, err := model.ParseAmount(thresholdStr)
+	if err != nil || threshold <= 0 {
+		logger.Warn(ctx, "Invalid large transaction threshold", "threshold", thresholdStr)
+		return "⚠️ 金額必須大於 0，例如：大額 1000"
+	}
+
+	now := localNow()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	end := start.AddDate(0, 1, 0)
+
+	logger.Info(ctx, "Large transactions", "user_id", userID, "threshold", threshold, "start", start)
+
+	details, err := model.GetLargeTransactions(ctx, userID, start, end, threshold)
+	if err != nil {
+		logger.Error(ctx, "Failed to get large transactions", "error", err.Error())
+		return "❌ 查詢失敗，請稍後再試。"
+	}
+
+	if len(details) == 0 {
+		return fmt.Sprintf("🔍 本月沒有 $%s 以上的紀錄。", model.FormatAmount(threshold))
+	}
+
+	result := fmt.Sprintf("🔍 本月 $%s 以上的紀錄（%d 筆）：\n", model.FormatAmount(threshold), len(details))
+	for _, d := range details {
+		createdAt := d.CreatedAt.In(config.Location())
+		result += fmt.Sprintf("・%d/%d %s %s %s\n", createdAt.Month(), createdAt.Day(), d.Type, d.Category, formatMoney(d.Amount, d.Currency))
+	}
+	return strings.TrimSuffix(result, "\n")
+}
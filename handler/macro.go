@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"accountingbot/logger"
+	"accountingbot/model"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// maxMacroDepth bounds how many times a message can be expanded
+const maxMacroDepth = 5
+
+// expandMacros replaces a leading shortcut with its expansion, following
+// nested shortcuts but never expanding the same one twice
+func expandMacros(ctx context.Context, userID string, tokens []string) []string {
+	ctx, span := logger.StartSpan(ctx, "expandMacros")
+	defer span.End()
+
+	// Never expand the commands that manage shortcuts
+	if tokens[0] == "設定快捷" || tokens[0] == "刪除快捷" || tokens[0] == "快捷列表" {
+		return tokens
+	}
+
+	macros, err := model.GetMacros(ctx, userID)
+	if err != nil {
+		logger.Warn(ctx, "Failed to load macros, skipping expansion", "error", err.Error())
+		return tokens
+	}
+
+	return applyMacros(macros, tokens)
+}
+
+// applyMacros expands tokens using the given shortcuts
+func applyMacros(macros map[string]string, tokens []string) []string {
+	visited := make(map[string]bool)
+	for range maxMacroDepth {
+		expansion, ok := macros[tokens[0]]
+		if !ok || visited[tokens[0]] {
+			break
+		}
+		visited[tokens[0]] = true
+
+		expanded := strings.Fields(expansion)
+		if len(expanded) == 0 {
+			break
+		}
+		tokens = append(expanded, tokens[1:]...)
+	}
+	return tokens
+}
+
+// macroCreatesLoop reports whether adding name=expansion would let a
+// shortcut expand back into itself
+func macroCreatesLoop(macros map[string]string, name, expansion string) bool {
+	next := strings.Fields(expansion)
+	visited := map[string]bool{}
+	for len(next) > 0 {
+		head := next[0]
+		if head == name {
+			return true
+		}
+		if visited[head] {
+			return false
+		}
+		visited[head] = true
+
+		nested, ok := macros[head]
+		if !ok {
+			return false
+		}
+		next = strings.Fields(nested)
+	}
+	return false
+}
+
+// handleSetMacro handles the command to define a shortcut, e.g. "設定快捷 午=午餐 150"
+func handleSetMacro(ctx context.Context, userID, definition string) string {
+	ctx, span := logger.StartSpan(ctx, "handleSetMacro")
+	defer span.End()
+
+	logger.Info(ctx, "Set macro", "definition", definition)
+
+	name, expansion, ok := strings.Cut(definition, "=")
+	name = strings.TrimSpace(name)
+	expansion = strings.TrimSpace(expansion)
+	if !ok || name == "" || expansion == "" || strings.ContainsAny(name, " \t") {
+		logger.Warn(ctx, "Macro format error", "definition", definition)
+		return "⚠️ 格式錯誤，請使用：設定快捷 名稱=指令，例如：設定快捷 午=午餐 150"
+	}
+
+	// A shortcut named after a command would hide it, or be hidden by it
+	if slices.Contains(reservedCategoryNames(), strings.ToLower(name)) {
+		logger.Warn(ctx, "Macro name is a command keyword", "name", name)
+		return fmt.Sprintf("❌ 快捷名稱不能與指令相同，「%s」無法使用。", name)
+	}
+
+	macros, err := model.GetMacros(ctx, userID)
+	if err != nil {
+		logger.Error(ctx, "Failed to load macros", "error", err.Error())
+		return "❌ 設定快捷失敗，請稍後再試。"
+	}
+
+	if macroCreatesLoop(macros, name, expansion) {
+		logger.Warn(ctx, "Macro would create a loop", "name", name, "expansion", expansion)
+		return fmt.Sprintf("❌ 快捷 %s 會形成循環，請修改內容。", name)
+	}
+
+	if err := model.SetMacro(ctx, userID, name, expansion); err != nil {
+		logger.Error(ctx, "Failed to set macro", "error", err.Error())
+		return "❌ 設定快捷失敗，請稍後再試。"
+	}
+
+	logger.Info(ctx, "Macro set successfully", "name", name)
+	return fmt.Sprintf("✅ 已設定快捷：%s → %s", name, expansion)
+}
+
+// handleListMacros handles the command to list shortcuts
+func handleListMacros(ctx context.Context, userID string) string {
+	ctx, span := logger.StartSpan(ctx, "handleListMacros")
+	defer span.End()
+
+	logger.Info(ctx, "List macros")
+
+	macros, err := model.GetMacros(ctx, userID)
+	if err != nil {
+		logger.Error(ctx, "Failed to load macros", "error", err.Error())
+		return "❌ 快捷查詢失敗，請稍後再試。"
+	}
+
+	if len(macros) == 0 {
+		return "⚠️ 你尚未設定任何快捷。"
+	}
+
+	names := make([]string, 0, len(macros))
+	for name := range macros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	response := "⚡ 你的快捷：\n"
+	for _, name := range names {
+		response += fmt.Sprintf("・%s → %s\n", name, macros[name])
+	}
+	return strings.TrimSuffix(response, "\n")
+}
+
+// handleDeleteMacro handles the command to delete a shortcut
+func handleDeleteMacro(ctx context.Context, userID, name string) string {
+	ctx, span := logger.StartSpan(ctx, "handleDeleteMacro")
+	defer span.End()
+
+	logger.Info(ctx, "Delete macro", "name", name)
+
+	deleted, err := model.DeleteMacro(ctx, userID, name)
+	if err != nil {
+		logger.Error(ctx, "Failed to delete macro", "error", err.Error())
+		return "❌ 刪除失敗，請稍後再試。"
+	}
+
+	if !deleted {
+		return "❌ 快捷不存在。"
+	}
+
+	return fmt.Sprintf("🗑️ 快捷 %s 已刪除", name)
+}
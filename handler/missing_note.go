@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"accountingbot/config"
+	"accountingbot/logger"
+	"accountingbot/model"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// handleMissingNotes handles the command to list this month's transactions without a note,
+// so the user can go back and describe them
+func handleMissingNotes(ctx context.Context, userID string) string {
+	ctx, span := logger.StartSpan(ctx, "handleMissingNotes")
+	defer span.End()
+
+	now := localNow()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	end := start.AddDate(0, 1, 0)
+
+	logger.Info(ctx, "Missing notes", "user_id", userID, "start", start)
+
+	details, err := model.GetTransactionsWithoutNote(ctx, userID, start, end)
+	if err != nil {
+		logger.Error(ctx, "Failed to get transactions without note", "error", err.Error())
+		return "❌ 查詢失敗，請稍後再試。"
+	}
+
+	if len(details) == 0 {
+		return "✅ 本月每筆紀錄都有備註。"
+	}
+
+	result := fmt.Sprintf("📝 本月缺備註的紀錄（%d 筆）：\n", len(details))
+	for _, d := range details {
+		createdAt := d.CreatedAt.In(config.Location())
+		result += fmt.Sprintf("・%d/%d %s %s（編號 %d）\n", createdAt.Month(), createdAt.Day(), d.Category, formatMoney(d.Amount, d.Currency), d.ID)
+	}
+	return strings.TrimSuffix(result, "\n")
+}
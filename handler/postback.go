@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"accountingbot/logger"
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// ErrInvalidPostbackData is returned when postback data cannot be decoded
+var ErrInvalidPostbackData = errors.New("invalid postback data")
+
+// EncodePostbackData encodes an action and its parameters as postback data,
+// e.g. "action=record&amount=150&category=餐費"
+func EncodePostbackData(action string, params map[string]string) string {
+	values := url.Values{}
+	for key, value := range params {
+		values.Set(key, value)
+	}
+	values.Set("action", action)
+	return values.Encode()
+}
+
+// DecodePostbackData decodes postback data into its action and parameters. Besides the
+// encoded form it accepts the shorthand "action:id" for actions on one transaction,
+// e.g. "delete:123", which decodes to the action with an "id" parameter.
+func DecodePostbackData(data string) (string, map[string]string, error) {
+	if !strings.Contains(data, "=") {
+		action, id, found := strings.Cut(data, ":")
+		if !found || action == "" || id == "" {
+			return "", nil, ErrInvalidPostbackData
+		}
+		return action, map[string]string{"id": id}, nil
+	}
+
+	values, err := url.ParseQuery(data)
+	if err != nil {
+		return "", nil, ErrInvalidPostbackData
+	}
+
+	action := values.Get("action")
+	if action == "" {
+		return "", nil, ErrInvalidPostbackData
+	}
+
+	params := make(map[string]string, len(values))
+	for key := range values {
+		if key != "action" {
+			params[key] = values.Get(key)
+		}
+	}
+	return action, params, nil
+}
+
+// postbackHandler handles one postback action given its parameters
+type postbackHandler func(ctx context.Context, userID string, params map[string]string) string
+
+// postbackRoutes maps each postback action to its handler
+var postbackRoutes = map[string]postbackHandler{
+	"record": func(ctx context.Context, userID string, params map[string]string) string {
+		return handleQuickTransaction(ctx, userID, params["category"], params["amount"], "", params["note"], localNow())
+	},
+	"delete": func(ctx context.Context, userID string, params map[string]string) string {
+		return handleDeleteTransactionByID(ctx, userID, params["id"])
+	},
+	"summary": func(ctx context.Context, userID string, params map[string]string) string {
+		return handleMonthlySummary(ctx, userID, []string{"結算"}).Text
+	},
+	"categories": func(ctx context.Context, userID string, params map[string]string) string {
+		return handleListCategories(ctx, userID)
+	},
+	"help": func(ctx context.Context, userID string, params map[string]string) string {
+		return getHelpText(ctx)
+	},
+}
+
+// HandlePostback handles postback data sent from menus and buttons
+func HandlePostback(ctx context.Context, userID, data string) string {
+	ctx, span := logger.StartSpan(ctx, "HandlePostback")
+	defer span.End()
+
+	logger.Info(ctx, "Processing postback", "user_id", userID, "data", data)
+
+	action, params, err := DecodePostbackData(data)
+	if err != nil {
+		logger.Warn(ctx, "Invalid postback data", "data", data)
+		return "❓ 無法辨識的操作，請重新輸入。"
+	}
+
+	handle, ok := postbackRoutes[action]
+	if !ok {
+		logger.Info(ctx, "Unrecognized postback action", "action", action)
+		return "❓ 無法辨識的操作，請重新輸入。"
+	}
+	return handle(ctx, userID, params)
+}
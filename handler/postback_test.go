@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"accountingbot/model"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDecodePostbackData(t *testing.T) {
+	data := EncodePostbackData("record", map[string]string{"category": "餐費", "amount": "150"})
+
+	action, params, err := DecodePostbackData(data)
+	if err != nil {
+		t.Fatalf("DecodePostbackData failed: %v", err)
+	}
+	if action != "record" {
+		t.Errorf("Expected action record, got %q", action)
+	}
+	if params["category"] != "餐費" || params["amount"] != "150" {
+		t.Errorf("Unexpected params: %v", params)
+	}
+	if _, ok := params["action"]; ok {
+		t.Errorf("Action should not be included in params: %v", params)
+	}
+
+	for _, data := range []string{"", "category=餐費", "%zz"} {
+		if _, _, err := DecodePostbackData(data); err != ErrInvalidPostbackData {
+			t.Errorf("Expected ErrInvalidPostbackData for %q, got %v", data, err)
+		}
+	}
+}
+
+func TestHandlePostback(t *testing.T) {
+	ctx := context.Background()
+	userID := "postback_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 午餐")
+
+	tests := []struct {
+		name     string
+		data     string
+		contains string
+	}{
+		{
+			name:     "記帳",
+			data:     EncodePostbackData("record", map[string]string{"category": "午餐", "amount": "150"}),
+			contains: "✅ 支出 $150 類別：午餐 已記錄！",
+		},
+		{
+			name:     "查看類別",
+			data:     "action=categories",
+			contains: "午餐",
+		},
+		{
+			name:     "說明",
+			data:     "action=help",
+			contains: "📖 指令大全",
+		},
+		{
+			name:     "未知操作",
+			data:     "action=unknown",
+			contains: "❓ 無法辨識的操作",
+		},
+		{
+			name:     "格式錯誤",
+			data:     "category=午餐",
+			contains: "❓ 無法辨識的操作",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := HandlePostback(ctx, userID, tt.data)
+
+			if !strings.Contains(response, tt.contains) {
+				t.Errorf("Response %q does not contain expected %q", response, tt.contains)
+			}
+		})
+	}
+}
+
+func TestDecodePostbackShorthand(t *testing.T) {
+	action, params, err := DecodePostbackData("delete:123")
+	if err != nil {
+		t.Fatalf("DecodePostbackData failed: %v", err)
+	}
+	if action != "delete" || params["id"] != "123" {
+		t.Errorf("Expected delete with id 123, got %q %v", action, params)
+	}
+
+	for _, data := range []string{"delete", "delete:", ":123"} {
+		if _, _, err := DecodePostbackData(data); err != ErrInvalidPostbackData {
+			t.Errorf("Expected ErrInvalidPostbackData for %q, got %v", data, err)
+		}
+	}
+}
+
+func TestPostbackDelete(t *testing.T) {
+	ctx := context.Background()
+	userID := "postback_delete_user"
+
+	HandleMessage(ctx, userID, "新增類別 支出 午餐")
+	HandleMessage(ctx, userID, "午餐 150")
+
+	transactions, err := model.GetTransactions(ctx, userID, 1)
+	if err != nil || len(transactions) != 1 {
+		t.Fatalf("GetTransactions failed: %v, %d rows", err, len(transactions))
+	}
+	data := fmt.Sprintf("delete:%d", transactions[0].ID)
+
+	if response := HandlePostback(ctx, "someone_else", data); !strings.Contains(response, "❌ 找不到符合條件的紀錄。") {
+		t.Errorf("Expected another user's delete to be refused, got %q", response)
+	}
+
+	response := HandlePostback(ctx, userID, data)
+	if !strings.Contains(response, fmt.Sprintf("🗑️ 已刪除編號 %d 的紀錄 $150。", transactions[0].ID)) {
+		t.Errorf("Expected delete confirmation, got %q", response)
+	}
+
+	response = HandlePostback(ctx, userID, data)
+	if !strings.Contains(response, "❌ 找不到符合條件的紀錄。") {
+		t.Errorf("Expected a second delete to find nothing, got %q", response)
+	}
+}
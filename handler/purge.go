@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"accountingbot/logger"
+	"accountingbot/model"
+	"context"
+	"fmt"
+)
+
+// purgeWarningReply describes what 清空 deletes before the user confirms it
+const purgeWarningReply = "⚠️ 清空會刪除所有記帳紀錄（含已封存的紀錄）、所有類別及其預算與訂閱，且無法還原。\n確定要清空請輸入：清空 確認"
+
+// handlePurge handles the command to delete all of the user's transactions and categories.
+// Nothing is deleted unless confirmed is true.
+func handlePurge(ctx context.Context, userID string, confirmed bool) string {
+	ctx, span := logger.StartSpan(ctx, "handlePurge")
+	defer span.End()
+
+	logger.Info(ctx, "Purge", "user_id", userID, "confirmed", confirmed)
+
+	if !confirmed {
+		return purgeWarningReply
+	}
+
+	result, err := model.PurgeUserData(ctx, userID)
+	if err != nil {
+		logger.Error(ctx, "Failed to purge user data", "error", err.Error())
+		return "❌ 清空失敗，請稍後再試。"
+	}
+
+	return fmt.Sprintf("🗑️ 已清空 %d 筆記帳紀錄與 %d 個類別。", result.Transactions, result.Categories)
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"accountingbot/config"
+	"accountingbot/logger"
+	"accountingbot/model"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// recentCategoryEntries is how many of the latest transactions 查詢 lists
+const recentCategoryEntries = 3
+
+// handleCategoryQuery handles the command to show this month's total, count and latest
+// transactions of one category
+func handleCategoryQuery(ctx context.Context, userID, categoryName string) string {
+	ctx, span := logger.StartSpan(ctx, "handleCategoryQuery")
+	defer span.End()
+
+	now := localNow()
+	logger.Info(ctx, "Category query", "user_id", userID, "category", categoryName)
+
+	total, count, err := model.GetCategoryMonthTotal(ctx, userID, categoryName, now)
+	if errors.Is(err, model.ErrCategoryNotFound) {
+		return "❌ 類別不存在。"
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to get category month total", "error", err.Error())
+		return "❌ 查詢失敗，請稍後再試。"
+	}
+
+	result := fmt.Sprintf("🔎 %s 本月：$%s（%d 筆）", categoryName, model.FormatAmount(total), count)
+	if count == 0 {
+		return result
+	}
+
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	details, err := model.GetTransactionDetails(ctx, userID, start, start.AddDate(0, 1, 0))
+	if err != nil {
+		logger.Error(ctx, "Failed to get transaction details", "error", err.Error())
+		return "❌ 查詢失敗，請稍後再試。"
+	}
+
+	// Details come oldest first, so walk backwards for the latest entries
+	result += "\n最近紀錄："
+	shown := 0
+	for i := len(details) - 1; i >= 0 && shown < recentCategoryEntries; i-- {
+		d := details[i]
+		if d.Category != categoryName {
+			continue
+		}
+		createdAt := d.CreatedAt.In(config.Location())
+		line := fmt.Sprintf("\n・%d/%d %s", createdAt.Month(), createdAt.Day(), formatMoney(d.Amount, d.Currency))
+		if d.Note != "" {
+			line += " " + d.Note
+		}
+		result += line
+		shown++
+	}
+	return result
+}
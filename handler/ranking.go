@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"accountingbot/logger"
+	"accountingbot/model"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultRankingSize is how many categories 排行 lists without a number
+const defaultRankingSize = 5
+
+// rankingMedals mark the top three categories
+var rankingMedals = []string{"🥇", "🥈", "🥉"}
+
+// handleSpendingRanking handles the command to rank this month's expense categories by
+// total, e.g. "排行" or "排行 3"
+func handleSpendingRanking(ctx context.Context, userID string, tokens []string) string {
+	ctx, span := logger.StartSpan(ctx, "handleSpendingRanking")
+	defer span.End()
+
+	size := defaultRankingSize
+	if len(tokens) == 2 {
+		n, err := strconv.Atoi(tokens[1])
+		if err != nil || n <= 0 {
+			logger.Warn(ctx, "Invalid ranking size", "size", tokens[1])
+			return "⚠️ 名次必須大於 0，例如：排行 5"
+		}
+		size = n
+	}
+
+	now := localNow()
+	logger.Info(ctx, "Spending ranking", "user_id", userID, "size", size)
+
+	summary, err := model.GetMonthlySummary(ctx, userID, now)
+	if err != nil {
+		logger.Error(ctx, "Failed to get monthly summary", "error", err.Error())
+		return "❌ 查詢失敗，請稍後再試。"
+	}
+
+	return renderSpendingRanking(summary, size)
+}
+
+// renderSpendingRanking lists the size largest expense categories with their share of the
+// month's expenses
+func renderSpendingRanking(summary model.Summary, size int) string {
+	if summary.ExpenseTotal <= 0 {
+		return "🏆 本月還沒有支出紀錄。"
+	}
+
+	ranked := sortCategoryTotals(summary.ExpenseCategoryTotals)
+	if len(ranked) > size {
+		ranked = ranked[:size]
+	}
+
+	result := fmt.Sprintf("🏆 本月支出排行（共 $%s）：\n", model.FormatAmount(summary.ExpenseTotal))
+	for i, c := range ranked {
+		rank := fmt.Sprintf("%d.", i+1)
+		if i < len(rankingMedals) {
+			rank = rankingMedals[i]
+		}
+		result += fmt.Sprintf("%s %s $%s（%d%%）\n", rank, c.Name, model.FormatAmount(c.Amount), expenseShare(c.Amount, summary.ExpenseTotal))
+	}
+	return strings.TrimSuffix(result, "\n")
+}
+
+// expenseShare returns amount as a percentage of total, rounded to the nearest whole number
+func expenseShare(amount, total int) int {
+	if total <= 0 {
+		return 0
+	}
+	return (amount*100 + total/2) / total
+}
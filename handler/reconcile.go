@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"accountingbot/logger"
+	"accountingbot/model"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// handleReconcile handles the command to recompute the values stored alongside each
+// transaction and report the discrepancies fixed
+func handleReconcile(ctx context.Context, userID string) string {
+	ctx, span := logger.StartSpan(ctx, "handleReconcile")
+	defer span.End()
+
+	logger.Info(ctx, "Reconcile", "user_id", userID)
+
+	corrections, err := model.ReconcileTransactionTypes(ctx, userID)
+	if err != nil {
+		logger.Error(ctx, "Failed to reconcile", "error", err.Error())
+		return "❌ 重新計算失敗，請稍後再試。"
+	}
+
+	if len(corrections) == 0 {
+		return "✅ 重新計算完成，沒有發現不一致的紀錄。"
+	}
+
+	result := fmt.Sprintf("🔧 重新計算完成，已修正 %d 筆不一致的紀錄：\n", len(corrections))
+	for _, c := range corrections {
+		archived := ""
+		if c.Archived {
+			archived = "（已封存）"
+		}
+		result += fmt.Sprintf("・編號 %d %s $%s：%s → %s%s\n", c.ID, c.Category, model.FormatAmount(c.Amount), c.From, c.To, archived)
+	}
+	return strings.TrimSuffix(result, "\n")
+}
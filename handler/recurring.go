@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"accountingbot/logger"
+	"accountingbot/model"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// recurringFormatReply shows the form of 訂閱
+const recurringFormatReply = "⚠️ 格式錯誤，請使用：訂閱 類別名稱 金額 每月1號 [備註]，例如：訂閱 房租 15000 每月1號"
+
+// dayOfMonthPattern matches the schedule of a recurring transaction, e.g. 每月1號 or 每月25日
+var dayOfMonthPattern = regexp.MustCompile(`^每月(\d{1,2})[號日]$`)
+
+// parseDayOfMonth reads a schedule like 每月15號, returning ok false unless the day is 1 to 31
+func parseDayOfMonth(s string) (day int, ok bool) {
+	m := dayOfMonthPattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, false
+	}
+	day, _ = strconv.Atoi(m[1])
+	return day, day >= 1 && day <= 31
+}
+
+// handleAddRecurring handles the command to post a transaction every month, e.g.
+// "訂閱 房租 15000 每月1號"
+func handleAddRecurring(ctx context.Context, userID string, tokens []string) string {
+	ctx, span := logger.StartSpan(ctx, "handleAddRecurring")
+	defer span.End()
+
+	categoryName, amountStr, schedule := tokens[1], tokens[2], tokens[3]
+	note := strings.Join(tokens[4:], " ")
+
+	logger.Info(ctx, "Add recurring transaction", "category", categoryName, "amount", amountStr, "schedule", schedule, "note", note)
+
+	amount, err := model.ParseAmount(amountStr)
+	if err != nil {
+		logger.Warn(ctx, "Amount format error", "amount", amountStr, "error", err.Error())
+		return amountErrorReply(err)
+	}
+	if amount <= 0 {
+		logger.Warn(ctx, "Non-positive amount", "amount", amount)
+		return "金額必須大於 0"
+	}
+
+	day, ok := parseDayOfMonth(schedule)
+	if !ok {
+		logger.Warn(ctx, "Invalid recurring schedule", "schedule", schedule)
+		return recurringFormatReply
+	}
+
+	categoryID, _, err := model.GetCategoryIdAndType(ctx, userID, categoryName)
+	if err != nil {
+		logger.Warn(ctx, "Category does not exist", "category", categoryName)
+		return unknownCategoryReply
+	}
+
+	recurring, err := model.AddRecurringTransaction(ctx, userID, categoryID, amount, day, note, localNow())
+	if err != nil {
+		logger.Error(ctx, "Failed to add recurring transaction", "error", err.Error())
+		return "❌ 設定訂閱失敗，請稍後再試。"
+	}
+
+	return fmt.Sprintf("🔁 已設定訂閱：%s $%s，每月 %d 號自動記帳（編號 %d）\n📅 下次記帳：%s",
+		categoryName, model.FormatAmount(amount), day, recurring.ID, recurring.NextDue.Format("2006-01-02"))
+}
+
+// handleListRecurring handles the command to list the user's recurring transactions
+func handleListRecurring(ctx context.Context, userID string) string {
+	ctx, span := logger.StartSpan(ctx, "handleListRecurring")
+	defer span.End()
+
+	logger.Info(ctx, "List recurring transactions", "user_id", userID)
+
+	recurring, err := model.ListRecurringTransactions(ctx, userID)
+	if err != nil {
+		logger.Error(ctx, "Failed to list recurring transactions", "error", err.Error())
+		return "❌ 查詢失敗，請稍後再試。"
+	}
+
+	if len(recurring) == 0 {
+		return "⚠️ 尚未設定訂閱，例如：訂閱 房租 15000 每月1號"
+	}
+
+	result := "🔁 訂閱列表：\n"
+	for _, r := range recurring {
+		result += fmt.Sprintf("・每月 %d 號 %s $%s", r.DayOfMonth, r.Category, model.FormatAmount(r.Amount))
+		if r.Note != "" {
+			result += " " + r.Note
+		}
+		result += fmt.Sprintf("（編號 %d，下次 %s）\n", r.ID, r.NextDue.Format("2006-01-02"))
+	}
+	return strings.TrimSuffix(result, "\n")
+}
+
+// handleCancelRecurring handles the command to stop a recurring transaction by its ID.
+// Transactions it already posted are kept.
+func handleCancelRecurring(ctx context.Context, userID, idStr string) string {
+	ctx, span := logger.StartSpan(ctx, "handleCancelRecurring")
+	defer span.End()
+
+	logger.Info(ctx, "Cancel recurring transaction", "id", idStr)
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logger.Warn(ctx, "Recurring transaction ID format error", "id", idStr)
+		return "編號格式錯誤，請輸入數字。"
+	}
+
+	err = model.DeleteRecurringTransaction(ctx, userID, id)
+	if errors.Is(err, model.ErrRecurringNotFound) {
+		return "❌ 找不到符合條件的訂閱。"
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to cancel recurring transaction", "error", err.Error())
+		return "❌ 取消訂閱失敗，請稍後再試。"
+	}
+
+	return fmt.Sprintf("🛑 已取消訂閱（編號 %d），已記錄的紀錄會保留。", id)
+}
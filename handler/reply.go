@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"accountingbot/logger"
+	"accountingbot/model"
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+const (
+	// maxQuickReplies is the number of quick-reply buttons LINE shows at most
+	maxQuickReplies = 13
+
+	// maxQuickReplyLabel is the longest quick-reply label LINE accepts, in characters
+	maxQuickReplyLabel = 20
+)
+
+// unknownCategoryReply is the reply to a transaction in a category the user does not have
+const unknownCategoryReply = "❌ 類別不存在，請先新增。"
+
+// QuickReply is a button under a reply that sends Text as a message when tapped
+type QuickReply struct {
+	Label string
+	Text  string
+}
+
+// Reply is a response to a message: its text plus optional extras for clients that support them.
+// Text alone is always a complete answer.
+type Reply struct {
+	Text         string
+	QuickReplies []QuickReply
+	// Flex is a richer rendering of Text for LINE
+	Flex *linebot.BubbleContainer
+	// Unmatched is set when the text matched no command or category, so a group chat
+	// can leave ordinary conversation unanswered
+	Unmatched bool
+}
+
+// PlainText returns the reply for clients that only show text, such as WebhookHandler.
+// Extras like quick replies and Flex bubbles are dropped; Text already carries the full answer.
+func (r Reply) PlainText() string {
+	return r.Text
+}
+
+// categoryQuickReplies builds one quick reply per category of the user, each resending the
+// transaction tokens with the category replaced. An explicit 收入/支出 limits the choices
+// to that type.
+func categoryQuickReplies(ctx context.Context, userID string, tokens []string) []QuickReply {
+	index, forcedType := 0, ""
+	switch tokens[0] {
+	case "收入", "支出":
+		index, forcedType = 1, tokens[0]
+	case "記帳":
+		index = 2
+	}
+	if index >= len(tokens) {
+		return nil
+	}
+
+	categories, err := model.GetCategoriesInfo(ctx, userID)
+	if err != nil {
+		logger.Error(ctx, "Failed to get categories for quick replies", "error", err.Error())
+		return nil
+	}
+
+	names := make([]string, 0, len(categories))
+	for name, typeName := range categories {
+		if forcedType == "" || typeName == forcedType {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	if len(names) > maxQuickReplies {
+		names = names[:maxQuickReplies]
+	}
+
+	replies := make([]QuickReply, 0, len(names))
+	for _, name := range names {
+		resent := slices.Clone(tokens)
+		resent[index] = name
+		label := name
+		if runes := []rune(label); len(runes) > maxQuickReplyLabel {
+			label = string(runes[:maxQuickReplyLabel])
+		}
+		replies = append(replies, QuickReply{Label: label, Text: strings.Join(resent, " ")})
+	}
+	return replies
+}
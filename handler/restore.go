@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"accountingbot/logger"
+	"accountingbot/model"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// restoreWindow is how long a deleted transaction can still be restored with 還原
+const restoreWindow = 24 * time.Hour
+
+// handleRestore handles the command to bring back a deleted transaction: "還原" restores
+// the most recently deleted one, "還原 編號 42" a specific one
+func handleRestore(ctx context.Context, userID string, tokens []string) string {
+	ctx, span := logger.StartSpan(ctx, "handleRestore")
+	defer span.End()
+
+	since := Clock.Now().Add(-restoreWindow)
+
+	var restored *model.TransactionDetail
+	var err error
+	if len(tokens) == 3 {
+		id, convErr := strconv.Atoi(tokens[2])
+		if convErr != nil {
+			logger.Warn(ctx, "Transaction ID format error", "id", tokens[2])
+			return "編號格式錯誤，請輸入數字。"
+		}
+		restored, err = model.RestoreTransaction(ctx, userID, id, since)
+	} else {
+		restored, err = model.RestoreLastTransaction(ctx, userID, since)
+	}
+
+	if errors.Is(err, model.ErrTransactionNotFound) {
+		return "⚠️ 找不到 24 小時內刪除的紀錄。"
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to restore transaction", "error", err.Error())
+		return "❌ 還原失敗，請稍後再試。"
+	}
+
+	logger.Info(ctx, "Transaction restored", "transaction_id", restored.ID)
+	return fmt.Sprintf("♻️ 已還原編號 %d 的紀錄 %s %s。", restored.ID, restored.Category, formatMoney(restored.Amount, restored.Currency))
+}
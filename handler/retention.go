@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"accountingbot/logger"
+	"accountingbot/model"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxRetentionMonths caps the retention window at 100 years
+const maxRetentionMonths = 1200
+
+// handleSetRetention handles the command to set how many months of transactions stay in
+// the ledger before being archived, e.g. "設定保留 24個月". 0 turns archiving off.
+func handleSetRetention(ctx context.Context, userID, monthsStr string) string {
+	ctx, span := logger.StartSpan(ctx, "handleSetRetention")
+	defer span.End()
+
+	months, err := strconv.Atoi(strings.TrimSuffix(monthsStr, "個月"))
+	if err != nil || months < 0 || months > maxRetentionMonths {
+		logger.Warn(ctx, "Invalid retention months", "months", monthsStr)
+		return "⚠️ 格式錯誤，請使用：設定保留 24個月（0 表示不封存）"
+	}
+
+	if err := model.SetRetentionMonths(ctx, userID, months); err != nil {
+		logger.Error(ctx, "Failed to set retention months", "error", err.Error())
+		return "❌ 設定保留期限失敗，請稍後再試。"
+	}
+
+	if months == 0 {
+		return "✅ 已關閉自動封存，所有紀錄都會保留。"
+	}
+	return fmt.Sprintf("✅ 已設定保留 %d 個月，較舊的紀錄會自動封存。", months)
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"accountingbot/config"
+	"accountingbot/logger"
+	"accountingbot/model"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// searchResultLimit is how many matches 搜尋 lists
+const searchResultLimit = 10
+
+// handleSearch handles the command to find transactions by a word in their note, e.g.
+// "搜尋 便當"
+func handleSearch(ctx context.Context, userID, query string) string {
+	ctx, span := logger.StartSpan(ctx, "handleSearch")
+	defer span.End()
+
+	logger.Info(ctx, "Search", "user_id", userID, "query", query)
+
+	details, more, err := model.SearchTransactions(ctx, userID, query, searchResultLimit)
+	if err != nil {
+		logger.Error(ctx, "Failed to search transactions", "error", err.Error())
+		return "❌ 搜尋失敗，請稍後再試。"
+	}
+
+	if len(details) == 0 {
+		return fmt.Sprintf("🔍 找不到備註包含「%s」的紀錄。", query)
+	}
+
+	result := fmt.Sprintf("🔍 備註包含「%s」的紀錄：\n", query)
+	for _, d := range details {
+		createdAt := d.CreatedAt.In(config.Location())
+		result += fmt.Sprintf("・%s %s %s %s（編號 %d）\n",
+			createdAt.Format("2006/01/02"), d.Category, formatMoney(d.Amount, d.Currency), d.Note, d.ID)
+	}
+	if more {
+		result += fmt.Sprintf("只顯示最新 %d 筆，請使用更精確的關鍵字。", searchResultLimit)
+	}
+	return strings.TrimSuffix(result, "\n")
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"accountingbot/logger"
+	"accountingbot/model"
+	"context"
+	"fmt"
+	"time"
+)
+
+// longestNoSpendStreak returns the longest run of consecutive days in [from, to], both
+// inclusive, without any expense. Days are bucketed in from's location.
+func longestNoSpendStreak(expenseTimes []time.Time, from, to time.Time) int {
+	loc := from.Location()
+
+	spentOn := make(map[string]bool, len(expenseTimes))
+	for _, t := range expenseTimes {
+		spentOn[t.In(loc).Format("2006-01-02")] = true
+	}
+
+	longest, current := 0, 0
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if spentOn[day.Format("2006-01-02")] {
+			current = 0
+			continue
+		}
+		current++
+		if current > longest {
+			longest = current
+		}
+	}
+	return longest
+}
+
+// handleNoSpendStreak handles the command to show the longest run of days without expenses,
+// this month by default or since the first expense with "全部"
+func handleNoSpendStreak(ctx context.Context, userID string, tokens []string) string {
+	ctx, span := logger.StartSpan(ctx, "handleNoSpendStreak")
+	defer span.End()
+
+	allTime := len(tokens) == 2 && tokens[1] == "全部"
+	if len(tokens) > 1 && !allTime {
+		logger.Warn(ctx, "No-spend streak format error", "tokens", tokens)
+		return "⚠️ 格式錯誤，請使用：連續無消費 或 連續無消費 全部"
+	}
+
+	now := localNow()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	if allTime {
+		from = time.Time{}
+	}
+
+	logger.Info(ctx, "No-spend streak", "from", from, "to", today)
+
+	expenseTimes, err := model.GetExpenseTimes(ctx, userID, from, today.AddDate(0, 0, 1))
+	if err != nil {
+		logger.Error(ctx, "Failed to get expense times", "error", err.Error())
+		return "❌ 查詢失敗，請稍後再試。"
+	}
+
+	period := "本月"
+	if allTime {
+		if len(expenseTimes) == 0 {
+			return "⚠️ 尚無支出紀錄。"
+		}
+		first := expenseTimes[0].In(now.Location())
+		from = time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, now.Location())
+		period = "至今"
+	}
+
+	streak := longestNoSpendStreak(expenseTimes, from, today)
+
+	logger.Info(ctx, "No-spend streak completed", "streak", streak, "all_time", allTime)
+	return fmt.Sprintf("🌱 %s最長連續無消費：%d 天", period, streak)
+}
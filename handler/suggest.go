@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"slices"
+)
+
+// helpAliases are the other words that show the help text
+var helpAliases = map[string]bool{
+	"help": true, "幫助": true, "?": true, "？": true,
+}
+
+// suggestCommand returns the known command keyword closest to word, or "" when none is
+// close enough. At most half of the longer word may differ.
+func suggestCommand(word string) string {
+	keywords := make([]string, 0, len(usageCommands))
+	for k := range usageCommands {
+		keywords = append(keywords, k)
+	}
+	// Sorted so ties always resolve to the same keyword
+	slices.Sort(keywords)
+
+	best, bestDistance := "", 0
+	for _, k := range keywords {
+		d := levenshtein(word, k)
+		limit := max(len([]rune(word)), len([]rune(k))) / 2
+		if d == 0 || d > max(limit, 1) {
+			continue
+		}
+		if best == "" || d < bestDistance {
+			best, bestDistance = k, d
+		}
+	}
+	return best
+}
+
+// levenshtein returns the edit distance between a and b, counted in runes
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"accountingbot/logger"
+	"accountingbot/model"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// usageCommands are the command keywords counted in 我的統計
+var usageCommands = map[string]bool{
+	"新增類別": true, "修改類別": true, "刪除類別": true, "合併類別": true, "變更類型": true, "已設定類別": true, "初始化": true,
+	"記帳": true, "訂閱": true, "取消訂閱": true, "修改": true, "修改類型": true, "刪除": true, "撤銷": true, "還原": true, "複製": true, "附件": true,
+	"結算": true, "年結": true, "日結": true, "週結": true, "狀態": true, "連續無消費": true, "匯出": true, "大額": true, "金額": true, "缺備註": true, "查詢": true, "搜尋": true, "平均": true, "排行": true, "比較": true,
+	"設定預算": true, "查看預算": true, "預算風險": true, "未設預算": true, "預測": true, "設定總預算": true, "設定保留": true,
+	"設定快捷": true, "快捷列表": true, "刪除快捷": true, "指令大全": true, "我的統計": true, "重新計算": true, "清空": true,
+}
+
+// usageCommand returns the name a message is counted under, or "" when it is not a command.
+// Quick transactions, including 收入/支出 ones, count as 記帳.
+func usageCommand(tokens []string) string {
+	switch {
+	case len(tokens) == 0:
+		return ""
+	case usageCommands[tokens[0]]:
+		return tokens[0]
+	case helpAliases[strings.ToLower(tokens[0])]:
+		return "指令大全"
+	case tokens[0] == "收入" || tokens[0] == "支出":
+		return "記帳"
+	case len(tokens) >= 2 && isNumber(tokens[1]) && !isNumber(tokens[0]):
+		return "記帳"
+	}
+	return ""
+}
+
+// recordUsage counts the command in a message. Failures are logged and otherwise ignored.
+func recordUsage(ctx context.Context, userID, command string) {
+	if command == "" {
+		return
+	}
+	if err := model.RecordCommandUsage(ctx, userID, command); err != nil {
+		logger.Warn(ctx, "Failed to record command usage", "command", command, "error", err.Error())
+	}
+}
+
+// handleMyStats handles the command to show the user's most used commands,
+// this month by default or all time with "全部"
+func handleMyStats(ctx context.Context, userID string, tokens []string) string {
+	ctx, span := logger.StartSpan(ctx, "handleMyStats")
+	defer span.End()
+
+	allTime := len(tokens) == 2 && tokens[1] == "全部"
+	if len(tokens) > 1 && !allTime {
+		logger.Warn(ctx, "My stats format error", "tokens", tokens)
+		return "⚠️ 格式錯誤，請使用：我的統計 或 我的統計 全部"
+	}
+
+	now := localNow()
+	since := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	period := "本月"
+	if allTime {
+		since = time.Time{}
+		period = "全部"
+	}
+
+	logger.Info(ctx, "My stats", "since", since)
+
+	counts, err := model.GetCommandUsage(ctx, userID, since)
+	if err != nil {
+		logger.Error(ctx, "Failed to get command usage", "error", err.Error())
+		return "❌ 查詢失敗，請稍後再試。"
+	}
+
+	if len(counts) == 0 {
+		return "⚠️ 尚無指令使用紀錄。"
+	}
+
+	response := fmt.Sprintf("📈 %s指令使用統計：\n", period)
+	for i, c := range counts {
+		response += fmt.Sprintf("%d. %s：%d 次\n", i+1, c.Command, c.Count)
+	}
+
+	logger.Info(ctx, "My stats completed", "commands", len(counts))
+	return strings.TrimSuffix(response, "\n")
+}
@@ -3,14 +3,18 @@ package logger
 import (
 	"accountingbot/config"
 	"context"
+	"errors"
 	"log/slog"
 	"os"
+	"strings"
 	"sync"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
@@ -25,52 +29,94 @@ var (
 	logger     *slog.Logger
 	initOnce   sync.Once
 	tracerProv *sdktrace.TracerProvider
+	meterProv  *sdkmetric.MeterProvider
+	ring       *ringBuffer
 )
 
-// Init initializes slog and OpenTelemetry
+// Init initializes slog and OpenTelemetry tracing and metrics. The returned function
+// flushes and stops both exporters.
 func Init() func(context.Context) error {
 	var shutdownFunc func(context.Context) error
 
 	cfg := config.Get()
 	initOnce.Do(func() {
+		var shutdowns []func(context.Context) error
+
 		tp, err := initTracer()
 		if err != nil {
 			slog.Error("Failed to initialize OpenTelemetry tracer", "error", err)
 		} else {
 			tracerProv = tp
-			shutdownFunc = func(ctx context.Context) error {
-				return tp.Shutdown(ctx)
-			}
+			shutdowns = append(shutdowns, tp.Shutdown)
 		}
 
-		// Set slog handler
-		var handler slog.Handler
-		environment := cfg.Environment
-		if environment == "production" {
-			// Use JSON format in production
-			opts := &slog.HandlerOptions{
-				Level:       slog.LevelInfo,
-				ReplaceAttr: addTraceInfo,
-			}
-			handler = slog.NewJSONHandler(os.Stdout, opts)
+		mp, err := initMeter()
+		if err != nil {
+			slog.Error("Failed to initialize OpenTelemetry meter", "error", err)
 		} else {
-			// Use JSON format in development, but enable more detailed logs
-			opts := &slog.HandlerOptions{
-				Level:       slog.LevelDebug,
-				ReplaceAttr: addTraceInfo,
+			meterProv = mp
+			shutdowns = append(shutdowns, mp.Shutdown)
+		}
+
+		if len(shutdowns) > 0 {
+			shutdownFunc = func(ctx context.Context) error {
+				var errs []error
+				for _, shutdown := range shutdowns {
+					errs = append(errs, shutdown(ctx))
+				}
+				return errors.Join(errs...)
 			}
-			handler = slog.NewJSONHandler(os.Stdout, opts)
+		}
+
+		// Set slog handler, JSON in every environment
+		level, levelOK := logLevel(cfg.Environment, cfg.Log.Level)
+		opts := &slog.HandlerOptions{
+			Level:       level,
+			ReplaceAttr: addTraceInfo,
+		}
+		var handler slog.Handler = slog.NewJSONHandler(os.Stdout, opts)
+
+		// Mirror warnings and errors into the in-memory ring buffer
+		if cfg.Log.RingSize > 0 {
+			ring = newRingBuffer(cfg.Log.RingSize)
+			handler = &ringHandler{inner: handler, buf: ring}
 		}
 
 		logger = slog.New(handler)
 		slog.SetDefault(logger)
 
-		Info(context.Background(), "Logger and tracing system initialized")
+		if !levelOK {
+			Warn(context.Background(), "Invalid LOG_LEVEL, using the environment default",
+				"log_level", cfg.Log.Level, "level", level.String())
+		}
+		Info(context.Background(), "Logger, tracing and metrics initialized")
 	})
 
 	return shutdownFunc
 }
 
+// logLevel returns the level named by LOG_LEVEL (debug, info, warn or error). When it is
+// unset or invalid it falls back to Info in production and Debug elsewhere, and ok is false
+// only for an invalid value.
+func logLevel(environment, name string) (level slog.Level, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return slog.LevelDebug, true
+	case "info":
+		return slog.LevelInfo, true
+	case "warn", "warning":
+		return slog.LevelWarn, true
+	case "error":
+		return slog.LevelError, true
+	}
+
+	ok = name == ""
+	if environment == "production" {
+		return slog.LevelInfo, ok
+	}
+	return slog.LevelDebug, ok
+}
+
 // initTracer initializes the OpenTelemetry tracer
 func initTracer() (*sdktrace.TracerProvider, error) {
 	cfg := config.Get()
@@ -84,13 +130,7 @@ func initTracer() (*sdktrace.TracerProvider, error) {
 		return nil, err
 	}
 
-	res, err := resource.New(
-		context.Background(),
-		resource.WithAttributes(
-			semconv.ServiceName(serviceName),
-			attribute.String("environment", cfg.Environment),
-		),
-	)
+	res, err := newResource()
 	if err != nil {
 		return nil, err
 	}
@@ -111,6 +151,48 @@ func initTracer() (*sdktrace.TracerProvider, error) {
 	return tp, nil
 }
 
+// initMeter initializes the OpenTelemetry meter, exporting to the same collector as traces.
+// The instruments in metrics.go were created on the global meter and report from here on.
+func initMeter() (*sdkmetric.MeterProvider, error) {
+	cfg := config.Get()
+
+	exporter, err := otlpmetricgrpc.New(
+		context.Background(),
+		otlpmetricgrpc.WithEndpoint(cfg.Trace.Endpoint),
+		otlpmetricgrpc.WithInsecure(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := newResource()
+	if err != nil {
+		return nil, err
+	}
+
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+		sdkmetric.WithResource(res),
+	)
+
+	otel.SetMeterProvider(mp)
+
+	return mp, nil
+}
+
+// newResource describes this service to the collector
+func newResource() (*resource.Resource, error) {
+	cfg := config.Get()
+
+	return resource.New(
+		context.Background(),
+		resource.WithAttributes(
+			semconv.ServiceName(serviceName),
+			attribute.String("environment", cfg.Environment),
+		),
+	)
+}
+
 // addTraceInfo adds trace_id and span_id to logs
 func addTraceInfo(groups []string, attr slog.Attr) slog.Attr {
 	if len(groups) > 0 {
@@ -179,7 +261,12 @@ func Fatal(ctx context.Context, msg string, args ...any) {
 		args = append(args, "trace_id", spanCtx.TraceID().String())
 		args = append(args, "span_id", spanCtx.SpanID().String())
 	}
-	logger.Error(msg, args...)
+	// Fatal may run before Init, e.g. when the configuration is invalid
+	l := logger
+	if l == nil {
+		l = slog.Default()
+	}
+	l.Error(msg, args...)
 	os.Exit(1)
 }
 
@@ -0,0 +1,213 @@
+package logger
+
+import (
+	"accountingbot/config"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestRingBufferWrapsAtCapacity(t *testing.T) {
+	buf := newRingBuffer(3)
+
+	for i := 1; i <= 5; i++ {
+		buf.add(Entry{Message: fmt.Sprintf("msg-%d", i)})
+	}
+
+	entries := buf.recent(10)
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+
+	expected := []string{"msg-3", "msg-4", "msg-5"}
+	for i, e := range entries {
+		if e.Message != expected[i] {
+			t.Errorf("Entry %d: expected %q, got %q", i, expected[i], e.Message)
+		}
+	}
+
+	latest := buf.recent(1)
+	if len(latest) != 1 || latest[0].Message != "msg-5" {
+		t.Errorf("Expected latest entry msg-5, got %+v", latest)
+	}
+}
+
+func TestRingHandlerOnlyKeepsWarnAndError(t *testing.T) {
+	buf := newRingBuffer(10)
+	h := &ringHandler{
+		inner: slog.NewJSONHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelDebug}),
+		buf:   buf,
+	}
+	l := slog.New(h)
+
+	l.Debug("debug")
+	l.Info("info")
+	l.Warn("warn", "user_id", "u1")
+	l.ErrorContext(context.Background(), "error")
+
+	entries := buf.recent(0)
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Message != "warn" || entries[0].Attrs["user_id"] != "u1" {
+		t.Errorf("Unexpected warn entry: %+v", entries[0])
+	}
+	if entries[1].Level != slog.LevelError {
+		t.Errorf("Expected error level, got %v", entries[1].Level)
+	}
+}
+
+func TestRingHandlerQualifiesGroupedKeys(t *testing.T) {
+	buf := newRingBuffer(10)
+	h := &ringHandler{
+		inner: slog.NewJSONHandler(io.Discard, nil),
+		buf:   buf,
+	}
+	l := slog.New(h).With("service", "bot").WithGroup("request").With("user_id", "u1")
+
+	l.Warn("grouped", "status", 503, slog.Group("db", "op", "ping"))
+
+	entries := buf.recent(0)
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	want := map[string]any{
+		"service":         "bot",
+		"request.user_id": "u1",
+		"request.status":  int64(503),
+		"request.db.op":   "ping",
+	}
+	for key, value := range want {
+		if got := entries[0].Attrs[key]; got != value {
+			t.Errorf("Attrs[%q] = %v, expected %v", key, got, value)
+		}
+	}
+	if len(entries[0].Attrs) != len(want) {
+		t.Errorf("Unexpected attrs: %+v", entries[0].Attrs)
+	}
+}
+
+func TestLogLevelFromEnv(t *testing.T) {
+	t.Setenv("PSQL_URL", "postgres://localhost/test")
+	t.Setenv("LINE_CHANNEL_SECRET", "secret")
+	t.Setenv("LINE_CHANNEL_ACCESS_TOKEN", "token")
+	t.Setenv("LOG_LEVEL", "warn")
+
+	if _, err := config.Init(); err != nil {
+		t.Fatalf("config.Init failed: %v", err)
+	}
+	cfg := config.Get()
+
+	level, ok := logLevel(cfg.Environment, cfg.Log.Level)
+	if !ok || level != slog.LevelWarn {
+		t.Fatalf("Expected warn level, got %v (ok=%v)", level, ok)
+	}
+
+	var out bytes.Buffer
+	l := slog.New(slog.NewJSONHandler(&out, &slog.HandlerOptions{Level: level}))
+	l.Debug("debug message")
+	l.Info("info message")
+	l.Warn("warn message")
+
+	if strings.Contains(out.String(), "debug message") || strings.Contains(out.String(), "info message") {
+		t.Errorf("Expected debug and info to be suppressed, got %s", out.String())
+	}
+	if !strings.Contains(out.String(), "warn message") {
+		t.Errorf("Expected warn to be logged, got %s", out.String())
+	}
+}
+
+func TestLogLevelFallback(t *testing.T) {
+	tests := []struct {
+		environment string
+		name        string
+		want        slog.Level
+		wantOK      bool
+	}{
+		{environment: "production", name: "", want: slog.LevelInfo, wantOK: true},
+		{environment: "DEVELOPMENT", name: "", want: slog.LevelDebug, wantOK: true},
+		{environment: "production", name: "loud", want: slog.LevelInfo, wantOK: false},
+		{environment: "DEVELOPMENT", name: "ERROR", want: slog.LevelError, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		level, ok := logLevel(tt.environment, tt.name)
+		if level != tt.want || ok != tt.wantOK {
+			t.Errorf("logLevel(%q, %q) = %v, %v; want %v, %v", tt.environment, tt.name, level, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestLogCarriesSpanContext(t *testing.T) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	var out bytes.Buffer
+	original := logger
+	logger = slog.New(slog.NewJSONHandler(&out, &slog.HandlerOptions{ReplaceAttr: addTraceInfo}))
+	defer func() { logger = original }()
+
+	ctx, span := StartSpan(context.Background(), "callback")
+	defer span.End()
+
+	Info(ctx, "Received webhook verification")
+	Info(context.Background(), "Server started")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 log lines, got %d: %s", len(lines), out.String())
+	}
+
+	var withSpan, withoutSpan map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &withSpan); err != nil {
+		t.Fatalf("Failed to decode log line: %v", err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &withoutSpan); err != nil {
+		t.Fatalf("Failed to decode log line: %v", err)
+	}
+
+	spanCtx := span.SpanContext()
+	if withSpan["trace_id"] != spanCtx.TraceID().String() || withSpan["span_id"] != spanCtx.SpanID().String() {
+		t.Errorf("Expected trace_id %s and span_id %s, got %v", spanCtx.TraceID(), spanCtx.SpanID(), withSpan)
+	}
+	if _, ok := withoutSpan["trace_id"]; ok {
+		t.Errorf("Expected no trace_id without a span, got %v", withoutSpan)
+	}
+}
+
+func TestMetricsReportThroughRegisteredProvider(t *testing.T) {
+	// The instruments were created on the global meter before any provider existed
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	RecordTransaction(context.Background(), "支出")
+	RecordTransaction(context.Background(), "支出")
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "accounting.transactions.created" {
+				continue
+			}
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok || len(sum.DataPoints) != 1 || sum.DataPoints[0].Value != 2 {
+				t.Fatalf("Expected one data point of 2, got %+v", m.Data)
+			}
+			return
+		}
+	}
+	t.Fatalf("accounting.transactions.created was not reported: %+v", rm)
+}
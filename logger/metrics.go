@@ -0,0 +1,58 @@
+package logger
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Instruments are created on the global meter, so they stay no-ops until Init registers the
+// OTLP meter provider and report through it from then on
+var (
+	meter = otel.Meter(serviceName)
+
+	transactionCounter, _ = meter.Int64Counter(
+		"accounting.transactions.created",
+		metric.WithDescription("Number of transactions recorded"),
+	)
+	categoryCounter, _ = meter.Int64Counter(
+		"accounting.categories.created",
+		metric.WithDescription("Number of categories created"),
+	)
+	commandErrorCounter, _ = meter.Int64Counter(
+		"accounting.command.errors",
+		metric.WithDescription("Number of commands that failed"),
+	)
+	commandLatency, _ = meter.Float64Histogram(
+		"accounting.command.duration",
+		metric.WithDescription("Time taken to handle a message"),
+		metric.WithUnit("ms"),
+	)
+)
+
+// RecordTransaction counts a recorded transaction of the given type (收入 or 支出)
+func RecordTransaction(ctx context.Context, transType string) {
+	transactionCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("type", transType)))
+}
+
+// RecordCategory counts a created category of the given type
+func RecordCategory(ctx context.Context, categoryType string) {
+	categoryCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("type", categoryType)))
+}
+
+// RecordCommand records how long a command took and counts it as an error when it failed.
+// An empty command is recorded as "unknown".
+func RecordCommand(ctx context.Context, command string, duration time.Duration, failed bool) {
+	if command == "" {
+		command = "unknown"
+	}
+	attrs := metric.WithAttributes(attribute.String("command", command))
+
+	commandLatency.Record(ctx, float64(duration)/float64(time.Millisecond), attrs)
+	if failed {
+		commandErrorCounter.Add(ctx, 1, attrs)
+	}
+}
@@ -0,0 +1,158 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Entry is a log record captured by the in-memory ring buffer
+type Entry struct {
+	Time    time.Time
+	Level   slog.Level
+	Message string
+	Attrs   map[string]any
+}
+
+// ringBuffer keeps the most recent entries up to a fixed capacity
+type ringBuffer struct {
+	mu      sync.Mutex
+	entries []Entry
+	next    int
+	full    bool
+}
+
+// newRingBuffer creates a ring buffer holding at most size entries
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{entries: make([]Entry, size)}
+}
+
+// add stores an entry, overwriting the oldest one when the buffer is full
+func (b *ringBuffer) add(e Entry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.entries[b.next] = e
+	b.next = (b.next + 1) % len(b.entries)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// recent returns up to n of the most recent entries, oldest first
+func (b *ringBuffer) recent(n int) []Entry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	count := b.next
+	if b.full {
+		count = len(b.entries)
+	}
+	if n <= 0 || n > count {
+		n = count
+	}
+
+	result := make([]Entry, 0, n)
+	start := b.next - n
+	if start < 0 {
+		start += len(b.entries)
+	}
+	for i := range n {
+		result = append(result, b.entries[(start+i)%len(b.entries)])
+	}
+	return result
+}
+
+// ringHandler mirrors WARN and ERROR records into a ring buffer
+// before passing them to the wrapped handler. Attributes inside groups are
+// stored under dot-qualified keys, such as "request.user_id".
+type ringHandler struct {
+	inner  slog.Handler
+	buf    *ringBuffer
+	attrs  map[string]any
+	prefix string // open groups, each followed by a dot
+}
+
+func (h *ringHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *ringHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelWarn {
+		attrs := make(map[string]any, len(h.attrs)+r.NumAttrs())
+		for k, v := range h.attrs {
+			attrs[k] = v
+		}
+		r.Attrs(func(a slog.Attr) bool {
+			addAttr(attrs, h.prefix, a)
+			return true
+		})
+
+		h.buf.add(Entry{
+			Time:    r.Time,
+			Level:   r.Level,
+			Message: r.Message,
+			Attrs:   attrs,
+		})
+	}
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *ringHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	merged := make(map[string]any, len(h.attrs)+len(attrs))
+	for k, v := range h.attrs {
+		merged[k] = v
+	}
+	for _, a := range attrs {
+		addAttr(merged, h.prefix, a)
+	}
+
+	return &ringHandler{
+		inner:  h.inner.WithAttrs(attrs),
+		buf:    h.buf,
+		attrs:  merged,
+		prefix: h.prefix,
+	}
+}
+
+func (h *ringHandler) WithGroup(name string) slog.Handler {
+	// slog ignores groups without a name
+	if name == "" {
+		return h
+	}
+	return &ringHandler{
+		inner:  h.inner.WithGroup(name),
+		buf:    h.buf,
+		attrs:  h.attrs,
+		prefix: h.prefix + name + ".",
+	}
+}
+
+// addAttr stores a under its key qualified by prefix, flattening group values the same way
+func addAttr(attrs map[string]any, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		// An unnamed group's attributes are inlined, as slog does
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			addAttr(attrs, prefix, ga)
+		}
+		return
+	}
+	if a.Key == "" {
+		return
+	}
+	attrs[prefix+a.Key] = a.Value.Any()
+}
+
+// RecentEntries returns up to n of the most recent WARN/ERROR entries, oldest first.
+// It returns nil when the ring buffer is disabled.
+func RecentEntries(n int) []Entry {
+	if ring == nil {
+		return nil
+	}
+	return ring.recent(n)
+}
@@ -10,14 +10,28 @@ import (
 
 	"accountingbot/config"
 	"accountingbot/db"
+	"accountingbot/dedupe"
 	"accountingbot/handler"
 	"accountingbot/logger"
+	"accountingbot/model"
+	"accountingbot/ratelimit"
 
 	"github.com/line/line-bot-sdk-go/v7/linebot"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// eventCounter counts webhook events by source type and event type
+var eventCounter, _ = otel.Meter("line-accounting-bot").Int64Counter(
+	"line.webhook.events",
+	metric.WithDescription("Number of LINE webhook events received"),
 )
 
 func main() {
-	config.Init()
+	if _, err := config.Init(); err != nil {
+		logger.Fatal(context.Background(), "Invalid configuration", "error", err.Error())
+	}
 	cfg := config.Get()
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
@@ -30,24 +44,84 @@ func main() {
 		_ = shutdown(shutdownCtx)
 	}()
 
-	db.Init(ctx)
+	// Keeps a flood of messages from one user from exhausting the database pool
+	limiter := ratelimit.New(cfg.RateLimit.PerMinute)
+	go limiter.Run(ctx, time.Minute)
+
+	// LINE redelivers events it timed out on, which would otherwise be recorded twice
+	seen := dedupe.New(cfg.Line.DedupeWindow)
+	go seen.Run(ctx, time.Minute)
+
+	// The LINE client is safe for concurrent use, so one is shared by every request
+	bot, err := linebot.New(
+		cfg.Line.ChannelSecret,
+		cfg.Line.ChannelAccessToken,
+	)
+	if err != nil {
+		logger.Fatal(ctx, "Failed to initialize LINE Bot", "error", err.Error())
+	}
 
 	// Set up HTTP handler functions
-	http.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/callback", newCallbackHandler(bot, limiter, seen, cfg.Line.MaxEvents))
+
+	http.HandleFunc("/health", handler.HealthHandler)
+	http.HandleFunc("/livez", handler.LivezHandler)
+	http.HandleFunc("/readyz", handler.ReadyzHandler)
+
+	// Start server
+	server := &http.Server{
+		Addr:    ":" + cfg.Port,
+		Handler: http.DefaultServeMux,
+	}
+
+	// The server starts before the database so liveness probes are answered while the
+	// connection is retried; /readyz reports 503 until db.Init is done
+	go func() {
+		logger.Info(ctx, "Server started", "port", cfg.Port)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Fatal(ctx, "Server failed to start", "error", err.Error())
+		}
+	}()
+
+	db.Init(ctx)
+
+	go runArchiver(ctx, cfg.Archive.Interval)
+	go runRecurring(ctx, cfg.Recurring.Interval)
+
+	// Wait for shutdown signal
+	<-ctx.Done()
+
+	logger.Info(ctx, "Shutting down server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error(ctx, "Server shutdown failed", "error", err.Error())
+	}
+
+	logger.Info(ctx, "Server stopped")
+}
+
+// newCallbackHandler returns the handler for LINE webhook callbacks. At most maxEvents
+// events of a request are handled. Events already in seen are skipped, and each user's
+// events pass through limiter first.
+func newCallbackHandler(bot *linebot.Client, limiter *ratelimit.Limiter, seen *dedupe.Cache, maxEvents int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		rCtx, span := logger.StartSpan(r.Context(), "callback")
 		defer span.End()
 
-		if r.Method != "POST" {
+		// LINE only POSTs webhooks; a GET is a probe and anything else is a mistake, and
+		// neither carries events to parse
+		switch r.Method {
+		case http.MethodPost:
+		case http.MethodGet, http.MethodHead:
+			logger.Info(rCtx, "Received callback probe", "method", r.Method, "path", r.URL.Path)
+			w.WriteHeader(http.StatusOK)
+			return
+		default:
 			logger.Warn(rCtx, "Received non-standard LINE callback request", "method", r.Method, "path", r.URL.Path)
-		}
-
-		bot, err := linebot.New(
-			cfg.Line.ChannelSecret,
-			cfg.Line.ChannelAccessToken,
-		)
-		if err != nil {
-			logger.Error(rCtx, "Failed to initialize LINE Bot", "error", err.Error())
-			w.WriteHeader(http.StatusInternalServerError)
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
 
@@ -66,61 +140,305 @@ func main() {
 
 		// Handle webhook verification
 		if len(events) == 0 {
-			logger.Info(ctx, "Server started", "port", cfg.Port)
+			logger.Info(rCtx, "Received webhook verification")
 			w.WriteHeader(http.StatusOK)
 			return
 		}
 
-		// Handle messages
-		for _, event := range events {
-			if event.Type == linebot.EventTypeMessage {
-				if message, ok := event.Message.(*linebot.TextMessage); ok {
+		// Events need the database, which is still connecting right after startup
+		if !db.Ready() {
+			logger.Warn(rCtx, "Database not ready, rejecting webhook events", "events", len(events))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		// Handle messages and postbacks
+		for _, event := range capEvents(rCtx, events, maxEvents) {
+			if isDuplicate(rCtx, seen, event) {
+				continue
+			}
+			recordEventSource(rCtx, event)
+
+			// Messages in a group or room share that chat's ledger
+			scope := scopeKey(event.Source)
+
+			if isUserAction(event) && !limiter.Allow(rateLimitKey(event.Source)) {
+				logger.Warn(rCtx, "Rate limit exceeded, dropping event",
+					"user_id", rateLimitKey(event.Source),
+					"event_type", event.Type)
+				sendReply(rCtx, bot, event, linebot.NewTextMessage(rateLimitedReply))
+				continue
+			}
+
+			switch event.Type {
+			case linebot.EventTypeMessage:
+				var reply handler.Reply
+				switch message := event.Message.(type) {
+				case *linebot.TextMessage:
 					logger.Info(rCtx, "Received message",
 						"user_id", event.Source.UserID,
+						"scope", scope,
 						"message", message.Text,
 					)
 
-					reply := handler.HandleMessage(rCtx, event.Source.UserID, message.Text)
+					reply = handler.HandleMessage(rCtx, scope, message.Text)
 
-					if _, err := bot.ReplyMessage(event.ReplyToken, linebot.NewTextMessage(reply)).Do(); err != nil {
-						logger.Error(rCtx, "Failed to reply message", "error", err.Error())
+					// Members of a group talk to each other too; only answer what was meant for the bot
+					if reply.Unmatched && isSharedChat(event.Source) {
+						logger.Info(rCtx, "Ignoring unmatched message in a shared chat", "scope", scope)
+						continue
 					}
+
+				case *linebot.ImageMessage:
+					logger.Info(rCtx, "Received image",
+						"user_id", event.Source.UserID,
+						"scope", scope,
+						"message_id", message.ID,
+					)
+
+					// The shared ledger does not know which member made its latest record, so an
+					// image could end up on someone else's transaction
+					if isSharedChat(event.Source) {
+						logger.Info(rCtx, "Ignoring image in a shared chat", "scope", scope)
+						continue
+					}
+
+					reply = handler.Reply{Text: handler.HandleImage(rCtx, scope, message.ID)}
+
+				default:
+					continue
+				}
+
+				if _, err := bot.ReplyMessage(event.ReplyToken, newReplyMessage(reply)).Do(); err != nil {
+					logger.Error(rCtx, "Failed to reply message", "error", err.Error())
+				}
+
+			case linebot.EventTypeFollow:
+				reply := handler.HandleFollow(rCtx, event.Source.UserID)
+				sendReply(rCtx, bot, event, newReplyMessage(reply))
+
+			case linebot.EventTypeUnfollow:
+				handler.HandleUnfollow(rCtx, event.Source.UserID)
+
+			case linebot.EventTypePostback:
+				logger.Info(rCtx, "Received postback",
+					"user_id", event.Source.UserID,
+					"scope", scope,
+					"data", event.Postback.Data,
+				)
+
+				reply := handler.HandlePostback(rCtx, scope, event.Postback.Data)
+
+				if _, err := bot.ReplyMessage(event.ReplyToken, linebot.NewTextMessage(reply)).Do(); err != nil {
+					logger.Error(rCtx, "Failed to reply postback", "error", err.Error())
 				}
 			}
 		}
 
 		w.WriteHeader(http.StatusOK)
-	})
+	}
+}
 
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	})
+// runArchiver periodically moves transactions past their owner's retention window into
+// the archive until ctx is done. A zero interval disables archiving.
+func runArchiver(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		logger.Info(ctx, "Transaction archiving disabled")
+		return
+	}
 
-	// Start server
-	server := &http.Server{
-		Addr:    ":" + cfg.Port,
-		Handler: http.DefaultServeMux,
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := model.ArchiveOldTransactions(ctx, model.Clock.Now()); err != nil {
+			logger.Error(ctx, "Failed to archive old transactions", "error", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
+}
 
-	// Start server asynchronously
-	go func() {
-		logger.Info(ctx, "Server started", "port", cfg.Port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Fatal(ctx, "Server failed to start", "error", err.Error())
+// runRecurring periodically posts the recurring transactions that have come due until ctx
+// is done. Each run only posts what is still due, so restarts never post twice. A zero
+// interval disables the job.
+func runRecurring(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		logger.Info(ctx, "Recurring transactions disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := model.MaterializeRecurringTransactions(ctx, model.Clock.Now()); err != nil {
+			logger.Error(ctx, "Failed to post recurring transactions", "error", err.Error())
 		}
-	}()
 
-	// Wait for shutdown signal
-	<-ctx.Done()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
 
-	logger.Info(ctx, "Shutting down server...")
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// sendReply answers an event with its reply token, or pushes the message to the user when
+// the event carries none
+func sendReply(ctx context.Context, bot *linebot.Client, event *linebot.Event, message linebot.SendingMessage) {
+	if event.ReplyToken != "" {
+		if _, err := bot.ReplyMessage(event.ReplyToken, message).Do(); err != nil {
+			logger.Error(ctx, "Failed to reply message", "event_type", event.Type, "error", err.Error())
+		}
+		return
+	}
 
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		logger.Error(ctx, "Server shutdown failed", "error", err.Error())
+	if event.Source == nil || event.Source.UserID == "" {
+		logger.Warn(ctx, "No reply token or user to send the message to", "event_type", event.Type)
+		return
+	}
+	if _, err := bot.PushMessage(event.Source.UserID, message).Do(); err != nil {
+		logger.Error(ctx, "Failed to push message", "event_type", event.Type, "error", err.Error())
 	}
+}
 
-	logger.Info(ctx, "Server stopped")
+// maxAltText is the longest alternative text LINE accepts for a Flex message, in characters
+const maxAltText = 400
+
+// newReplyMessage converts a handler reply into a LINE message: a Flex message when the
+// reply has a bubble, otherwise a text message, with the reply's quick replies attached
+func newReplyMessage(reply handler.Reply) linebot.SendingMessage {
+	var quickReplies *linebot.QuickReplyItems
+	if len(reply.QuickReplies) > 0 {
+		buttons := make([]*linebot.QuickReplyButton, 0, len(reply.QuickReplies))
+		for _, qr := range reply.QuickReplies {
+			buttons = append(buttons, linebot.NewQuickReplyButton("", linebot.NewMessageAction(qr.Label, qr.Text)))
+		}
+		quickReplies = linebot.NewQuickReplyItems(buttons...)
+	}
+
+	if reply.Flex != nil {
+		// The alternative text shows in notifications and chat lists
+		altText := reply.Text
+		if runes := []rune(altText); len(runes) > maxAltText {
+			altText = string(runes[:maxAltText])
+		}
+		message := linebot.NewFlexMessage(altText, reply.Flex)
+		if quickReplies != nil {
+			return message.WithQuickReplies(quickReplies)
+		}
+		return message
+	}
+
+	message := linebot.NewTextMessage(reply.Text)
+	if quickReplies != nil {
+		return message.WithQuickReplies(quickReplies)
+	}
+	return message
+}
+
+// capEvents limits the number of events processed for a single webhook request
+func capEvents(ctx context.Context, events []*linebot.Event, max int) []*linebot.Event {
+	if max <= 0 || len(events) <= max {
+		return events
+	}
+
+	logger.Warn(ctx, "Too many events in webhook, skipping the excess",
+		"received", len(events),
+		"max_events", max,
+		"skipped", len(events)-max,
+	)
+	return events[:max]
+}
+
+// rateLimitedReply tells a user their message was dropped for coming too fast
+const rateLimitedReply = "⏳ 訊息太頻繁了，請稍等一下再試。"
+
+// isDuplicate reports whether event was already delivered, recording it in seen otherwise.
+// A duplicate is still acknowledged with the rest of the request, just not handled again.
+func isDuplicate(ctx context.Context, seen *dedupe.Cache, event *linebot.Event) bool {
+	if seen.FirstSeen(event.WebhookEventID) {
+		return false
+	}
+	logger.Info(ctx, "Skipping duplicate webhook event",
+		"webhook_event_id", event.WebhookEventID,
+		"is_redelivery", event.DeliveryContext.IsRedelivery,
+		"event_type", event.Type)
+	return true
+}
+
+// isUserAction reports whether an event is something a user sent that the bot acts on,
+// which is what the rate limit counts
+func isUserAction(event *linebot.Event) bool {
+	return event.Type == linebot.EventTypeMessage || event.Type == linebot.EventTypePostback
+}
+
+// rateLimitKey returns the ID an event is rate limited by: the sender, even in a group,
+// so one member cannot use up the group's allowance
+func rateLimitKey(source *linebot.EventSource) string {
+	if source != nil && source.UserID != "" {
+		return source.UserID
+	}
+	return scopeKey(source)
+}
+
+// scopeKey returns the ID a source's ledger is stored under: the group or room when the
+// event comes from one, otherwise the user
+func scopeKey(source *linebot.EventSource) string {
+	switch {
+	case source == nil:
+		return ""
+	case source.GroupID != "":
+		return source.GroupID
+	case source.RoomID != "":
+		return source.RoomID
+	default:
+		return source.UserID
+	}
+}
+
+// isSharedChat reports whether an event comes from a group or room rather than a direct chat
+func isSharedChat(source *linebot.EventSource) bool {
+	return source != nil && (source.GroupID != "" || source.RoomID != "")
+}
+
+// classifySource returns the source type of an event and the id of that source
+func classifySource(source *linebot.EventSource) (sourceType, sourceID string) {
+	if source == nil {
+		return "unknown", ""
+	}
+
+	switch source.Type {
+	case linebot.EventSourceTypeGroup:
+		return string(linebot.EventSourceTypeGroup), source.GroupID
+	case linebot.EventSourceTypeRoom:
+		return string(linebot.EventSourceTypeRoom), source.RoomID
+	case linebot.EventSourceTypeUser:
+		return string(linebot.EventSourceTypeUser), source.UserID
+	default:
+		return "unknown", source.UserID
+	}
+}
+
+// recordEventSource logs the source of an event and counts it
+func recordEventSource(ctx context.Context, event *linebot.Event) {
+	sourceType, sourceID := classifySource(event.Source)
+
+	logger.Info(ctx, "Received event",
+		"event_type", string(event.Type),
+		"source_type", sourceType,
+		"source_id", sourceID,
+	)
+
+	if eventCounter != nil {
+		eventCounter.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("source_type", sourceType),
+			attribute.String("event_type", string(event.Type)),
+		))
+	}
 }
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"accountingbot/dedupe"
+	"accountingbot/handler"
+	"accountingbot/logger"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/v7/linebot"
+)
+
+func TestCapEvents(t *testing.T) {
+	logger.Init()
+	ctx := context.Background()
+
+	events := make([]*linebot.Event, 60)
+	for i := range events {
+		events[i] = &linebot.Event{Type: linebot.EventTypeMessage}
+	}
+
+	processed := capEvents(ctx, events, 50)
+	if len(processed) != 50 {
+		t.Errorf("Expected 50 events to be processed, got %d", len(processed))
+	}
+	if processed[0] != events[0] || processed[49] != events[49] {
+		t.Error("Expected the first events to be kept in order")
+	}
+
+	if got := capEvents(ctx, events[:10], 50); len(got) != 10 {
+		t.Errorf("Expected all 10 events under the cap, got %d", len(got))
+	}
+
+	if got := capEvents(ctx, events, 0); len(got) != len(events) {
+		t.Errorf("Expected no cap when max is 0, got %d", len(got))
+	}
+}
+
+func TestClassifySource(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   *linebot.EventSource
+		wantType string
+		wantID   string
+	}{
+		{
+			name:     "user",
+			source:   &linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: "U123"},
+			wantType: "user",
+			wantID:   "U123",
+		},
+		{
+			name:     "group",
+			source:   &linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: "C456", UserID: "U123"},
+			wantType: "group",
+			wantID:   "C456",
+		},
+		{
+			name:     "room",
+			source:   &linebot.EventSource{Type: linebot.EventSourceTypeRoom, RoomID: "R789", UserID: "U123"},
+			wantType: "room",
+			wantID:   "R789",
+		},
+		{
+			name:     "missing source",
+			source:   nil,
+			wantType: "unknown",
+			wantID:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotType, gotID := classifySource(tt.source)
+			if gotType != tt.wantType || gotID != tt.wantID {
+				t.Errorf("classifySource() = (%q, %q), expected (%q, %q)", gotType, gotID, tt.wantType, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestNewReplyMessage(t *testing.T) {
+	plain, err := json.Marshal(newReplyMessage(handler.Reply{Text: "✅ 已記錄"}))
+	if err != nil {
+		t.Fatalf("Failed to marshal plain reply: %v", err)
+	}
+	if strings.Contains(string(plain), "quickReply") {
+		t.Errorf("Expected no quick replies, got %s", plain)
+	}
+
+	withQuickReplies, err := json.Marshal(newReplyMessage(handler.Reply{
+		Text: "❌ 類別不存在，請先新增。",
+		QuickReplies: []handler.QuickReply{
+			{Label: "餐費", Text: "餐費 150"},
+			{Label: "交通", Text: "交通 150"},
+		},
+	}))
+	if err != nil {
+		t.Fatalf("Failed to marshal quick-reply reply: %v", err)
+	}
+	for _, want := range []string{`"quickReply"`, `"label":"餐費"`, `"text":"交通 150"`} {
+		if !strings.Contains(string(withQuickReplies), want) {
+			t.Errorf("Expected %s in %s", want, withQuickReplies)
+		}
+	}
+}
+
+func TestNewReplyMessageFlex(t *testing.T) {
+	bubble := &linebot.BubbleContainer{
+		Type: linebot.FlexContainerTypeBubble,
+		Body: &linebot.BoxComponent{
+			Type:   linebot.FlexComponentTypeBox,
+			Layout: linebot.FlexBoxLayoutTypeVertical,
+			Contents: []linebot.FlexComponent{
+				&linebot.TextComponent{Type: linebot.FlexComponentTypeText, Text: "收入 $5000"},
+			},
+		},
+	}
+
+	data, err := json.Marshal(newReplyMessage(handler.Reply{Text: strings.Repeat("帳", 500), Flex: bubble}))
+	if err != nil {
+		t.Fatalf("Failed to marshal Flex reply: %v", err)
+	}
+
+	var message struct {
+		Type     string `json:"type"`
+		AltText  string `json:"altText"`
+		Contents struct {
+			Type string `json:"type"`
+		} `json:"contents"`
+	}
+	if err := json.Unmarshal(data, &message); err != nil {
+		t.Fatalf("Failed to unmarshal Flex reply: %v", err)
+	}
+	if message.Type != "flex" || message.Contents.Type != "bubble" {
+		t.Errorf("Expected a Flex bubble message, got %s", data)
+	}
+	if n := len([]rune(message.AltText)); n != maxAltText {
+		t.Errorf("Expected alt text cut to %d characters, got %d", maxAltText, n)
+	}
+}
+
+func TestScopeKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		source *linebot.EventSource
+		want   string
+		shared bool
+	}{
+		{
+			name:   "direct message",
+			source: &linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: "U123"},
+			want:   "U123",
+		},
+		{
+			name:   "group member",
+			source: &linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: "C456", UserID: "U123"},
+			want:   "C456",
+			shared: true,
+		},
+		{
+			name:   "another group member",
+			source: &linebot.EventSource{Type: linebot.EventSourceTypeGroup, GroupID: "C456", UserID: "U999"},
+			want:   "C456",
+			shared: true,
+		},
+		{
+			name:   "room member",
+			source: &linebot.EventSource{Type: linebot.EventSourceTypeRoom, RoomID: "R789", UserID: "U123"},
+			want:   "R789",
+			shared: true,
+		},
+		{
+			name:   "missing source",
+			source: nil,
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scopeKey(tt.source); got != tt.want {
+				t.Errorf("scopeKey() = %q, expected %q", got, tt.want)
+			}
+			// Shared chats stay silent on unmatched text and skip images
+			if got := isSharedChat(tt.source); got != tt.shared {
+				t.Errorf("isSharedChat() = %v, expected %v", got, tt.shared)
+			}
+		})
+	}
+}
+
+func TestCallbackMethods(t *testing.T) {
+	logger.Init()
+
+	bot, err := linebot.New("secret", "token")
+	if err != nil {
+		t.Fatalf("linebot.New failed: %v", err)
+	}
+	callback := newCallbackHandler(bot, nil, nil, 50)
+
+	rec := httptest.NewRecorder()
+	callback(rec, httptest.NewRequest(http.MethodGet, "/callback", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected GET to return 200, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	callback(rec, httptest.NewRequest(http.MethodPut, "/callback", strings.NewReader(`{"events":[]}`)))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("Expected PUT to return 405 allowing POST, got %d (Allow: %q)", rec.Code, rec.Header().Get("Allow"))
+	}
+
+	// A signed POST without events is LINE's webhook verification
+	body := `{"destination":"U0","events":[]}`
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(body))
+
+	req := httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(body))
+	req.Header.Set("X-Line-Signature", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	rec = httptest.NewRecorder()
+	callback(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected webhook verification to return 200, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(body))
+	req.Header.Set("X-Line-Signature", "invalid")
+	rec = httptest.NewRecorder()
+	callback(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid signature to return 400, got %d", rec.Code)
+	}
+}
+
+func TestProbesBeforeDatabase(t *testing.T) {
+	logger.Init()
+
+	// The database is never initialized in this package's tests, as during a slow startup
+	rec := httptest.NewRecorder()
+	handler.LivezHandler(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected /livez to return 200 before the database is ready, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ReadyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz to return 503 before the database is ready, got %d", rec.Code)
+	}
+	var status handler.ReadinessStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Failed to decode readiness response: %v", err)
+	}
+	if status.Status != "not_ready" || status.DB != "starting" {
+		t.Errorf("Unexpected readiness status: %+v", status)
+	}
+
+	bot, err := linebot.New("secret", "token")
+	if err != nil {
+		t.Fatalf("linebot.New failed: %v", err)
+	}
+	callback := newCallbackHandler(bot, nil, nil, 50)
+
+	body := `{"destination":"U0","events":[{"type":"message","replyToken":"r","mode":"active",` +
+		`"timestamp":0,"source":{"type":"user","userId":"U1"},"webhookEventId":"01FZ74A0TDDPYRVKNK77XKC3ZR",` +
+		`"deliveryContext":{"isRedelivery":false},"message":{"type":"text","id":"1","text":"結算"}}]}`
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(body))
+
+	req := httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(body))
+	req.Header.Set("X-Line-Signature", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	rec = httptest.NewRecorder()
+	callback(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected events to be rejected with 503 before the database is ready, got %d", rec.Code)
+	}
+}
+
+func TestIsDuplicate(t *testing.T) {
+	logger.Init()
+	ctx := context.Background()
+	seen := dedupe.New(time.Minute)
+
+	event := &linebot.Event{Type: linebot.EventTypeMessage, WebhookEventID: "01FZ74A0TDDPYRVKNK77XKC3ZR"}
+	redelivered := &linebot.Event{
+		Type:            linebot.EventTypeMessage,
+		WebhookEventID:  event.WebhookEventID,
+		DeliveryContext: linebot.DeliveryContext{IsRedelivery: true},
+	}
+
+	if isDuplicate(ctx, seen, event) {
+		t.Fatal("Expected the first delivery to be handled")
+	}
+	if !isDuplicate(ctx, seen, redelivered) {
+		t.Error("Expected the redelivery of the same event ID to be skipped")
+	}
+	if isDuplicate(ctx, seen, &linebot.Event{WebhookEventID: "01FZ74ASS536FW97EX38NKCZQK"}) {
+		t.Error("Expected a different event ID to be handled")
+	}
+
+	// With de-duplication off every delivery is handled
+	if isDuplicate(ctx, nil, event) || isDuplicate(ctx, nil, event) {
+		t.Error("Expected a nil cache to handle every delivery")
+	}
+}
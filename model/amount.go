@@ -0,0 +1,84 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Amounts are stored as an integer number of cents (minor units), so "45.5" is 4550
+
+var (
+	// ErrInvalidAmount is returned for an amount that is not a plain decimal number
+	ErrInvalidAmount = errors.New("invalid amount")
+
+	// ErrAmountPrecision is returned for an amount with more than two decimals
+	ErrAmountPrecision = errors.New("amount has more than two decimals")
+
+	// ErrNegativeAmount is returned for a valid amount with a leading "-", such as "-50".
+	// It is still an ErrInvalidAmount, but lets callers say the amount must be positive.
+	ErrNegativeAmount = fmt.Errorf("negative amount: %w", ErrInvalidAmount)
+)
+
+// maxAmountDigits keeps the whole part of an amount well inside an int64 of cents
+const maxAmountDigits = 15
+
+// ParseAmount parses an amount such as "45", "45.5" or "45.50" into cents. An amount with
+// more than two decimals, like "45.555", is rejected rather than rounded, so what gets
+// stored is always exactly what was typed. Negative amounts are never accepted.
+func ParseAmount(s string) (int, error) {
+	if rest, ok := strings.CutPrefix(s, "-"); ok {
+		if _, err := ParseAmount(rest); errors.Is(err, ErrNegativeAmount) {
+			return 0, ErrInvalidAmount
+		} else if err != nil {
+			return 0, err
+		}
+		return 0, ErrNegativeAmount
+	}
+
+	whole, fraction, hasFraction := strings.Cut(s, ".")
+	if !isDigits(whole) || len(whole) > maxAmountDigits || (hasFraction && !isDigits(fraction)) {
+		return 0, ErrInvalidAmount
+	}
+	if len(fraction) > 2 {
+		return 0, ErrAmountPrecision
+	}
+
+	units, err := strconv.Atoi(whole)
+	if err != nil {
+		return 0, ErrInvalidAmount
+	}
+	cents := 0
+	if fraction != "" {
+		// "5" means 50 cents, "05" means 5
+		cents, _ = strconv.Atoi((fraction + "0")[:2])
+	}
+	return units*100 + cents, nil
+}
+
+// FormatAmount renders cents as a whole number when there are no cents, e.g. "150",
+// and with two decimals otherwise, e.g. "45.50"
+func FormatAmount(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	if cents%100 == 0 {
+		return sign + strconv.Itoa(cents/100)
+	}
+	return sign + strconv.Itoa(cents/100) + "." + strconv.Itoa(cents%100/10) + strconv.Itoa(cents%10)
+}
+
+// isDigits reports whether s is a non-empty run of ASCII digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
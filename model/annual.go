@@ -0,0 +1,97 @@
+package model
+
+import (
+	"accountingbot/config"
+	"accountingbot/db"
+	"accountingbot/logger"
+	"context"
+	"time"
+)
+
+// MonthTotals are the income and expense totals of one month
+type MonthTotals struct {
+	Income  int
+	Expense int
+}
+
+// AnnualSummary is a year's totals broken down by month and by category
+type AnnualSummary struct {
+	Year int
+	// Months holds January through December
+	Months [12]MonthTotals
+	Total  Summary
+}
+
+// GetAnnualSummary gets the summary of the user's DefaultCurrency transactions in the given
+// year, archived ones included. Months follow config.Location().
+func GetAnnualSummary(ctx context.Context, userID string, year int) (AnnualSummary, error) {
+	ctx, span := logger.StartSpan(ctx, "models.GetAnnualSummary")
+	defer span.End()
+
+	loc := config.Location()
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+	end := start.AddDate(1, 0, 0)
+
+	logger.Info(ctx, "Get annual summary", "user_id", userID, "year", year)
+
+	// Rows are filtered on the created_at range so the (user_id, created_at) indexes apply;
+	// the month is only derived for grouping
+	rows, err := db.QueryContext(ctx, `
+        SELECT EXTRACT(MONTH FROM t.created_at AT TIME ZONE $4)::int, t.type, c.name, SUM(t.amount)
+        FROM (
+            SELECT type, amount, category_id, created_at FROM transactions
+            WHERE user_id = $1 AND created_at >= $2 AND created_at < $3 AND deleted_at IS NULL
+                AND currency = $5
+            UNION ALL
+            SELECT type, amount, category_id, created_at FROM archived_transactions
+            WHERE user_id = $1 AND created_at >= $2 AND created_at < $3 AND currency = $5
+        ) t
+        JOIN categories c ON t.category_id = c.id
+        GROUP BY 1, t.type, c.name
+    `, userID, start, end, loc.String(), DefaultCurrency)
+
+	if err != nil {
+		logger.Error(ctx, "Failed to query annual summary", "error", err.Error())
+		return AnnualSummary{}, err
+	}
+	defer rows.Close()
+
+	annual := AnnualSummary{
+		Year: year,
+		Total: Summary{
+			CategoryTotals:        make(map[string]int),
+			IncomeCategoryTotals:  make(map[string]int),
+			ExpenseCategoryTotals: make(map[string]int),
+		},
+	}
+
+	for rows.Next() {
+		var month, total int
+		var ttype, categoryName string
+		if err := rows.Scan(&month, &ttype, &categoryName, &total); err != nil {
+			logger.Error(ctx, "Failed to parse annual summary data", "error", err.Error())
+			return annual, err
+		}
+
+		annual.Total.CategoryTotals[categoryName] += total
+		if ttype == "收入" {
+			annual.Months[month-1].Income += total
+			annual.Total.IncomeTotal += total
+			annual.Total.IncomeCategoryTotals[categoryName] += total
+		} else {
+			annual.Months[month-1].Expense += total
+			annual.Total.ExpenseTotal += total
+			annual.Total.ExpenseCategoryTotals[categoryName] += total
+		}
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error(ctx, "Failed to iterate annual summary data", "error", err.Error())
+		return annual, err
+	}
+
+	logger.Info(ctx, "Annual summary generated",
+		"income_total", annual.Total.IncomeTotal,
+		"expense_total", annual.Total.ExpenseTotal)
+
+	return annual, nil
+}
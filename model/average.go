@@ -0,0 +1,103 @@
+package model
+
+import (
+	"accountingbot/config"
+	"accountingbot/db"
+	"accountingbot/logger"
+	"context"
+	"database/sql"
+	"time"
+)
+
+// SpendingAverages describes how fast money is spent over the whole history
+type SpendingAverages struct {
+	Total int
+	Count int
+	// ActiveDays counts the days with at least one transaction
+	ActiveDays int
+	// Months counts the calendar months from the first to the last transaction, both included
+	Months int
+	First  time.Time
+	Last   time.Time
+}
+
+// PerActiveDay is the average spent on a day with at least one transaction
+func (a SpendingAverages) PerActiveDay() int {
+	if a.ActiveDays == 0 {
+		return 0
+	}
+	return a.Total / a.ActiveDays
+}
+
+// PerMonth is the average spent per month of history
+func (a SpendingAverages) PerMonth() int {
+	if a.Months == 0 {
+		return 0
+	}
+	return a.Total / a.Months
+}
+
+// GetSpendingAverages gets the user's spending averages in DefaultCurrency over their full
+// history, archived transactions included. An empty category covers every expense; otherwise only that
+// category's transactions count. Days and months follow config.Location().
+func GetSpendingAverages(ctx context.Context, userID, category string) (SpendingAverages, error) {
+	ctx, span := logger.StartSpan(ctx, "models.GetSpendingAverages")
+	defer span.End()
+
+	logger.Info(ctx, "Get spending averages", "user_id", userID, "category", category)
+
+	if category != "" {
+		var exists bool
+		err := db.QueryRowContext(ctx, `
+            SELECT EXISTS (SELECT 1 FROM categories WHERE user_id = $1 AND name = $2)
+        `, userID, category).Scan(&exists)
+		if err != nil {
+			logger.Error(ctx, "Failed to check category", "error", err.Error())
+			return SpendingAverages{}, err
+		}
+		if !exists {
+			logger.Warn(ctx, "Category does not exist", "name", category)
+			return SpendingAverages{}, ErrCategoryNotFound
+		}
+	}
+
+	loc := config.Location()
+
+	var averages SpendingAverages
+	var first, last sql.NullTime
+	err := db.QueryRowContext(ctx, `
+        SELECT COALESCE(SUM(t.amount), 0), COUNT(*),
+            COUNT(DISTINCT (t.created_at AT TIME ZONE $3)::date),
+            MIN(t.created_at), MAX(t.created_at)
+        FROM (
+            SELECT type, amount, category_id, created_at FROM transactions
+            WHERE user_id = $1 AND deleted_at IS NULL AND currency = $4
+            UNION ALL
+            SELECT type, amount, category_id, created_at FROM archived_transactions
+            WHERE user_id = $1 AND currency = $4
+        ) t
+        JOIN categories c ON t.category_id = c.id
+        WHERE ($2 = '' AND t.type = '支出') OR c.name = $2
+    `, userID, category, loc.String(), DefaultCurrency).Scan(&averages.Total, &averages.Count, &averages.ActiveDays, &first, &last)
+	if err != nil {
+		logger.Error(ctx, "Failed to query spending averages", "error", err.Error())
+		return SpendingAverages{}, err
+	}
+
+	if first.Valid && last.Valid {
+		averages.First = first.Time.In(loc)
+		averages.Last = last.Time.In(loc)
+		averages.Months = monthsSpanned(averages.First, averages.Last)
+	}
+
+	logger.Info(ctx, "Spending averages computed",
+		"total", averages.Total,
+		"active_days", averages.ActiveDays,
+		"months", averages.Months)
+	return averages, nil
+}
+
+// monthsSpanned counts the calendar months from first to last, both included
+func monthsSpanned(first, last time.Time) int {
+	return (last.Year()-first.Year())*12 + int(last.Month()-first.Month()) + 1
+}
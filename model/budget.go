@@ -0,0 +1,136 @@
+package model
+
+import (
+	"accountingbot/db"
+	"accountingbot/logger"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// BudgetUsage is a category budget together with the month's spending
+type BudgetUsage struct {
+	Category string
+	Amount   int
+	Spent    int
+}
+
+// SetBudget sets the monthly budget of a category
+func SetBudget(ctx context.Context, userID string, categoryID, amount int) error {
+	ctx, span := logger.StartSpan(ctx, "models.SetBudget")
+	defer span.End()
+
+	logger.Info(ctx, "Set budget", "user_id", userID, "category_id", categoryID, "amount", amount)
+
+	_, err := db.ExecContext(ctx, `
+        INSERT INTO budgets (user_id, category_id, amount) VALUES ($1, $2, $3)
+        ON CONFLICT (user_id, category_id) DO UPDATE SET amount = EXCLUDED.amount
+    `, userID, categoryID, amount)
+
+	if err != nil {
+		logger.Error(ctx, "Failed to set budget", "error", err.Error())
+		return err
+	}
+
+	logger.Info(ctx, "Budget set successfully", "category_id", categoryID, "amount", amount)
+	return nil
+}
+
+// GetBudget gets the monthly budget of a category, 0 means not set
+func GetBudget(ctx context.Context, userID string, categoryID int) (int, error) {
+	ctx, span := logger.StartSpan(ctx, "models.GetBudget")
+	defer span.End()
+
+	var amount int
+	err := db.QueryRowContext(ctx, `
+        SELECT amount FROM budgets WHERE user_id = $1 AND category_id = $2
+    `, userID, categoryID).Scan(&amount)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to get budget", "error", err.Error())
+		return 0, err
+	}
+
+	return amount, nil
+}
+
+// GetBudgetUsages gets every category budget with its DefaultCurrency spending in the given month
+func GetBudgetUsages(ctx context.Context, userID string, month time.Time) ([]BudgetUsage, error) {
+	ctx, span := logger.StartSpan(ctx, "models.GetBudgetUsages")
+	defer span.End()
+
+	logger.Info(ctx, "Get budget usages", "user_id", userID, "year", month.Year(), "month", month.Month())
+
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, month.Location())
+	end := start.AddDate(0, 1, 0)
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT c.name, b.amount, COALESCE(SUM(t.amount), 0)
+        FROM budgets b
+        JOIN categories c ON b.category_id = c.id
+        LEFT JOIN transactions t ON t.category_id = c.id AND t.type = '支出'
+            AND t.created_at >= $2 AND t.created_at < $3 AND t.deleted_at IS NULL
+            AND t.currency = $4
+        WHERE b.user_id = $1
+        GROUP BY c.name, b.amount
+        ORDER BY c.name
+    `, userID, start, end, DefaultCurrency)
+	if err != nil {
+		logger.Error(ctx, "Failed to query budget usages", "error", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usages []BudgetUsage
+
+	for rows.Next() {
+		var u BudgetUsage
+		if err := rows.Scan(&u.Category, &u.Amount, &u.Spent); err != nil {
+			logger.Error(ctx, "Failed to parse budget usage", "error", err.Error())
+			return nil, err
+		}
+		usages = append(usages, u)
+	}
+
+	logger.Info(ctx, "Budget usages fetched", "count", len(usages))
+	return usages, nil
+}
+
+// GetUnbudgetedCategories gets the names of the user's expense categories without a budget
+func GetUnbudgetedCategories(ctx context.Context, userID string) ([]string, error) {
+	ctx, span := logger.StartSpan(ctx, "models.GetUnbudgetedCategories")
+	defer span.End()
+
+	logger.Info(ctx, "Get unbudgeted categories", "user_id", userID)
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT c.name
+        FROM categories c
+        LEFT JOIN budgets b ON b.category_id = c.id AND b.user_id = c.user_id
+        WHERE c.user_id = $1 AND c.type = '支出' AND b.id IS NULL
+        ORDER BY c.name
+    `, userID)
+	if err != nil {
+		logger.Error(ctx, "Failed to query unbudgeted categories", "error", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			logger.Error(ctx, "Failed to parse category name", "error", err.Error())
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	logger.Info(ctx, "Unbudgeted categories fetched", "count", len(names))
+	return names, nil
+}
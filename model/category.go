@@ -4,8 +4,35 @@ import (
 	"accountingbot/db"
 	"accountingbot/logger"
 	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrCategoryNotFound is returned when the user has no category with the given name
+	ErrCategoryNotFound = errors.New("category not found")
+
+	// ErrCategoryTypeDiffers is returned when two categories that must share a type do not
+	ErrCategoryTypeDiffers = errors.New("categories have different types")
+
+	// ErrSameCategory is returned when a category is merged into itself
+	ErrSameCategory = errors.New("source and target are the same category")
+
+	// ErrInvalidCategoryType is returned when a category type is neither 收入 nor 支出
+	ErrInvalidCategoryType = errors.New("category type must be 收入 or 支出")
+
+	// ErrCategoryTypeUnchanged is returned when a category is changed to the type it already has
+	ErrCategoryTypeUnchanged = errors.New("category already has that type")
 )
 
+// IsValidCategoryType reports whether typeName is 收入 or 支出
+func IsValidCategoryType(typeName string) bool {
+	return typeName == "收入" || typeName == "支出"
+}
+
 type Category struct {
 	ID     int    `json:"id"`
 	UserID string `json:"user_id"`
@@ -20,6 +47,11 @@ func AddCategory(ctx context.Context, userID, name, typeName string) error {
 
 	logger.Info(ctx, "Add category", "user_id", userID, "name", name, "type", typeName)
 
+	if !IsValidCategoryType(typeName) {
+		logger.Warn(ctx, "Invalid category type", "type", typeName)
+		return ErrInvalidCategoryType
+	}
+
 	_, err := db.ExecContext(ctx, `
         INSERT INTO categories (user_id, name, type) VALUES ($1, $2, $3)
     `, userID, name, typeName)
@@ -59,6 +91,71 @@ func UpdateCategory(ctx context.Context, userID, oldName, newName string) (bool,
 	return true, nil
 }
 
+// ChangeCategoryType changes a category between 收入 and 支出 in one database transaction.
+// The categories trigger retypes its transactions, archived ones included, except those
+// whose type was overridden on purpose. A budget is dropped when the category stops being
+// an expense. It returns the number of transactions retyped.
+func ChangeCategoryType(ctx context.Context, userID, name, newType string) (int64, error) {
+	ctx, span := logger.StartSpan(ctx, "models.ChangeCategoryType")
+	defer span.End()
+
+	logger.Info(ctx, "Change category type", "user_id", userID, "name", name, "type", newType)
+
+	if !IsValidCategoryType(newType) {
+		return 0, ErrInvalidCategoryType
+	}
+
+	var retyped int64
+	err := db.WithTx(ctx, func(tx *sql.Tx) error {
+		var categoryID int
+		var oldType string
+		if err := tx.QueryRowContext(ctx, `
+            SELECT id, type FROM categories WHERE user_id = $1 AND name = $2 FOR UPDATE
+        `, userID, name).Scan(&categoryID, &oldType); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrCategoryNotFound
+			}
+			return err
+		}
+		if oldType == newType {
+			return ErrCategoryTypeUnchanged
+		}
+
+		// Counted first, since the rows are retyped by the trigger rather than this statement
+		if err := tx.QueryRowContext(ctx, `
+            SELECT
+                (SELECT COUNT(*) FROM transactions
+                 WHERE category_id = $1 AND type <> $2 AND NOT type_overridden AND deleted_at IS NULL)
+              + (SELECT COUNT(*) FROM archived_transactions
+                 WHERE category_id = $1 AND type <> $2 AND NOT type_overridden)
+        `, categoryID, newType).Scan(&retyped); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+            UPDATE categories SET type = $1 WHERE id = $2
+        `, newType, categoryID); err != nil {
+			return err
+		}
+
+		// Only expense categories have budgets
+		if newType != "支出" {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM budgets WHERE category_id = $1`, categoryID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		logger.Warn(ctx, "Failed to change category type", "name", name, "type", newType, "error", err.Error())
+		return 0, err
+	}
+
+	logger.Info(ctx, "Category type changed successfully", "name", name, "type", newType, "retyped", retyped)
+	return retyped, nil
+}
+
 // DeleteCategory deletes a category
 func DeleteCategory(ctx context.Context, userID, name string) (bool, error) {
 	ctx, span := logger.StartSpan(ctx, "models.DeleteCategory")
@@ -82,6 +179,35 @@ func DeleteCategory(ctx context.Context, userID, name string) (bool, error) {
 	return true, nil
 }
 
+// CountTransactionsByCategory counts the user's transactions in a category, archived ones
+// included, i.e. every row deleting the category would cascade to
+func CountTransactionsByCategory(ctx context.Context, userID, name string) (int, error) {
+	ctx, span := logger.StartSpan(ctx, "models.CountTransactionsByCategory")
+	defer span.End()
+
+	logger.Info(ctx, "Count transactions by category", "user_id", userID, "name", name)
+
+	var count int
+	err := db.QueryRowContext(ctx, `
+        SELECT
+            (SELECT COUNT(*) FROM transactions t WHERE t.category_id = c.id AND t.deleted_at IS NULL) +
+            (SELECT COUNT(*) FROM archived_transactions a WHERE a.category_id = c.id)
+        FROM categories c
+        WHERE c.user_id = $1 AND c.name = $2
+    `, userID, name).Scan(&count)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to count transactions by category", "error", err.Error())
+		return 0, err
+	}
+
+	logger.Info(ctx, "Transactions counted", "name", name, "count", count)
+	return count, nil
+}
+
 // CheckCategoryExists checks if a category already exists
 func CheckCategoryExists(ctx context.Context, userID, name, typeName string) (bool, error) {
 	ctx, span := logger.StartSpan(ctx, "models.CheckCategoryExists")
@@ -159,6 +285,43 @@ func GetCategoryIdAndType(ctx context.Context, userID, name string) (int, string
 	return id, typeName, nil
 }
 
+// GetCategoryMonthTotal gets the total amount and number of the user's DefaultCurrency
+// transactions in a category during the month containing month. Month boundaries follow
+// month's location.
+func GetCategoryMonthTotal(ctx context.Context, userID, categoryName string, month time.Time) (total, count int, err error) {
+	ctx, span := logger.StartSpan(ctx, "models.GetCategoryMonthTotal")
+	defer span.End()
+
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, month.Location())
+	end := start.AddDate(0, 1, 0)
+
+	logger.Info(ctx, "Get category month total", "user_id", userID, "category", categoryName, "start", start)
+
+	// The LEFT JOIN yields a row with zero totals for an existing category without
+	// transactions, and no row at all for a missing one
+	err = db.QueryRowContext(ctx, `
+        SELECT COALESCE(SUM(t.amount), 0), COUNT(t.id)
+        FROM categories c
+        LEFT JOIN transactions t
+            ON t.category_id = c.id AND t.created_at >= $3 AND t.created_at < $4
+            AND t.deleted_at IS NULL AND t.currency = $5
+        WHERE c.user_id = $1 AND c.name = $2
+        GROUP BY c.id
+    `, userID, categoryName, start, end, DefaultCurrency).Scan(&total, &count)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn(ctx, "Category does not exist", "name", categoryName)
+		return 0, 0, ErrCategoryNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to get category month total", "error", err.Error())
+		return 0, 0, err
+	}
+
+	logger.Info(ctx, "Category month total fetched", "total", total, "count", count)
+	return total, count, nil
+}
+
 // GetCategoriesInfo gets all category info for a user, returns map[category_name]type
 func GetCategoriesInfo(ctx context.Context, userID string) (map[string]string, error) {
 	ctx, span := logger.StartSpan(ctx, "models.GetCategoriesInfo")
@@ -189,3 +352,146 @@ func GetCategoriesInfo(ctx context.Context, userID string) (map[string]string, e
 	logger.Info(ctx, "Categories info fetched", "count", len(categoriesInfo))
 	return categoriesInfo, nil
 }
+
+// MergeResult counts what MergeCategories moved to the target category
+type MergeResult struct {
+	Transactions int64 // active and archived
+	Recurring    int64
+}
+
+// MergeCategories moves every transaction, archived ones included, and every recurring
+// transaction from the source category to the target category and deletes the source, all
+// in one database transaction. Both categories must exist and share the same type. The
+// source's budget is dropped along with it.
+func MergeCategories(ctx context.Context, userID, sourceName, targetName string) (MergeResult, error) {
+	ctx, span := logger.StartSpan(ctx, "models.MergeCategories")
+	defer span.End()
+
+	logger.Info(ctx, "Merge categories", "user_id", userID, "source", sourceName, "target", targetName)
+
+	if sourceName == targetName {
+		return MergeResult{}, ErrSameCategory
+	}
+
+	var moved MergeResult
+	err := db.WithTx(ctx, func(tx *sql.Tx) error {
+		var sourceID, targetID int
+		var sourceType, targetType string
+
+		lookup := `SELECT id, type FROM categories WHERE user_id = $1 AND name = $2 FOR UPDATE`
+		if err := tx.QueryRowContext(ctx, lookup, userID, sourceName).Scan(&sourceID, &sourceType); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrCategoryNotFound
+			}
+			return err
+		}
+		if err := tx.QueryRowContext(ctx, lookup, userID, targetName).Scan(&targetID, &targetType); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrCategoryNotFound
+			}
+			return err
+		}
+
+		if sourceType != targetType {
+			return ErrCategoryTypeDiffers
+		}
+
+		result, err := tx.ExecContext(ctx, `
+            UPDATE transactions SET category_id = $1 WHERE user_id = $2 AND category_id = $3
+        `, targetID, userID, sourceID)
+		if err != nil {
+			return err
+		}
+		moved.Transactions, _ = result.RowsAffected()
+
+		// Archived rows cascade with the category, so they have to follow the merge too
+		result, err = tx.ExecContext(ctx, `
+            UPDATE archived_transactions SET category_id = $1 WHERE user_id = $2 AND category_id = $3
+        `, targetID, userID, sourceID)
+		if err != nil {
+			return err
+		}
+		archived, _ := result.RowsAffected()
+		moved.Transactions += archived
+
+		result, err = tx.ExecContext(ctx, `
+            UPDATE recurring_transactions SET category_id = $1 WHERE user_id = $2 AND category_id = $3
+        `, targetID, userID, sourceID)
+		if err != nil {
+			return err
+		}
+		moved.Recurring, _ = result.RowsAffected()
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM categories WHERE id = $1`, sourceID)
+		return err
+	})
+
+	if err != nil {
+		logger.Warn(ctx, "Failed to merge categories", "source", sourceName, "target", targetName, "error", err.Error())
+		return MergeResult{}, err
+	}
+
+	logger.Info(ctx, "Categories merged successfully", "source", sourceName, "target", targetName,
+		"moved", moved.Transactions, "recurring", moved.Recurring)
+	return moved, nil
+}
+
+// DefaultCategories is the starter set of categories offered to new users, in display order
+var DefaultCategories = []Category{
+	{Name: "薪資", Type: "收入"},
+	{Name: "獎金", Type: "收入"},
+	{Name: "餐費", Type: "支出"},
+	{Name: "交通", Type: "支出"},
+	{Name: "娛樂", Type: "支出"},
+	{Name: "日用品", Type: "支出"},
+}
+
+// SeedDefaultCategories inserts DefaultCategories for the user in a single statement,
+// skipping names the user already has. It returns the names created and the names skipped.
+func SeedDefaultCategories(ctx context.Context, userID string) (created, skipped []string, err error) {
+	ctx, span := logger.StartSpan(ctx, "models.SeedDefaultCategories")
+	defer span.End()
+
+	logger.Info(ctx, "Seed default categories", "user_id", userID)
+
+	names := make([]string, len(DefaultCategories))
+	types := make([]string, len(DefaultCategories))
+	for i, c := range DefaultCategories {
+		names[i] = c.Name
+		types[i] = c.Type
+	}
+
+	rows, err := db.QueryContext(ctx, `
+        INSERT INTO categories (user_id, name, type)
+        SELECT $1, d.name, d.type
+        FROM unnest($2::text[], $3::text[]) AS d(name, type)
+        ON CONFLICT (user_id, name) DO NOTHING
+        RETURNING name
+    `, userID, pq.Array(names), pq.Array(types))
+	if err != nil {
+		logger.Error(ctx, "Failed to seed default categories", "error", err.Error())
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	inserted := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			logger.Error(ctx, "Failed to parse seeded category", "error", err.Error())
+			return nil, nil, err
+		}
+		inserted[name] = true
+	}
+
+	for _, name := range names {
+		if inserted[name] {
+			created = append(created, name)
+		} else {
+			skipped = append(skipped, name)
+		}
+	}
+
+	logger.Info(ctx, "Default categories seeded", "created", len(created), "skipped", len(skipped))
+	return created, skipped, nil
+}
@@ -0,0 +1,25 @@
+package model
+
+import "strings"
+
+// DefaultCurrency is the currency of transactions recorded without one
+const DefaultCurrency = "TWD"
+
+// supportedCurrencies are the ISO 4217 codes accepted after an amount, e.g. "餐費 20 USD"
+var supportedCurrencies = map[string]bool{
+	"TWD": true, "USD": true, "JPY": true, "EUR": true, "CNY": true, "HKD": true, "KRW": true,
+	"GBP": true, "AUD": true, "CAD": true, "SGD": true, "THB": true, "MYR": true, "VND": true,
+}
+
+// CurrencyTotals are the income and expense totals in one currency
+type CurrencyTotals struct {
+	Income  int
+	Expense int
+}
+
+// NormalizeCurrency returns the upper-case code of a supported currency, and false for
+// anything else
+func NormalizeCurrency(s string) (string, bool) {
+	code := strings.ToUpper(s)
+	return code, supportedCurrencies[code]
+}
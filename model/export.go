@@ -0,0 +1,61 @@
+package model
+
+import (
+	"accountingbot/logger"
+	"context"
+	"encoding/csv"
+	"strings"
+	"time"
+)
+
+// csvHeader is the header row of exported transactions
+var csvHeader = []string{"date", "type", "category", "amount", "currency", "note"}
+
+// ExportTransactionsCSV exports the user's transactions created in [start, end) as CSV,
+// with dates in start's location
+func ExportTransactionsCSV(ctx context.Context, userID string, start, end time.Time) (string, error) {
+	ctx, span := logger.StartSpan(ctx, "models.ExportTransactionsCSV")
+	defer span.End()
+
+	logger.Info(ctx, "Export transactions", "user_id", userID, "start", start, "end", end)
+
+	details, err := GetTransactionDetails(ctx, userID, start, end)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := formatTransactionsCSV(details, start.Location())
+	if err != nil {
+		logger.Error(ctx, "Failed to write CSV", "error", err.Error())
+		return "", err
+	}
+
+	logger.Info(ctx, "Transactions exported", "rows", len(details), "bytes", len(out))
+	return out, nil
+}
+
+// formatTransactionsCSV writes the header and one row per transaction, with dates in loc
+func formatTransactionsCSV(details []TransactionDetail, loc *time.Location) (string, error) {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+
+	if err := w.Write(csvHeader); err != nil {
+		return "", err
+	}
+	for _, d := range details {
+		record := []string{
+			d.CreatedAt.In(loc).Format("2006-01-02"),
+			d.Type,
+			d.Category,
+			FormatAmount(d.Amount),
+			d.Currency,
+			d.Note,
+		}
+		if err := w.Write(record); err != nil {
+			return "", err
+		}
+	}
+
+	w.Flush()
+	return b.String(), w.Error()
+}
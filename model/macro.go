@@ -0,0 +1,79 @@
+package model
+
+import (
+	"accountingbot/db"
+	"accountingbot/logger"
+	"context"
+)
+
+// SetMacro creates or replaces a user-defined shortcut
+func SetMacro(ctx context.Context, userID, name, expansion string) error {
+	ctx, span := logger.StartSpan(ctx, "models.SetMacro")
+	defer span.End()
+
+	logger.Info(ctx, "Set macro", "user_id", userID, "name", name, "expansion", expansion)
+
+	_, err := db.ExecContext(ctx, `
+        INSERT INTO user_macros (user_id, name, expansion) VALUES ($1, $2, $3)
+        ON CONFLICT (user_id, name) DO UPDATE SET expansion = EXCLUDED.expansion
+    `, userID, name, expansion)
+
+	if err != nil {
+		logger.Error(ctx, "Failed to set macro", "error", err.Error())
+		return err
+	}
+
+	logger.Info(ctx, "Macro set successfully", "name", name)
+	return nil
+}
+
+// GetMacros gets all shortcuts of a user, returns map[name]expansion
+func GetMacros(ctx context.Context, userID string) (map[string]string, error) {
+	ctx, span := logger.StartSpan(ctx, "models.GetMacros")
+	defer span.End()
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT name, expansion FROM user_macros WHERE user_id = $1
+    `, userID)
+	if err != nil {
+		logger.Error(ctx, "Failed to query macros", "error", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	macros := make(map[string]string)
+
+	for rows.Next() {
+		var name, expansion string
+		if err := rows.Scan(&name, &expansion); err != nil {
+			logger.Error(ctx, "Failed to parse macro", "error", err.Error())
+			return nil, err
+		}
+		macros[name] = expansion
+	}
+
+	return macros, nil
+}
+
+// DeleteMacro deletes a user-defined shortcut
+func DeleteMacro(ctx context.Context, userID, name string) (bool, error) {
+	ctx, span := logger.StartSpan(ctx, "models.DeleteMacro")
+	defer span.End()
+
+	logger.Info(ctx, "Delete macro", "user_id", userID, "name", name)
+
+	result, err := db.ExecContext(ctx, `DELETE FROM user_macros WHERE user_id = $1 AND name = $2`, userID, name)
+	if err != nil {
+		logger.Error(ctx, "Failed to delete macro", "error", err.Error())
+		return false, err
+	}
+
+	affected, _ := result.RowsAffected()
+	if affected == 0 {
+		logger.Warn(ctx, "Macro to delete not found", "name", name)
+		return false, nil
+	}
+
+	logger.Info(ctx, "Macro deleted successfully", "name", name)
+	return true, nil
+}
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"accountingbot/db"
+	"accountingbot/logger"
+	"context"
+	"database/sql"
+)
+
+// PurgeResult counts what PurgeUserData removed
+type PurgeResult struct {
+	Transactions int64 // active and archived; records already deleted are not counted
+	Categories   int64
+}
+
+// PurgeUserData deletes all of the user's transactions, archived ones included, and all of
+// their categories in one database transaction. Budgets and recurring transactions go with
+// their categories. Settings and macros are kept.
+func PurgeUserData(ctx context.Context, userID string) (PurgeResult, error) {
+	ctx, span := logger.StartSpan(ctx, "models.PurgeUserData")
+	defer span.End()
+
+	logger.Info(ctx, "Purge user data", "user_id", userID)
+
+	var result PurgeResult
+	err := db.WithTx(ctx, func(tx *sql.Tx) error {
+		// Soft-deleted rows are removed too, but they were already gone for the user
+		var active, archived int64
+		if err := tx.QueryRowContext(ctx, `
+            WITH removed AS (
+                DELETE FROM transactions WHERE user_id = $1 RETURNING deleted_at
+            )
+            SELECT COUNT(*) FILTER (WHERE deleted_at IS NULL) FROM removed
+        `, userID).Scan(&active); err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, `DELETE FROM archived_transactions WHERE user_id = $1`, userID)
+		if err != nil {
+			return err
+		}
+		archived, _ = res.RowsAffected()
+
+		res, err = tx.ExecContext(ctx, `DELETE FROM categories WHERE user_id = $1`, userID)
+		if err != nil {
+			return err
+		}
+		result.Categories, _ = res.RowsAffected()
+		result.Transactions = active + archived
+		return nil
+	})
+
+	if err != nil {
+		logger.Error(ctx, "Failed to purge user data", "error", err.Error())
+		return PurgeResult{}, err
+	}
+
+	logger.Info(ctx, "User data purged", "transactions", result.Transactions, "categories", result.Categories)
+	return result, nil
+}
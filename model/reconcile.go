@@ -0,0 +1,80 @@
+package model
+
+import (
+	"accountingbot/db"
+	"accountingbot/logger"
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// TypeCorrection describes a transaction whose stored type drifted from its category's type
+type TypeCorrection struct {
+	ID       int
+	Category string
+	Amount   int
+	From     string
+	To       string
+	Archived bool
+}
+
+// reconciledTables are the tables holding a copy of each category's type
+var reconciledTables = []string{"transactions", "archived_transactions"}
+
+// ReconcileTransactionTypes recomputes the type stored on each of the user's transactions,
+// archived ones included, from its category and fixes any drift. Transactions whose type
+// was overridden on purpose are left alone. It returns the corrections made.
+func ReconcileTransactionTypes(ctx context.Context, userID string) ([]TypeCorrection, error) {
+	ctx, span := logger.StartSpan(ctx, "models.ReconcileTransactionTypes")
+	defer span.End()
+
+	logger.Info(ctx, "Reconcile transaction types", "user_id", userID)
+
+	var corrections []TypeCorrection
+	err := db.WithTx(ctx, func(tx *sql.Tx) error {
+		for _, table := range reconciledTables {
+			// The CTE reads the rows before the update so the old type can be reported
+			rows, err := tx.QueryContext(ctx, fmt.Sprintf(`
+                WITH drifted AS (
+                    SELECT t.id, t.type AS old_type
+                    FROM %[1]s t
+                    JOIN categories c ON t.category_id = c.id
+                    WHERE t.user_id = $1 AND t.type <> c.type AND NOT t.type_overridden
+                    FOR UPDATE OF t
+                )
+                UPDATE %[1]s t
+                SET type = c.type
+                FROM categories c, drifted d
+                WHERE t.id = d.id AND t.category_id = c.id
+                RETURNING t.id, c.name, t.amount, d.old_type, t.type
+            `, table), userID)
+			if err != nil {
+				return err
+			}
+
+			for rows.Next() {
+				c := TypeCorrection{Archived: table == "archived_transactions"}
+				if err := rows.Scan(&c.ID, &c.Category, &c.Amount, &c.From, &c.To); err != nil {
+					rows.Close()
+					return err
+				}
+				corrections = append(corrections, c)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		logger.Error(ctx, "Failed to reconcile transaction types", "error", err.Error())
+		return nil, err
+	}
+
+	if len(corrections) > 0 {
+		logger.Warn(ctx, "Corrected transactions whose type drifted from their category", "count", len(corrections))
+	}
+	return corrections, nil
+}
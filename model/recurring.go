@@ -0,0 +1,229 @@
+package model
+
+import (
+	"accountingbot/config"
+	"accountingbot/db"
+	"accountingbot/logger"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrRecurringNotFound is returned when no matching recurring transaction exists for the user
+var ErrRecurringNotFound = errors.New("recurring transaction not found")
+
+// RecurringTransaction is a fixed monthly item posted as a transaction on its day of the month
+type RecurringTransaction struct {
+	ID         int
+	UserID     string
+	CategoryID int
+	Category   string
+	Type       string
+	Amount     int
+	DayOfMonth int
+	Note       string
+	NextDue    time.Time // midnight in config.Location()
+}
+
+// occurrence returns the posting date in the given month. Days past the end of a short
+// month fall on its last day, so "每月31號" posts on 2/28.
+func occurrence(year int, month time.Month, day int) time.Time {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, config.Location()).Day()
+	return time.Date(year, month, min(day, last), 0, 0, 0, 0, config.Location())
+}
+
+// firstDue returns the first posting date on or after now
+func firstDue(now time.Time, day int) time.Time {
+	now = now.In(config.Location())
+	due := occurrence(now.Year(), now.Month(), day)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, config.Location())
+	if due.Before(today) {
+		due = occurrence(now.Year(), now.Month()+1, day)
+	}
+	return due
+}
+
+// nextDue returns the posting date in the month after due
+func nextDue(due time.Time, day int) time.Time {
+	return occurrence(due.Year(), due.Month()+1, day)
+}
+
+// dateOf reads a DATE column, which the driver returns as midnight UTC, as a local date
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, config.Location())
+}
+
+// AddRecurringTransaction adds a monthly item for the category, first posted on the next
+// dayOfMonth on or after now
+func AddRecurringTransaction(ctx context.Context, userID string, categoryID, amount, dayOfMonth int, note string, now time.Time) (*RecurringTransaction, error) {
+	ctx, span := logger.StartSpan(ctx, "models.AddRecurringTransaction")
+	defer span.End()
+
+	logger.Info(ctx, "Add recurring transaction",
+		"user_id", userID,
+		"category_id", categoryID,
+		"amount", amount,
+		"day_of_month", dayOfMonth,
+		"note", note)
+
+	r := &RecurringTransaction{
+		UserID:     userID,
+		CategoryID: categoryID,
+		Amount:     amount,
+		DayOfMonth: dayOfMonth,
+		Note:       note,
+		NextDue:    firstDue(now, dayOfMonth),
+	}
+
+	err := db.QueryRowContext(ctx, `
+        INSERT INTO recurring_transactions (user_id, category_id, amount, day_of_month, note, next_due)
+        VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+        RETURNING id
+    `, userID, categoryID, amount, dayOfMonth, note, r.NextDue.Format(time.DateOnly)).Scan(&r.ID)
+	if err != nil {
+		logger.Error(ctx, "Failed to add recurring transaction", "error", err.Error())
+		return nil, err
+	}
+
+	logger.Info(ctx, "Recurring transaction added", "id", r.ID, "next_due", r.NextDue)
+	return r, nil
+}
+
+// ListRecurringTransactions gets the user's recurring transactions, by day of the month
+func ListRecurringTransactions(ctx context.Context, userID string) ([]RecurringTransaction, error) {
+	ctx, span := logger.StartSpan(ctx, "models.ListRecurringTransactions")
+	defer span.End()
+
+	logger.Info(ctx, "List recurring transactions", "user_id", userID)
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT r.id, r.user_id, r.category_id, c.name, c.type, r.amount, r.day_of_month,
+            COALESCE(r.note, ''), r.next_due
+        FROM recurring_transactions r
+        JOIN categories c ON r.category_id = c.id
+        WHERE r.user_id = $1
+        ORDER BY r.day_of_month, r.id
+    `, userID)
+	if err != nil {
+		logger.Error(ctx, "Failed to list recurring transactions", "error", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	recurring, err := scanRecurringTransactions(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info(ctx, "Recurring transactions listed", "count", len(recurring))
+	return recurring, nil
+}
+
+// DeleteRecurringTransaction stops one of the user's recurring transactions. Transactions
+// it already posted are kept.
+func DeleteRecurringTransaction(ctx context.Context, userID string, id int) error {
+	ctx, span := logger.StartSpan(ctx, "models.DeleteRecurringTransaction")
+	defer span.End()
+
+	logger.Info(ctx, "Delete recurring transaction", "user_id", userID, "id", id)
+
+	result, err := db.ExecContext(ctx, `
+        DELETE FROM recurring_transactions WHERE id = $1 AND user_id = $2
+    `, id, userID)
+	if err != nil {
+		logger.Error(ctx, "Failed to delete recurring transaction", "error", err.Error())
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		logger.Warn(ctx, "No recurring transaction found to delete", "id", id)
+		return ErrRecurringNotFound
+	}
+
+	logger.Info(ctx, "Recurring transaction deleted", "id", id)
+	return nil
+}
+
+// MaterializeRecurringTransactions posts every recurring transaction due on or before now,
+// for all users. Months missed while the bot was down are posted too, each on its own
+// date. It returns the number of transactions posted.
+func MaterializeRecurringTransactions(ctx context.Context, now time.Time) (int, error) {
+	ctx, span := logger.StartSpan(ctx, "models.MaterializeRecurringTransactions")
+	defer span.End()
+
+	now = now.In(config.Location())
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, config.Location())
+
+	logger.Info(ctx, "Materialize recurring transactions", "today", today)
+
+	posted := 0
+	err := db.WithTx(ctx, func(tx *sql.Tx) error {
+		// Locking the due rows keeps a second instance from posting them at the same time
+		rows, err := tx.QueryContext(ctx, `
+            SELECT r.id, r.user_id, r.category_id, c.name, c.type, r.amount, r.day_of_month,
+                COALESCE(r.note, ''), r.next_due
+            FROM recurring_transactions r
+            JOIN categories c ON r.category_id = c.id
+            WHERE r.next_due <= $1
+            ORDER BY r.id
+            FOR UPDATE OF r SKIP LOCKED
+        `, today.Format(time.DateOnly))
+		if err != nil {
+			return err
+		}
+		due, err := scanRecurringTransactions(ctx, rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, r := range due {
+			next := r.NextDue
+			for !next.After(today) {
+				if _, err := AddTransactionTx(ctx, tx, r.UserID, r.CategoryID, r.Type, r.Amount, r.Note, next); err != nil {
+					return err
+				}
+				posted++
+				next = nextDue(next, r.DayOfMonth)
+			}
+
+			if _, err := tx.ExecContext(ctx, `
+                UPDATE recurring_transactions SET next_due = $1 WHERE id = $2
+            `, next.Format(time.DateOnly), r.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		logger.Error(ctx, "Failed to materialize recurring transactions", "error", err.Error())
+		return 0, err
+	}
+
+	logger.Info(ctx, "Recurring transactions materialized", "posted", posted)
+	return posted, nil
+}
+
+// scanRecurringTransactions reads every row of a recurring transaction query
+func scanRecurringTransactions(ctx context.Context, rows *sql.Rows) ([]RecurringTransaction, error) {
+	var recurring []RecurringTransaction
+
+	for rows.Next() {
+		var r RecurringTransaction
+		if err := rows.Scan(&r.ID, &r.UserID, &r.CategoryID, &r.Category, &r.Type, &r.Amount,
+			&r.DayOfMonth, &r.Note, &r.NextDue); err != nil {
+			logger.Error(ctx, "Failed to parse recurring transaction", "error", err.Error())
+			return nil, err
+		}
+		r.NextDue = dateOf(r.NextDue)
+		recurring = append(recurring, r)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error(ctx, "Failed to iterate recurring transactions", "error", err.Error())
+		return nil, err
+	}
+
+	return recurring, nil
+}
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"accountingbot/db"
+	"accountingbot/logger"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SetRetentionMonths sets how many months of transactions the user keeps in the hot table,
+// 0 turns archiving off
+func SetRetentionMonths(ctx context.Context, userID string, months int) error {
+	ctx, span := logger.StartSpan(ctx, "models.SetRetentionMonths")
+	defer span.End()
+
+	logger.Info(ctx, "Set retention months", "user_id", userID, "months", months)
+
+	_, err := db.ExecContext(ctx, `
+        INSERT INTO user_settings (user_id, retention_months) VALUES ($1, NULLIF($2, 0))
+        ON CONFLICT (user_id) DO UPDATE SET retention_months = EXCLUDED.retention_months
+    `, userID, months)
+
+	if err != nil {
+		logger.Error(ctx, "Failed to set retention months", "error", err.Error())
+		return err
+	}
+
+	logger.Info(ctx, "Retention months set successfully", "months", months)
+	return nil
+}
+
+// GetRetentionMonths gets the user's retention window in months, 0 means not set
+func GetRetentionMonths(ctx context.Context, userID string) (int, error) {
+	ctx, span := logger.StartSpan(ctx, "models.GetRetentionMonths")
+	defer span.End()
+
+	logger.Info(ctx, "Get retention months", "user_id", userID)
+
+	var months sql.NullInt64
+	err := db.QueryRowContext(ctx, `
+        SELECT retention_months FROM user_settings WHERE user_id = $1
+    `, userID).Scan(&months)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to get retention months", "error", err.Error())
+		return 0, err
+	}
+
+	return int(months.Int64), nil
+}
+
+// ArchiveOldTransactions moves every transaction older than its owner's retention window,
+// measured back from now, into archived_transactions. It returns the number of rows moved.
+func ArchiveOldTransactions(ctx context.Context, now time.Time) (int64, error) {
+	ctx, span := logger.StartSpan(ctx, "models.ArchiveOldTransactions")
+	defer span.End()
+
+	logger.Info(ctx, "Archive old transactions", "now", now)
+
+	// Deleting and inserting in one statement keeps each row in exactly one table
+	result, err := db.ExecContext(ctx, `
+        WITH moved AS (
+            DELETE FROM transactions t
+            USING user_settings s
+            WHERE t.user_id = s.user_id
+                AND s.retention_months > 0
+                AND t.created_at < $1::timestamptz - make_interval(months => s.retention_months)
+                AND t.deleted_at IS NULL
+            RETURNING t.id, t.user_id, t.type, t.amount, t.currency, t.category_id, t.note, t.attachment,
+                t.type_overridden, t.created_at
+        )
+        INSERT INTO archived_transactions
+            (id, user_id, type, amount, currency, category_id, note, attachment, type_overridden, created_at)
+        SELECT id, user_id, type, amount, currency, category_id, note, attachment, type_overridden, created_at
+        FROM moved
+    `, now)
+
+	if err != nil {
+		logger.Error(ctx, "Failed to archive old transactions", "error", err.Error())
+		return 0, err
+	}
+
+	archived, err := result.RowsAffected()
+	if err != nil {
+		logger.Error(ctx, "Failed to get archived row count", "error", err.Error())
+		return 0, err
+	}
+
+	logger.Info(ctx, "Old transactions archived", "archived", archived)
+	return archived, nil
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"accountingbot/db"
+	"accountingbot/logger"
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// SetMonthlyBudget sets the user's overall monthly spending cap
+func SetMonthlyBudget(ctx context.Context, userID string, amount int) error {
+	ctx, span := logger.StartSpan(ctx, "models.SetMonthlyBudget")
+	defer span.End()
+
+	logger.Info(ctx, "Set monthly budget", "user_id", userID, "amount", amount)
+
+	_, err := db.ExecContext(ctx, `
+        INSERT INTO user_settings (user_id, monthly_budget) VALUES ($1, $2)
+        ON CONFLICT (user_id) DO UPDATE SET monthly_budget = EXCLUDED.monthly_budget
+    `, userID, amount)
+
+	if err != nil {
+		logger.Error(ctx, "Failed to set monthly budget", "error", err.Error())
+		return err
+	}
+
+	logger.Info(ctx, "Monthly budget set successfully", "amount", amount)
+	return nil
+}
+
+// GetMonthlyBudget gets the user's overall monthly spending cap, 0 means not set
+func GetMonthlyBudget(ctx context.Context, userID string) (int, error) {
+	ctx, span := logger.StartSpan(ctx, "models.GetMonthlyBudget")
+	defer span.End()
+
+	logger.Info(ctx, "Get monthly budget", "user_id", userID)
+
+	var amount sql.NullInt64
+	err := db.QueryRowContext(ctx, `
+        SELECT monthly_budget FROM user_settings WHERE user_id = $1
+    `, userID).Scan(&amount)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to get monthly budget", "error", err.Error())
+		return 0, err
+	}
+
+	return int(amount.Int64), nil
+}
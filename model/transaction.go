@@ -1,28 +1,72 @@
 package model
 
 import (
+	"accountingbot/clock"
 	"accountingbot/db"
 	"accountingbot/logger"
 	"context"
+	"database/sql"
+	"errors"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
+var (
+	// ErrTypeMismatch is returned when a transaction's type differs from its category's type,
+	// or the category belongs to another user
+	ErrTypeMismatch = errors.New("transaction type does not match category type")
+
+	// ErrTransactionNotFound is returned when no matching transaction exists for the user
+	ErrTransactionNotFound = errors.New("transaction not found")
+)
+
+// Clock timestamps new transactions and drives the background jobs. Tests replace it with a
+// clock.Fake to fix the date.
+var Clock clock.Clock = clock.Real{}
+
 type Transaction struct {
-	ID         int       `json:"id" gorm:"column:id;primaryKey"`
-	UserID     string    `json:"user_id" gorm:"column:user_id"`
-	Type       string    `json:"type" gorm:"column:type"`
+	ID     int    `json:"id" gorm:"column:id;primaryKey"`
+	UserID string `json:"user_id" gorm:"column:user_id"`
+	Type   string `json:"type" gorm:"column:type"`
+	// Amount is in cents, see ParseAmount
 	Amount     int       `json:"amount" gorm:"column:amount"`
+	Currency   string    `json:"currency" gorm:"column:currency;default:TWD"`
 	CategoryID int       `json:"category_id" gorm:"column:category_id"`
+	Note       string    `json:"note" gorm:"column:note"`
 	CreatedAt  time.Time `json:"created_at" gorm:"column:created_at;default:CURRENT_TIMESTAMP"`
 }
 
+// TransactionDetail is a transaction together with its category name
+type TransactionDetail struct {
+	ID        int
+	Type      string
+	Category  string
+	Amount    int
+	Currency  string
+	Note      string
+	CreatedAt time.Time
+}
+
 type Summary struct {
-	IncomeTotal    int
-	ExpenseTotal   int
+	IncomeTotal  int
+	ExpenseTotal int
+	// CategoryTotals sums every transaction of a category, whatever its type
 	CategoryTotals map[string]int
+	// IncomeCategoryTotals and ExpenseCategoryTotals split the category totals by
+	// transaction type, so a transaction whose type was overridden is counted
+	// on its own side
+	IncomeCategoryTotals  map[string]int
+	ExpenseCategoryTotals map[string]int
+
+	// The fields above only count DefaultCurrency, so amounts in different currencies are
+	// never added up. Currencies holds the totals of every currency, DefaultCurrency included.
+	Currencies map[string]CurrencyTotals
 }
 
-// GetMonthlySummary now accepts a context parameter
+// GetMonthlySummary gets the summary of the given month's transactions. Totals are split by
+// each transaction's stored type, which follows its category's type unless overridden.
 func GetMonthlySummary(ctx context.Context, userID string, month time.Time) (Summary, error) {
 	ctx, span := logger.StartSpan(ctx, "models.GetMonthlySummary")
 	defer span.End()
@@ -32,46 +76,109 @@ func GetMonthlySummary(ctx context.Context, userID string, month time.Time) (Sum
 		"year", month.Year(),
 		"month", month.Month())
 
-	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	// Month boundaries follow the location of month
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, month.Location())
 	end := start.AddDate(0, 1, 0)
 
+	return GetSummaryByRange(ctx, userID, start, end)
+}
+
+// SummaryFilter narrows down which transactions a summary includes
+type SummaryFilter struct {
+	// ExcludeCategories lists category names left out of the totals
+	ExcludeCategories []string
+
+	// IncludeArchived also counts transactions moved out by the retention policy
+	IncludeArchived bool
+
+	// Type keeps only 收入 or only 支出 transactions when set
+	Type string
+}
+
+// GetSummaryByRange gets the summary of transactions created in [start, end)
+func GetSummaryByRange(ctx context.Context, userID string, start, end time.Time) (Summary, error) {
+	return GetFilteredSummaryByRange(ctx, userID, start, end, SummaryFilter{})
+}
+
+// GetFilteredSummaryByRange gets the summary of transactions created in [start, end)
+// that pass the filter
+func GetFilteredSummaryByRange(ctx context.Context, userID string, start, end time.Time, filter SummaryFilter) (Summary, error) {
+	ctx, span := logger.StartSpan(ctx, "models.GetFilteredSummaryByRange")
+	defer span.End()
+
+	logger.Info(ctx, "Get summary by range",
+		"user_id", userID,
+		"start", start,
+		"end", end,
+		"exclude_categories", filter.ExcludeCategories,
+		"include_archived", filter.IncludeArchived,
+		"type", filter.Type)
+
+	// A nil slice would be sent as NULL, which makes the ANY() check exclude everything
+	excluded := filter.ExcludeCategories
+	if excluded == nil {
+		excluded = []string{}
+	}
+
 	rows, err := db.QueryContext(ctx, `
-        SELECT t.type, c.name, SUM(t.amount)
-        FROM transactions t
+        SELECT t.currency, t.type, c.name, SUM(t.amount)
+        FROM (
+            SELECT type, amount, currency, category_id FROM transactions
+            WHERE user_id = $1 AND created_at >= $2 AND created_at < $3 AND deleted_at IS NULL
+            UNION ALL
+            SELECT type, amount, currency, category_id FROM archived_transactions
+            WHERE $5 AND user_id = $1 AND created_at >= $2 AND created_at < $3
+        ) t
         JOIN categories c ON t.category_id = c.id
-        WHERE t.user_id = $1 AND t.created_at >= $2 AND t.created_at < $3
-        GROUP BY t.type, c.name
-    `, userID, start, end)
+        WHERE NOT (c.name = ANY($4)) AND ($6 = '' OR t.type = $6)
+        GROUP BY t.currency, t.type, c.name
+    `, userID, start, end, pq.Array(excluded), filter.IncludeArchived, filter.Type)
 
 	if err != nil {
-		logger.Error(ctx, "Failed to query monthly summary", "error", err.Error())
+		logger.Error(ctx, "Failed to query summary", "error", err.Error())
 		return Summary{}, err
 	}
 	defer rows.Close()
 
 	summary := Summary{
-		CategoryTotals: make(map[string]int),
+		CategoryTotals:        make(map[string]int),
+		IncomeCategoryTotals:  make(map[string]int),
+		ExpenseCategoryTotals: make(map[string]int),
+		Currencies:            make(map[string]CurrencyTotals),
 	}
 
 	var categories int
 	for rows.Next() {
-		var ttype, categoryName string
+		var currency, ttype, categoryName string
 		var total int
-		if err := rows.Scan(&ttype, &categoryName, &total); err != nil {
-			logger.Error(ctx, "Failed to parse monthly summary data", "error", err.Error())
+		if err := rows.Scan(&currency, &ttype, &categoryName, &total); err != nil {
+			logger.Error(ctx, "Failed to parse summary data", "error", err.Error())
 			return summary, err
 		}
 
-		summary.CategoryTotals[categoryName] = total
+		totals := summary.Currencies[currency]
+		if ttype == "收入" {
+			totals.Income += total
+		} else {
+			totals.Expense += total
+		}
+		summary.Currencies[currency] = totals
+		if currency != DefaultCurrency {
+			continue
+		}
+
+		summary.CategoryTotals[categoryName] += total
 		if ttype == "收入" {
 			summary.IncomeTotal += total
+			summary.IncomeCategoryTotals[categoryName] = total
 		} else {
 			summary.ExpenseTotal += total
+			summary.ExpenseCategoryTotals[categoryName] = total
 		}
 		categories++
 	}
 
-	logger.Info(ctx, "Monthly summary generated",
+	logger.Info(ctx, "Summary generated",
 		"income_total", summary.IncomeTotal,
 		"expense_total", summary.ExpenseTotal,
 		"categories_count", categories)
@@ -79,43 +186,77 @@ func GetMonthlySummary(ctx context.Context, userID string, month time.Time) (Sum
 	return summary, nil
 }
 
-// AddTransaction adds a new transaction record
-func AddTransaction(ctx context.Context, userID string, categoryID int, transType string, amount int) (*Transaction, error) {
-	ctx, span := logger.StartSpan(ctx, "models.AddTransaction")
+// AddTransaction adds a new transaction record with an optional note
+func AddTransaction(ctx context.Context, userID string, categoryID int, transType string, amount int, note string) (*Transaction, error) {
+	return AddTransactionAt(ctx, userID, categoryID, transType, amount, note, Clock.Now())
+}
+
+// AddTransactionAt adds a new transaction record created at the given time
+func AddTransactionAt(ctx context.Context, userID string, categoryID int, transType string, amount int, note string, createdAt time.Time) (*Transaction, error) {
+	return AddTransactionTx(ctx, nil, userID, categoryID, transType, amount, note, createdAt)
+}
+
+// AddTransactionTx adds a new transaction record inside the caller's database transaction.
+// A nil tx runs the insert on its own.
+func AddTransactionTx(ctx context.Context, tx *sql.Tx, userID string, categoryID int, transType string, amount int, note string, createdAt time.Time) (*Transaction, error) {
+	return addTransaction(ctx, tx, userID, categoryID, transType, amount, DefaultCurrency, note, createdAt)
+}
+
+// AddTransactionInCurrency adds a new transaction record in the given currency, created at
+// the given time
+func AddTransactionInCurrency(ctx context.Context, userID string, categoryID int, transType string, amount int, currency, note string, createdAt time.Time) (*Transaction, error) {
+	return addTransaction(ctx, nil, userID, categoryID, transType, amount, currency, note, createdAt)
+}
+
+// addTransaction inserts a transaction record, inside tx when it is not nil
+func addTransaction(ctx context.Context, tx *sql.Tx, userID string, categoryID int, transType string, amount int, currency, note string, createdAt time.Time) (*Transaction, error) {
+	ctx, span := logger.StartSpan(ctx, "models.AddTransactionTx")
 	defer span.End()
 
 	logger.Info(ctx, "Add transaction record",
 		"user_id", userID,
 		"category_id", categoryID,
 		"type", transType,
-		"amount", amount)
+		"amount", amount,
+		"currency", currency,
+		"note", note,
+		"created_at", createdAt)
 
 	transaction := &Transaction{
 		UserID:     userID,
 		CategoryID: categoryID,
 		Type:       transType,
 		Amount:     amount,
-		CreatedAt:  time.Now(),
+		Currency:   currency,
+		Note:       note,
+		CreatedAt:  createdAt,
 	}
 
-	result, err := db.ExecContext(ctx, `
-        INSERT INTO transactions (user_id, category_id, type, amount, created_at)
-        VALUES ($1, $2, $3, $4, $5)
+	queryRow := db.QueryRowContext
+	if tx != nil {
+		queryRow = tx.QueryRowContext
+	}
+
+	// The category must be the user's and the type must match the category's type,
+	// otherwise nothing is inserted
+	err := queryRow(ctx, `
+        INSERT INTO transactions (user_id, category_id, type, amount, note, created_at, currency)
+        SELECT $1, $2, $3, $4, NULLIF($5, ''), $6, $7
+        WHERE EXISTS (SELECT 1 FROM categories WHERE id = $2 AND type = $3 AND user_id = $1)
         RETURNING id
-    `, transaction.UserID, transaction.CategoryID, transaction.Type, transaction.Amount, transaction.CreatedAt)
+    `, transaction.UserID, transaction.CategoryID, transaction.Type, transaction.Amount, transaction.Note, transaction.CreatedAt, transaction.Currency).Scan(&transaction.ID)
 
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn(ctx, "Category is not the user's or its type does not match",
+			"category_id", categoryID,
+			"type", transType)
+		return nil, ErrTypeMismatch
+	}
 	if err != nil {
 		logger.Error(ctx, "Failed to add transaction record", "error", err.Error())
 		return nil, err
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		logger.Warn(ctx, "Cannot get new transaction ID", "error", err.Error())
-	} else {
-		transaction.ID = int(id)
-	}
-
 	logger.Info(ctx, "Transaction record added successfully", "transaction_id", transaction.ID)
 	return transaction, nil
 }
@@ -128,9 +269,9 @@ func GetTransactions(ctx context.Context, userID string, limit int) ([]*Transact
 	logger.Info(ctx, "Query user transactions", "user_id", userID, "limit", limit)
 
 	rows, err := db.QueryContext(ctx, `
-        SELECT id, user_id, type, amount, category_id, created_at
+        SELECT id, user_id, type, amount, currency, category_id, COALESCE(note, ''), created_at
         FROM transactions 
-        WHERE user_id = $1
+        WHERE user_id = $1 AND deleted_at IS NULL
         ORDER BY created_at DESC
         LIMIT $2
     `, userID, limit)
@@ -145,7 +286,7 @@ func GetTransactions(ctx context.Context, userID string, limit int) ([]*Transact
 
 	for rows.Next() {
 		var t Transaction
-		if err := rows.Scan(&t.ID, &t.UserID, &t.Type, &t.Amount, &t.CategoryID, &t.CreatedAt); err != nil {
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Type, &t.Amount, &t.Currency, &t.CategoryID, &t.Note, &t.CreatedAt); err != nil {
 			logger.Error(ctx, "Failed to parse transaction record", "error", err.Error())
 			return nil, err
 		}
@@ -156,6 +297,273 @@ func GetTransactions(ctx context.Context, userID string, limit int) ([]*Transact
 	return transactions, nil
 }
 
+// GetTransactionDetails gets transactions created in [start, end) with their category names, oldest first
+func GetTransactionDetails(ctx context.Context, userID string, start, end time.Time) ([]TransactionDetail, error) {
+	return GetTransactionDetailsWithArchive(ctx, userID, start, end, false)
+}
+
+// GetTransactionDetailsWithArchive gets transactions created in [start, end) like
+// GetTransactionDetails, also listing those moved out by the retention policy when
+// includeArchived is set
+func GetTransactionDetailsWithArchive(ctx context.Context, userID string, start, end time.Time, includeArchived bool) ([]TransactionDetail, error) {
+	ctx, span := logger.StartSpan(ctx, "models.GetTransactionDetailsWithArchive")
+	defer span.End()
+
+	logger.Info(ctx, "Query transaction details", "user_id", userID, "start", start, "end", end,
+		"include_archived", includeArchived)
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT t.id, t.type, c.name, t.amount, t.currency, COALESCE(t.note, ''), t.created_at
+        FROM (
+            SELECT id, type, amount, currency, category_id, note, created_at FROM transactions
+            WHERE user_id = $1 AND created_at >= $2 AND created_at < $3 AND deleted_at IS NULL
+            UNION ALL
+            SELECT id, type, amount, currency, category_id, note, created_at FROM archived_transactions
+            WHERE $4 AND user_id = $1 AND created_at >= $2 AND created_at < $3
+        ) t
+        JOIN categories c ON t.category_id = c.id
+        ORDER BY t.created_at, t.id
+    `, userID, start, end, includeArchived)
+
+	if err != nil {
+		logger.Error(ctx, "Failed to query transaction details", "error", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	details, err := scanTransactionDetails(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info(ctx, "Transaction details query completed", "count", len(details))
+	return details, nil
+}
+
+// GetLargeTransactions gets the user's transactions created in [start, end) whose amount
+// is at least minAmount, largest first
+func GetLargeTransactions(ctx context.Context, userID string, start, end time.Time, minAmount int) ([]TransactionDetail, error) {
+	ctx, span := logger.StartSpan(ctx, "models.GetLargeTransactions")
+	defer span.End()
+
+	logger.Info(ctx, "Query large transactions", "user_id", userID, "start", start, "end", end, "min_amount", minAmount)
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT t.id, t.type, c.name, t.amount, t.currency, COALESCE(t.note, ''), t.created_at
+        FROM transactions t
+        JOIN categories c ON t.category_id = c.id
+        WHERE t.user_id = $1 AND t.created_at >= $2 AND t.created_at < $3 AND t.amount >= $4
+            AND t.deleted_at IS NULL
+        ORDER BY t.amount DESC, t.created_at, t.id
+    `, userID, start, end, minAmount)
+
+	if err != nil {
+		logger.Error(ctx, "Failed to query large transactions", "error", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	details, err := scanTransactionDetails(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info(ctx, "Large transactions query completed", "count", len(details))
+	return details, nil
+}
+
+// GetTransactionsWithoutNote gets the user's transactions between start and end that have no
+// note, oldest first
+func GetTransactionsWithoutNote(ctx context.Context, userID string, start, end time.Time) ([]TransactionDetail, error) {
+	ctx, span := logger.StartSpan(ctx, "models.GetTransactionsWithoutNote")
+	defer span.End()
+
+	logger.Info(ctx, "Query transactions without note", "user_id", userID, "start", start, "end", end)
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT t.id, t.type, c.name, t.amount, t.currency, '', t.created_at
+        FROM transactions t
+        JOIN categories c ON t.category_id = c.id
+        WHERE t.user_id = $1 AND t.created_at >= $2 AND t.created_at < $3
+            AND (t.note IS NULL OR t.note = '') AND t.deleted_at IS NULL
+        ORDER BY t.created_at, t.id
+    `, userID, start, end)
+
+	if err != nil {
+		logger.Error(ctx, "Failed to query transactions without note", "error", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	details, err := scanTransactionDetails(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info(ctx, "Transactions without note query completed", "count", len(details))
+	return details, nil
+}
+
+// FindTransactionsByAmountRange gets the user's transactions whose amount is between
+// minAmount and maxAmount inclusive, largest first. A maxAmount of 0 leaves the range open
+// ended and an empty category matches every category. Only DefaultCurrency amounts are
+// compared, since amounts in different currencies are not comparable.
+func FindTransactionsByAmountRange(ctx context.Context, userID string, minAmount, maxAmount int, category string) ([]TransactionDetail, error) {
+	ctx, span := logger.StartSpan(ctx, "models.FindTransactionsByAmountRange")
+	defer span.End()
+
+	logger.Info(ctx, "Query transactions by amount range", "user_id", userID,
+		"min_amount", minAmount, "max_amount", maxAmount, "category", category)
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT t.id, t.type, c.name, t.amount, t.currency, COALESCE(t.note, ''), t.created_at
+        FROM transactions t
+        JOIN categories c ON t.category_id = c.id
+        WHERE t.user_id = $1 AND t.amount >= $2 AND ($3 = 0 OR t.amount <= $3)
+            AND ($4 = '' OR c.name = $4) AND t.currency = $5 AND t.deleted_at IS NULL
+        ORDER BY t.amount DESC, t.created_at DESC, t.id DESC
+    `, userID, minAmount, maxAmount, category, DefaultCurrency)
+	if err != nil {
+		logger.Error(ctx, "Failed to query transactions by amount range", "error", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	details, err := scanTransactionDetails(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info(ctx, "Amount range query completed", "count", len(details))
+	return details, nil
+}
+
+// likeEscaper escapes the LIKE wildcards in a search query so they match literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchTransactions gets up to limit of the user's transactions whose note contains query,
+// ignoring case, newest first. Archived transactions are searched too. more reports whether
+// further matches were left out.
+func SearchTransactions(ctx context.Context, userID, query string, limit int) (details []TransactionDetail, more bool, err error) {
+	ctx, span := logger.StartSpan(ctx, "models.SearchTransactions")
+	defer span.End()
+
+	logger.Info(ctx, "Search transactions", "user_id", userID, "query", query, "limit", limit)
+
+	// One extra row tells whether there are more matches than the limit
+	rows, err := db.QueryContext(ctx, `
+        SELECT t.id, t.type, c.name, t.amount, t.currency, t.note, t.created_at
+        FROM (
+            SELECT id, type, amount, currency, category_id, note, created_at FROM transactions
+            WHERE user_id = $1 AND deleted_at IS NULL
+            UNION ALL
+            SELECT id, type, amount, currency, category_id, note, created_at FROM archived_transactions
+            WHERE user_id = $1
+        ) t
+        JOIN categories c ON t.category_id = c.id
+        WHERE t.note ILIKE '%' || $2 || '%'
+        ORDER BY t.created_at DESC, t.id DESC
+        LIMIT $3
+    `, userID, likeEscaper.Replace(query), limit+1)
+	if err != nil {
+		logger.Error(ctx, "Failed to search transactions", "error", err.Error())
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	details, err = scanTransactionDetails(ctx, rows)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(details) > limit {
+		details, more = details[:limit], true
+	}
+
+	logger.Info(ctx, "Transaction search completed", "count", len(details), "more", more)
+	return details, more, nil
+}
+
+// scanTransactionDetails reads every row of a transaction detail query
+func scanTransactionDetails(ctx context.Context, rows *sql.Rows) ([]TransactionDetail, error) {
+	var details []TransactionDetail
+
+	for rows.Next() {
+		var d TransactionDetail
+		if err := rows.Scan(&d.ID, &d.Type, &d.Category, &d.Amount, &d.Currency, &d.Note, &d.CreatedAt); err != nil {
+			logger.Error(ctx, "Failed to parse transaction detail", "error", err.Error())
+			return nil, err
+		}
+		details = append(details, d)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error(ctx, "Failed to iterate transaction details", "error", err.Error())
+		return nil, err
+	}
+
+	return details, nil
+}
+
+// GetExpenseTimes gets the creation times of the user's expenses created in [start, end),
+// oldest first
+func GetExpenseTimes(ctx context.Context, userID string, start, end time.Time) ([]time.Time, error) {
+	ctx, span := logger.StartSpan(ctx, "models.GetExpenseTimes")
+	defer span.End()
+
+	logger.Info(ctx, "Get expense times", "user_id", userID, "start", start, "end", end)
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT created_at
+        FROM transactions
+        WHERE user_id = $1 AND type = '支出' AND created_at >= $2 AND created_at < $3
+            AND deleted_at IS NULL
+        ORDER BY created_at
+    `, userID, start, end)
+	if err != nil {
+		logger.Error(ctx, "Failed to query expense times", "error", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var times []time.Time
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			logger.Error(ctx, "Failed to parse expense time", "error", err.Error())
+			return nil, err
+		}
+		times = append(times, t)
+	}
+
+	logger.Info(ctx, "Expense times fetched", "count", len(times))
+	return times, nil
+}
+
+// GetTransactionByID gets a transaction record owned by the user
+func GetTransactionByID(ctx context.Context, userID string, id int) (*Transaction, error) {
+	ctx, span := logger.StartSpan(ctx, "models.GetTransactionByID")
+	defer span.End()
+
+	logger.Info(ctx, "Get transaction by ID", "user_id", userID, "id", id)
+
+	var t Transaction
+	err := db.QueryRowContext(ctx, `
+        SELECT id, user_id, type, amount, currency, category_id, COALESCE(note, ''), created_at
+        FROM transactions
+        WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+    `, id, userID).Scan(&t.ID, &t.UserID, &t.Type, &t.Amount, &t.Currency, &t.CategoryID, &t.Note, &t.CreatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn(ctx, "Transaction not found", "id", id)
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to get transaction", "error", err.Error())
+		return nil, err
+	}
+
+	return &t, nil
+}
+
 // UpdateTransaction updates a transaction record
 func UpdateTransaction(ctx context.Context, id int, amount int) error {
 	ctx, span := logger.StartSpan(ctx, "models.UpdateTransaction")
@@ -163,7 +571,7 @@ func UpdateTransaction(ctx context.Context, id int, amount int) error {
 
 	logger.Info(ctx, "Update transaction record", "id", id, "new_amount", amount)
 
-	result, err := db.ExecContext(ctx, `UPDATE transactions SET amount = $1 WHERE id = $2`, amount, id)
+	result, err := db.ExecContext(ctx, `UPDATE transactions SET amount = $1 WHERE id = $2 AND deleted_at IS NULL`, amount, id)
 	if err != nil {
 		logger.Error(ctx, "Failed to update transaction record", "error", err.Error())
 		return err
@@ -179,14 +587,81 @@ func UpdateTransaction(ctx context.Context, id int, amount int) error {
 	return nil
 }
 
-// DeleteTransaction deletes a transaction record
+// UpdateTransactionType sets the type of a single transaction without touching its category.
+// The transaction is flagged as overridden when the type differs from the category's type,
+// so the categories trigger and ReconcileTransactionTypes leave it alone.
+func UpdateTransactionType(ctx context.Context, userID string, id int, transType string) (*TransactionDetail, error) {
+	ctx, span := logger.StartSpan(ctx, "models.UpdateTransactionType")
+	defer span.End()
+
+	logger.Info(ctx, "Update transaction type", "user_id", userID, "id", id, "type", transType)
+
+	var d TransactionDetail
+	err := db.QueryRowContext(ctx, `
+        UPDATE transactions t
+        SET type = $3, type_overridden = ($3 <> c.type)
+        FROM categories c
+        WHERE t.category_id = c.id AND t.id = $1 AND t.user_id = $2 AND t.deleted_at IS NULL
+        RETURNING t.id, t.type, c.name, t.amount, t.currency, COALESCE(t.note, ''), t.created_at
+    `, id, userID, transType).Scan(&d.ID, &d.Type, &d.Category, &d.Amount, &d.Currency, &d.Note, &d.CreatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn(ctx, "Transaction not found", "id", id)
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to update transaction type", "error", err.Error())
+		return nil, err
+	}
+
+	logger.Info(ctx, "Transaction type updated", "id", id, "type", transType)
+	return &d, nil
+}
+
+// CopyTransaction adds a new record with the same category, type, amount, currency and note
+// as one of the user's transactions, created at the given time. An overridden type is copied
+// along with its flag; otherwise the type must still match the category's type.
+func CopyTransaction(ctx context.Context, userID string, id int, createdAt time.Time) (*Transaction, error) {
+	ctx, span := logger.StartSpan(ctx, "models.CopyTransaction")
+	defer span.End()
+
+	logger.Info(ctx, "Copy transaction record", "user_id", userID, "id", id, "created_at", createdAt)
+
+	var t Transaction
+	err := db.QueryRowContext(ctx, `
+        INSERT INTO transactions (user_id, category_id, type, amount, note, created_at, currency, type_overridden)
+        SELECT t.user_id, t.category_id, t.type, t.amount, t.note, $3, t.currency, t.type_overridden
+        FROM transactions t
+        JOIN categories c ON c.id = t.category_id
+        WHERE t.id = $1 AND t.user_id = $2 AND t.deleted_at IS NULL
+          AND (t.type_overridden OR c.type = t.type)
+        RETURNING id, user_id, type, amount, currency, category_id, COALESCE(note, ''), created_at
+    `, id, userID, createdAt).Scan(&t.ID, &t.UserID, &t.Type, &t.Amount, &t.Currency, &t.CategoryID, &t.Note, &t.CreatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn(ctx, "Transaction not found", "id", id)
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to copy transaction record", "error", err.Error())
+		return nil, err
+	}
+
+	logger.Info(ctx, "Transaction record copied successfully", "id", id, "new_id", t.ID)
+	return &t, nil
+}
+
+// DeleteTransaction soft-deletes a transaction record, so it can still be restored with
+// RestoreTransaction
 func DeleteTransaction(ctx context.Context, id int) error {
 	ctx, span := logger.StartSpan(ctx, "models.DeleteTransaction")
 	defer span.End()
 
 	logger.Info(ctx, "Delete transaction record", "id", id)
 
-	result, err := db.ExecContext(ctx, `DELETE FROM transactions WHERE id = $1`, id)
+	result, err := db.ExecContext(ctx, `
+        UPDATE transactions SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL
+    `, id)
 	if err != nil {
 		logger.Error(ctx, "Failed to delete transaction record", "error", err.Error())
 		return err
@@ -202,33 +677,192 @@ func DeleteTransaction(ctx context.Context, id int) error {
 	return nil
 }
 
-// FindTransactionID finds a transaction record by user ID, category name, and amount
-func FindTransactionID(ctx context.Context, userID, categoryName string, amount int) (int, error) {
-	ctx, span := logger.StartSpan(ctx, "models.FindTransactionID")
+// FindTransactionIDs finds all transaction records matching the user ID, category name, and amount,
+// most recent first
+func FindTransactionIDs(ctx context.Context, userID, categoryName string, amount int) ([]int, error) {
+	ctx, span := logger.StartSpan(ctx, "models.FindTransactionIDs")
 	defer span.End()
 
-	logger.Info(ctx, "Query transaction record ID",
+	logger.Info(ctx, "Query transaction record IDs",
 		"user_id", userID,
 		"category", categoryName,
 		"amount", amount)
 
-	var transactionID int
-	err := db.QueryRowContext(ctx, `
-        SELECT t.id 
+	rows, err := db.QueryContext(ctx, `
+        SELECT t.id
         FROM transactions t
         JOIN categories c ON t.category_id = c.id
-        WHERE t.user_id = $1 AND c.name = $2 AND t.amount = $3
+        WHERE t.user_id = $1 AND c.name = $2 AND t.amount = $3 AND t.deleted_at IS NULL
+        ORDER BY t.created_at DESC, t.id DESC
+    `, userID, categoryName, amount)
+	if err != nil {
+		logger.Error(ctx, "Failed to query transaction records", "error", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			logger.Error(ctx, "Failed to parse transaction ID", "error", err.Error())
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	logger.Info(ctx, "Transaction records found", "count", len(ids))
+	return ids, nil
+}
+
+// DeleteLastTransaction soft-deletes the user's most recently recorded transaction and returns it
+func DeleteLastTransaction(ctx context.Context, userID string) (*TransactionDetail, error) {
+	ctx, span := logger.StartSpan(ctx, "models.DeleteLastTransaction")
+	defer span.End()
+
+	logger.Info(ctx, "Delete last transaction", "user_id", userID)
+
+	var d TransactionDetail
+	err := db.QueryRowContext(ctx, `
+        UPDATE transactions t
+        SET deleted_at = CURRENT_TIMESTAMP
+        FROM categories c
+        WHERE t.category_id = c.id AND t.id = (
+            SELECT id FROM transactions
+            WHERE user_id = $1 AND deleted_at IS NULL
+            ORDER BY created_at DESC, id DESC
+            LIMIT 1
+        )
+        RETURNING t.id, t.type, c.name, t.amount, t.currency, COALESCE(t.note, ''), t.created_at
+    `, userID).Scan(&d.ID, &d.Type, &d.Category, &d.Amount, &d.Currency, &d.Note, &d.CreatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn(ctx, "No transaction to delete")
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to delete last transaction", "error", err.Error())
+		return nil, err
+	}
+
+	logger.Info(ctx, "Last transaction deleted", "transaction_id", d.ID)
+	return &d, nil
+}
+
+// RestoreTransaction undoes the soft delete of a user's transaction, as long as it was
+// deleted at or after since
+func RestoreTransaction(ctx context.Context, userID string, id int, since time.Time) (*TransactionDetail, error) {
+	ctx, span := logger.StartSpan(ctx, "models.RestoreTransaction")
+	defer span.End()
+
+	logger.Info(ctx, "Restore transaction", "user_id", userID, "id", id, "since", since)
+
+	var d TransactionDetail
+	err := db.QueryRowContext(ctx, `
+        UPDATE transactions t
+        SET deleted_at = NULL
+        FROM categories c
+        WHERE t.category_id = c.id AND t.id = $1 AND t.user_id = $2 AND t.deleted_at >= $3
+        RETURNING t.id, t.type, c.name, t.amount, t.currency, COALESCE(t.note, ''), t.created_at
+    `, id, userID, since).Scan(&d.ID, &d.Type, &d.Category, &d.Amount, &d.Currency, &d.Note, &d.CreatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn(ctx, "No restorable transaction", "id", id, "since", since)
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to restore transaction", "error", err.Error())
+		return nil, err
+	}
+
+	logger.Info(ctx, "Transaction restored", "transaction_id", d.ID)
+	return &d, nil
+}
+
+// RestoreLastTransaction undoes the user's most recent soft delete, as long as it happened
+// at or after since
+func RestoreLastTransaction(ctx context.Context, userID string, since time.Time) (*TransactionDetail, error) {
+	ctx, span := logger.StartSpan(ctx, "models.RestoreLastTransaction")
+	defer span.End()
+
+	logger.Info(ctx, "Restore last transaction", "user_id", userID, "since", since)
+
+	var id int
+	err := db.QueryRowContext(ctx, `
+        SELECT id FROM transactions
+        WHERE user_id = $1 AND deleted_at >= $2
+        ORDER BY deleted_at DESC, id DESC
         LIMIT 1
-    `, userID, categoryName, amount).Scan(&transactionID)
+    `, userID, since).Scan(&id)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn(ctx, "No recently deleted transaction", "since", since)
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to find last deleted transaction", "error", err.Error())
+		return nil, err
+	}
+
+	return RestoreTransaction(ctx, userID, id, since)
+}
+
+// AttachToLatestTransaction stores an attachment reference on the user's most recently
+// recorded transaction, as long as it was created at or after since
+func AttachToLatestTransaction(ctx context.Context, userID, attachment string, since time.Time) (*TransactionDetail, error) {
+	ctx, span := logger.StartSpan(ctx, "models.AttachToLatestTransaction")
+	defer span.End()
+
+	logger.Info(ctx, "Attach to latest transaction", "user_id", userID, "attachment", attachment, "since", since)
+
+	var d TransactionDetail
+	err := db.QueryRowContext(ctx, `
+        UPDATE transactions t
+        SET attachment = $2
+        FROM categories c
+        WHERE t.category_id = c.id AND t.id = (
+            SELECT id FROM transactions
+            WHERE user_id = $1 AND created_at >= $3 AND deleted_at IS NULL
+            ORDER BY created_at DESC, id DESC
+            LIMIT 1
+        )
+        RETURNING t.id, t.type, c.name, t.amount, t.currency, COALESCE(t.note, ''), t.created_at
+    `, userID, attachment, since).Scan(&d.ID, &d.Type, &d.Category, &d.Amount, &d.Currency, &d.Note, &d.CreatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn(ctx, "No recent transaction to attach to", "since", since)
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		logger.Error(ctx, "Failed to attach to transaction", "error", err.Error())
+		return nil, err
+	}
 
+	logger.Info(ctx, "Attachment stored", "transaction_id", d.ID)
+	return &d, nil
+}
+
+// GetTransactionAttachment gets the attachment reference of a user's transaction
+func GetTransactionAttachment(ctx context.Context, userID string, id int) (string, error) {
+	ctx, span := logger.StartSpan(ctx, "models.GetTransactionAttachment")
+	defer span.End()
+
+	logger.Info(ctx, "Get transaction attachment", "user_id", userID, "id", id)
+
+	var attachment string
+	err := db.QueryRowContext(ctx, `
+        SELECT COALESCE(attachment, '') FROM transactions
+        WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+    `, id, userID).Scan(&attachment)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn(ctx, "Transaction not found", "id", id)
+		return "", ErrTransactionNotFound
+	}
 	if err != nil {
-		logger.Warn(ctx, "No matching transaction record found",
-			"category", categoryName,
-			"amount", amount,
-			"error", err.Error())
-		return 0, err
+		logger.Error(ctx, "Failed to get transaction attachment", "error", err.Error())
+		return "", err
 	}
 
-	logger.Info(ctx, "Transaction record found", "transaction_id", transactionID)
-	return transactionID, nil
+	return attachment, nil
 }
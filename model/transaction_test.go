@@ -0,0 +1,1256 @@
+package model
+
+import (
+	"accountingbot/clock"
+	"accountingbot/config"
+	"accountingbot/db"
+	"accountingbot/logger"
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+
+	shutdown := logger.Init()
+	testDBName := db.SetupTestDB(ctx)
+
+	code := m.Run()
+
+	db.CleanupTestDB(ctx, testDBName)
+	if shutdown != nil {
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		_ = shutdown(ctx)
+	}
+	os.Exit(code)
+}
+
+func TestTransactionTypeMatchesCategoryType(t *testing.T) {
+	ctx := context.Background()
+	userID := "type_sync_user"
+
+	if err := AddCategory(ctx, userID, "餐費", "支出"); err != nil {
+		t.Fatalf("AddCategory failed: %v", err)
+	}
+	categoryID, categoryType, err := GetCategoryIdAndType(ctx, userID, "餐費")
+	if err != nil {
+		t.Fatalf("GetCategoryIdAndType failed: %v", err)
+	}
+
+	// Writes with a mismatched type are rejected
+	if _, err := AddTransaction(ctx, userID, categoryID, "收入", 150, ""); err != ErrTypeMismatch {
+		t.Fatalf("Expected ErrTypeMismatch, got %v", err)
+	}
+
+	// So are writes into another user's category
+	if _, err := AddTransaction(ctx, "type_sync_other_user", categoryID, categoryType, 150, ""); err != ErrTypeMismatch {
+		t.Fatalf("Expected ErrTypeMismatch for another user's category, got %v", err)
+	}
+
+	if _, err := AddTransaction(ctx, userID, categoryID, categoryType, 150, ""); err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+
+	// Simulate drift from before the consistency check existed
+	if _, err := db.ExecContext(ctx, `UPDATE transactions SET type = '收入' WHERE user_id = $1`, userID); err != nil {
+		t.Fatalf("Failed to corrupt transaction type: %v", err)
+	}
+
+	fixed, err := ReconcileTransactionTypes(ctx, userID)
+	if err != nil {
+		t.Fatalf("ReconcileTransactionTypes failed: %v", err)
+	}
+	if len(fixed) != 1 {
+		t.Errorf("Expected 1 corrected row, got %d", len(fixed))
+	}
+
+	// Running it again is a no-op
+	fixed, err = ReconcileTransactionTypes(ctx, userID)
+	if err != nil || len(fixed) != 0 {
+		t.Errorf("Expected idempotent reconcile, got fixed=%d err=%v", len(fixed), err)
+	}
+
+	var mismatched int
+	err = db.QueryRowContext(ctx, `
+        SELECT COUNT(*) FROM transactions t
+        JOIN categories c ON t.category_id = c.id
+        WHERE t.user_id = $1 AND t.type <> c.type
+    `, userID).Scan(&mismatched)
+	if err != nil {
+		t.Fatalf("Failed to count mismatched rows: %v", err)
+	}
+	if mismatched != 0 {
+		t.Errorf("Expected no mismatched rows, got %d", mismatched)
+	}
+}
+
+func TestAddTransactionReturnsID(t *testing.T) {
+	ctx := context.Background()
+	userID := "returning_id_user"
+
+	if err := AddCategory(ctx, userID, "午餐", "支出"); err != nil {
+		t.Fatalf("AddCategory failed: %v", err)
+	}
+	categoryID, categoryType, err := GetCategoryIdAndType(ctx, userID, "午餐")
+	if err != nil {
+		t.Fatalf("GetCategoryIdAndType failed: %v", err)
+	}
+
+	transaction, err := AddTransaction(ctx, userID, categoryID, categoryType, 150, "")
+	if err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+	if transaction.ID == 0 {
+		t.Fatal("Expected non-zero transaction ID")
+	}
+
+	var amount int
+	err = db.QueryRowContext(ctx, `
+        SELECT amount FROM transactions WHERE id = $1 AND user_id = $2
+    `, transaction.ID, userID).Scan(&amount)
+	if err != nil {
+		t.Fatalf("Failed to select inserted transaction: %v", err)
+	}
+	if amount != 150 {
+		t.Errorf("Expected amount 150, got %d", amount)
+	}
+}
+
+func TestAddTransactionWithNote(t *testing.T) {
+	ctx := context.Background()
+	userID := "note_user"
+
+	if err := AddCategory(ctx, userID, "午餐", "支出"); err != nil {
+		t.Fatalf("AddCategory failed: %v", err)
+	}
+	categoryID, categoryType, err := GetCategoryIdAndType(ctx, userID, "午餐")
+	if err != nil {
+		t.Fatalf("GetCategoryIdAndType failed: %v", err)
+	}
+
+	if _, err := AddTransaction(ctx, userID, categoryID, categoryType, 120, ""); err != nil {
+		t.Fatalf("AddTransaction without note failed: %v", err)
+	}
+	if _, err := AddTransaction(ctx, userID, categoryID, categoryType, 150, "便當店"); err != nil {
+		t.Fatalf("AddTransaction with note failed: %v", err)
+	}
+
+	transactions, err := GetTransactions(ctx, userID, 10)
+	if err != nil {
+		t.Fatalf("GetTransactions failed: %v", err)
+	}
+
+	notes := make(map[int]string)
+	for _, tr := range transactions {
+		notes[tr.Amount] = tr.Note
+	}
+	if notes[150] != "便當店" {
+		t.Errorf("Expected note 便當店, got %q", notes[150])
+	}
+	if notes[120] != "" {
+		t.Errorf("Expected empty note, got %q", notes[120])
+	}
+}
+
+func TestAttachToLatestTransaction(t *testing.T) {
+	ctx := context.Background()
+	userID := "attachment_user"
+
+	if err := AddCategory(ctx, userID, "午餐", "支出"); err != nil {
+		t.Fatalf("AddCategory failed: %v", err)
+	}
+	categoryID, categoryType, err := GetCategoryIdAndType(ctx, userID, "午餐")
+	if err != nil {
+		t.Fatalf("GetCategoryIdAndType failed: %v", err)
+	}
+
+	now := time.Now()
+
+	// Nothing recorded yet inside the window
+	if _, err := AttachToLatestTransaction(ctx, userID, "line:1", now.Add(-10*time.Minute)); err != ErrTransactionNotFound {
+		t.Fatalf("Expected ErrTransactionNotFound, got %v", err)
+	}
+
+	older, err := AddTransactionAt(ctx, userID, categoryID, categoryType, 100, "", now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("AddTransactionAt failed: %v", err)
+	}
+	latest, err := AddTransactionAt(ctx, userID, categoryID, categoryType, 150, "", now)
+	if err != nil {
+		t.Fatalf("AddTransactionAt failed: %v", err)
+	}
+
+	detail, err := AttachToLatestTransaction(ctx, userID, "line:12345", now.Add(-10*time.Minute))
+	if err != nil {
+		t.Fatalf("AttachToLatestTransaction failed: %v", err)
+	}
+	if detail.ID != latest.ID || detail.Category != "午餐" || detail.Amount != 150 {
+		t.Errorf("Unexpected attached transaction: %+v", detail)
+	}
+
+	attachment, err := GetTransactionAttachment(ctx, userID, latest.ID)
+	if err != nil || attachment != "line:12345" {
+		t.Errorf("Expected attachment line:12345, got %q (err=%v)", attachment, err)
+	}
+
+	attachment, err = GetTransactionAttachment(ctx, userID, older.ID)
+	if err != nil || attachment != "" {
+		t.Errorf("Expected older transaction to have no attachment, got %q (err=%v)", attachment, err)
+	}
+
+	// Other users cannot read the attachment
+	if _, err := GetTransactionAttachment(ctx, "someone_else", latest.ID); err != ErrTransactionNotFound {
+		t.Errorf("Expected ErrTransactionNotFound for another user, got %v", err)
+	}
+}
+
+func TestWithTxRollsBackOnError(t *testing.T) {
+	ctx := context.Background()
+	userID := "with_tx_user"
+
+	if err := AddCategory(ctx, userID, "餐費", "支出"); err != nil {
+		t.Fatalf("AddCategory failed: %v", err)
+	}
+	categoryID, categoryType, err := GetCategoryIdAndType(ctx, userID, "餐費")
+	if err != nil {
+		t.Fatalf("GetCategoryIdAndType failed: %v", err)
+	}
+
+	errBoom := errors.New("boom")
+	err = db.WithTx(ctx, func(tx *sql.Tx) error {
+		for _, amount := range []int{100, 200} {
+			if _, err := AddTransactionTx(ctx, tx, userID, categoryID, categoryType, amount, "", time.Now()); err != nil {
+				return err
+			}
+		}
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("Expected callback error, got %v", err)
+	}
+
+	transactions, err := GetTransactions(ctx, userID, 10)
+	if err != nil {
+		t.Fatalf("GetTransactions failed: %v", err)
+	}
+	if len(transactions) != 0 {
+		t.Errorf("Expected no rows after rollback, got %d", len(transactions))
+	}
+
+	err = db.WithTx(ctx, func(tx *sql.Tx) error {
+		_, err := AddTransactionTx(ctx, tx, userID, categoryID, categoryType, 300, "", time.Now())
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTx failed: %v", err)
+	}
+
+	transactions, err = GetTransactions(ctx, userID, 10)
+	if err != nil {
+		t.Fatalf("GetTransactions failed: %v", err)
+	}
+	if len(transactions) != 1 || transactions[0].Amount != 300 {
+		t.Errorf("Expected the committed $300 row, got %+v", transactions)
+	}
+}
+
+func TestUpdateTransactionTypeOverride(t *testing.T) {
+	ctx := context.Background()
+	userID := "type_override_user"
+
+	if err := AddCategory(ctx, userID, "購物", "支出"); err != nil {
+		t.Fatalf("AddCategory failed: %v", err)
+	}
+	categoryID, categoryType, err := GetCategoryIdAndType(ctx, userID, "購物")
+	if err != nil {
+		t.Fatalf("GetCategoryIdAndType failed: %v", err)
+	}
+
+	purchase, err := AddTransaction(ctx, userID, categoryID, categoryType, 1000, "")
+	if err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+	refund, err := AddTransaction(ctx, userID, categoryID, categoryType, 300, "退款")
+	if err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+
+	if _, err := UpdateTransactionType(ctx, userID, refund.ID, "收入"); err != nil {
+		t.Fatalf("UpdateTransactionType failed: %v", err)
+	}
+
+	// The override must survive reconciliation
+	if _, err := ReconcileTransactionTypes(ctx, userID); err != nil {
+		t.Fatalf("ReconcileTransactionTypes failed: %v", err)
+	}
+
+	summary, err := GetMonthlySummary(ctx, userID, time.Now())
+	if err != nil {
+		t.Fatalf("GetMonthlySummary failed: %v", err)
+	}
+	if summary.IncomeTotal != 300 || summary.ExpenseTotal != 1000 {
+		t.Errorf("Expected income 300 and expense 1000, got %d and %d", summary.IncomeTotal, summary.ExpenseTotal)
+	}
+	if summary.IncomeCategoryTotals["購物"] != 300 || summary.ExpenseCategoryTotals["購物"] != 1000 {
+		t.Errorf("Unexpected per-type category totals: %+v", summary)
+	}
+
+	if _, err := UpdateTransactionType(ctx, userID, purchase.ID+refund.ID+1000, "收入"); err != ErrTransactionNotFound {
+		t.Errorf("Expected ErrTransactionNotFound, got %v", err)
+	}
+	if _, err := UpdateTransactionType(ctx, "someone_else", refund.ID, "支出"); err != ErrTransactionNotFound {
+		t.Errorf("Expected another user's transaction to be untouched, got %v", err)
+	}
+}
+
+func TestAddCategoryRejectsInvalidType(t *testing.T) {
+	ctx := context.Background()
+	userID := "invalid_type_user"
+
+	if err := AddCategory(ctx, userID, "午餐", "foo"); err != ErrInvalidCategoryType {
+		t.Fatalf("Expected ErrInvalidCategoryType, got %v", err)
+	}
+	if _, _, err := GetCategoryIdAndType(ctx, userID, "午餐"); err == nil {
+		t.Error("Expected no category to be created for an invalid type")
+	}
+
+	for _, typeName := range []string{"收入", "支出"} {
+		if err := AddCategory(ctx, userID, "類別"+typeName, typeName); err != nil {
+			t.Errorf("AddCategory with type %s failed: %v", typeName, err)
+		}
+	}
+}
+
+func TestFormatTransactionsCSV(t *testing.T) {
+	details := []TransactionDetail{
+		{Type: "支出", Category: "餐費", Amount: 15000, Currency: "TWD", Note: "", CreatedAt: time.Date(2025, 5, 3, 12, 0, 0, 0, time.UTC)},
+		{Type: "收入", Category: "薪資", Amount: 5000050, Currency: "USD", Note: "五月, 含加班", CreatedAt: time.Date(2025, 5, 5, 9, 0, 0, 0, time.UTC)},
+	}
+
+	got, err := formatTransactionsCSV(details, time.UTC)
+	if err != nil {
+		t.Fatalf("formatTransactionsCSV failed: %v", err)
+	}
+
+	expected := "date,type,category,amount,currency,note\n" +
+		"2025-05-03,支出,餐費,150,TWD,\n" +
+		"2025-05-05,收入,薪資,50000.50,USD,\"五月, 含加班\"\n"
+	if got != expected {
+		t.Errorf("Unexpected CSV:\n%s\nexpected:\n%s", got, expected)
+	}
+
+	empty, err := formatTransactionsCSV(nil, time.UTC)
+	if err != nil || empty != "date,type,category,amount,currency,note\n" {
+		t.Errorf("Expected only the header for no rows, got %q (err: %v)", empty, err)
+	}
+}
+
+func TestMonthlySummaryMidnightBoundary(t *testing.T) {
+	ctx := context.Background()
+	userID := "midnight_user"
+
+	taipei, err := time.LoadLocation("Asia/Taipei")
+	if err != nil {
+		t.Fatalf("Failed to load timezone: %v", err)
+	}
+
+	if err := AddCategory(ctx, userID, "宵夜", "支出"); err != nil {
+		t.Fatalf("AddCategory failed: %v", err)
+	}
+	categoryID, categoryType, err := GetCategoryIdAndType(ctx, userID, "宵夜")
+	if err != nil {
+		t.Fatalf("GetCategoryIdAndType failed: %v", err)
+	}
+
+	// 00:30 on June 1st in Taipei is still May 31st in UTC
+	createdAt := time.Date(2025, 6, 1, 0, 30, 0, 0, taipei)
+	if _, err := AddTransactionAt(ctx, userID, categoryID, categoryType, 200, "", createdAt); err != nil {
+		t.Fatalf("AddTransactionAt failed: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		month time.Time
+		want  int
+	}{
+		{name: "June in Taipei", month: time.Date(2025, 6, 1, 0, 0, 0, 0, taipei), want: 200},
+		{name: "May in Taipei", month: time.Date(2025, 5, 1, 0, 0, 0, 0, taipei), want: 0},
+		{name: "May in UTC", month: time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC), want: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary, err := GetMonthlySummary(ctx, userID, tt.month)
+			if err != nil {
+				t.Fatalf("GetMonthlySummary failed: %v", err)
+			}
+			if summary.ExpenseTotal != tt.want {
+				t.Errorf("Expected expense %d, got %d", tt.want, summary.ExpenseTotal)
+			}
+		})
+	}
+}
+
+func TestArchiveOldTransactions(t *testing.T) {
+	ctx := context.Background()
+	userID := "archive_user"
+	otherID := "archive_other_user"
+	now := time.Now()
+	old := now.AddDate(-3, 0, 0)
+	recent := now.AddDate(0, -1, 0)
+
+	for _, uid := range []string{userID, otherID} {
+		if err := AddCategory(ctx, uid, "餐費", "支出"); err != nil {
+			t.Fatalf("AddCategory failed: %v", err)
+		}
+		categoryID, categoryType, err := GetCategoryIdAndType(ctx, uid, "餐費")
+		if err != nil {
+			t.Fatalf("GetCategoryIdAndType failed: %v", err)
+		}
+		if _, err := AddTransactionAt(ctx, uid, categoryID, categoryType, 100, "", old); err != nil {
+			t.Fatalf("AddTransactionAt failed: %v", err)
+		}
+		if _, err := AddTransactionAt(ctx, uid, categoryID, categoryType, 200, "", recent); err != nil {
+			t.Fatalf("AddTransactionAt failed: %v", err)
+		}
+	}
+
+	if err := SetRetentionMonths(ctx, userID, 24); err != nil {
+		t.Fatalf("SetRetentionMonths failed: %v", err)
+	}
+
+	archived, err := ArchiveOldTransactions(ctx, now)
+	if err != nil {
+		t.Fatalf("ArchiveOldTransactions failed: %v", err)
+	}
+	if archived != 1 {
+		t.Errorf("Expected 1 archived row, got %d", archived)
+	}
+
+	transactions, err := GetTransactions(ctx, userID, 10)
+	if err != nil {
+		t.Fatalf("GetTransactions failed: %v", err)
+	}
+	if len(transactions) != 1 || transactions[0].Amount != 200 {
+		t.Errorf("Expected only the recent row to stay, got %+v", transactions)
+	}
+
+	others, err := GetTransactions(ctx, otherID, 10)
+	if err != nil {
+		t.Fatalf("GetTransactions failed: %v", err)
+	}
+	if len(others) != 2 {
+		t.Errorf("Expected a user without retention to keep both rows, got %d", len(others))
+	}
+
+	start, end := old.AddDate(0, 0, -1), now.AddDate(0, 0, 1)
+	summary, err := GetSummaryByRange(ctx, userID, start, end)
+	if err != nil {
+		t.Fatalf("GetSummaryByRange failed: %v", err)
+	}
+	if summary.ExpenseTotal != 200 {
+		t.Errorf("Expected archived rows left out by default, got total %d", summary.ExpenseTotal)
+	}
+
+	summary, err = GetFilteredSummaryByRange(ctx, userID, start, end, SummaryFilter{IncludeArchived: true})
+	if err != nil {
+		t.Fatalf("GetFilteredSummaryByRange failed: %v", err)
+	}
+	if summary.ExpenseTotal != 300 {
+		t.Errorf("Expected archived rows counted when opted in, got total %d", summary.ExpenseTotal)
+	}
+}
+
+func TestGetAnnualSummary(t *testing.T) {
+	ctx := context.Background()
+	userID := "annual_user"
+	loc := config.Location()
+
+	if err := AddCategory(ctx, userID, "餐費", "支出"); err != nil {
+		t.Fatalf("AddCategory failed: %v", err)
+	}
+	if err := AddCategory(ctx, userID, "薪水", "收入"); err != nil {
+		t.Fatalf("AddCategory failed: %v", err)
+	}
+
+	add := func(category string, amount int, createdAt time.Time) {
+		categoryID, categoryType, err := GetCategoryIdAndType(ctx, userID, category)
+		if err != nil {
+			t.Fatalf("GetCategoryIdAndType failed: %v", err)
+		}
+		if _, err := AddTransactionAt(ctx, userID, categoryID, categoryType, amount, "", createdAt); err != nil {
+			t.Fatalf("AddTransactionAt failed: %v", err)
+		}
+	}
+
+	add("餐費", 100, time.Date(2025, 1, 1, 0, 0, 0, 0, loc))
+	add("餐費", 200, time.Date(2025, 1, 31, 23, 59, 0, 0, loc))
+	add("薪水", 5000, time.Date(2025, 6, 5, 12, 0, 0, 0, loc))
+	add("餐費", 300, time.Date(2025, 12, 31, 23, 59, 0, 0, loc))
+	// Outside the year on both sides
+	add("餐費", 999, time.Date(2024, 12, 31, 23, 59, 0, 0, loc))
+	add("餐費", 999, time.Date(2026, 1, 1, 0, 0, 0, 0, loc))
+
+	annual, err := GetAnnualSummary(ctx, userID, 2025)
+	if err != nil {
+		t.Fatalf("GetAnnualSummary failed: %v", err)
+	}
+
+	if annual.Months[0].Expense != 300 || annual.Months[5].Income != 5000 || annual.Months[11].Expense != 300 {
+		t.Errorf("Unexpected monthly totals: %+v", annual.Months)
+	}
+	if annual.Total.ExpenseTotal != 600 || annual.Total.IncomeTotal != 5000 {
+		t.Errorf("Expected totals 600/5000, got %d/%d", annual.Total.ExpenseTotal, annual.Total.IncomeTotal)
+	}
+	if annual.Total.ExpenseCategoryTotals["餐費"] != 600 {
+		t.Errorf("Expected 餐費 total 600, got %d", annual.Total.ExpenseCategoryTotals["餐費"])
+	}
+}
+
+func TestSoftDeleteAndRestore(t *testing.T) {
+	ctx := context.Background()
+	userID := "soft_delete_user"
+	month := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	if err := AddCategory(ctx, userID, "餐費", "支出"); err != nil {
+		t.Fatalf("AddCategory failed: %v", err)
+	}
+	categoryID, categoryType, err := GetCategoryIdAndType(ctx, userID, "餐費")
+	if err != nil {
+		t.Fatalf("GetCategoryIdAndType failed: %v", err)
+	}
+	kept, err := AddTransactionAt(ctx, userID, categoryID, categoryType, 100, "", month.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("AddTransactionAt failed: %v", err)
+	}
+	deleted, err := AddTransactionAt(ctx, userID, categoryID, categoryType, 250, "", month.AddDate(0, 0, 2))
+	if err != nil {
+		t.Fatalf("AddTransactionAt failed: %v", err)
+	}
+
+	if err := DeleteTransaction(ctx, deleted.ID); err != nil {
+		t.Fatalf("DeleteTransaction failed: %v", err)
+	}
+
+	summary, err := GetMonthlySummary(ctx, userID, month)
+	if err != nil {
+		t.Fatalf("GetMonthlySummary failed: %v", err)
+	}
+	if summary.ExpenseTotal != kept.Amount {
+		t.Errorf("Expected the deleted record to be left out, got expense total %d", summary.ExpenseTotal)
+	}
+	if _, err := GetTransactionByID(ctx, userID, deleted.ID); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("Expected ErrTransactionNotFound for a deleted record, got %v", err)
+	}
+	if ids, _ := FindTransactionIDs(ctx, userID, "餐費", 250); len(ids) != 0 {
+		t.Errorf("Expected FindTransactionIDs to skip the deleted record, got %v", ids)
+	}
+
+	// Outside the window nothing is restored
+	if _, err := RestoreTransaction(ctx, userID, deleted.ID, time.Now().Add(time.Hour)); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("Expected ErrTransactionNotFound outside the window, got %v", err)
+	}
+	if _, err := RestoreTransaction(ctx, "someone_else", deleted.ID, time.Now().Add(-time.Hour)); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("Expected another user not to restore the record, got %v", err)
+	}
+
+	restored, err := RestoreLastTransaction(ctx, userID, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("RestoreLastTransaction failed: %v", err)
+	}
+	if restored.ID != deleted.ID || restored.Amount != 250 {
+		t.Errorf("Expected record %d to be restored, got %+v", deleted.ID, restored)
+	}
+
+	summary, err = GetMonthlySummary(ctx, userID, month)
+	if err != nil {
+		t.Fatalf("GetMonthlySummary failed: %v", err)
+	}
+	if summary.ExpenseTotal != 350 {
+		t.Errorf("Expected the restored record to count again, got expense total %d", summary.ExpenseTotal)
+	}
+
+	// A live record cannot be restored again
+	if _, err := RestoreTransaction(ctx, userID, deleted.ID, time.Now().Add(-time.Hour)); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("Expected ErrTransactionNotFound for a live record, got %v", err)
+	}
+}
+
+func TestGetSpendingAverages(t *testing.T) {
+	ctx := context.Background()
+	userID := "averages_user"
+	loc := config.Location()
+
+	if err := AddCategory(ctx, userID, "餐費", "支出"); err != nil {
+		t.Fatalf("AddCategory failed: %v", err)
+	}
+	if err := AddCategory(ctx, userID, "交通", "支出"); err != nil {
+		t.Fatalf("AddCategory failed: %v", err)
+	}
+	if err := AddCategory(ctx, userID, "薪水", "收入"); err != nil {
+		t.Fatalf("AddCategory failed: %v", err)
+	}
+
+	add := func(category string, amount int, createdAt time.Time) {
+		categoryID, categoryType, err := GetCategoryIdAndType(ctx, userID, category)
+		if err != nil {
+			t.Fatalf("GetCategoryIdAndType failed: %v", err)
+		}
+		if _, err := AddTransactionAt(ctx, userID, categoryID, categoryType, amount, "", createdAt); err != nil {
+			t.Fatalf("AddTransactionAt failed: %v", err)
+		}
+	}
+
+	empty, err := GetSpendingAverages(ctx, userID, "餐費")
+	if err != nil {
+		t.Fatalf("GetSpendingAverages failed: %v", err)
+	}
+	if empty.Count != 0 || empty.PerActiveDay() != 0 || empty.PerMonth() != 0 {
+		t.Errorf("Expected zero averages without data, got %+v", empty)
+	}
+
+	// A single day of data
+	add("交通", 90, time.Date(2025, 3, 10, 8, 0, 0, 0, loc))
+	add("交通", 30, time.Date(2025, 3, 10, 18, 0, 0, 0, loc))
+	single, err := GetSpendingAverages(ctx, userID, "交通")
+	if err != nil {
+		t.Fatalf("GetSpendingAverages failed: %v", err)
+	}
+	if single.ActiveDays != 1 || single.Months != 1 || single.PerActiveDay() != 120 || single.PerMonth() != 120 {
+		t.Errorf("Unexpected single-day averages: %+v", single)
+	}
+
+	// Three active days across January to March
+	add("餐費", 100, time.Date(2025, 1, 5, 12, 0, 0, 0, loc))
+	add("餐費", 200, time.Date(2025, 1, 5, 19, 0, 0, 0, loc))
+	add("餐費", 300, time.Date(2025, 3, 31, 23, 30, 0, 0, loc))
+	add("薪水", 50000, time.Date(2025, 2, 5, 9, 0, 0, 0, loc))
+
+	meals, err := GetSpendingAverages(ctx, userID, "餐費")
+	if err != nil {
+		t.Fatalf("GetSpendingAverages failed: %v", err)
+	}
+	if meals.Total != 600 || meals.ActiveDays != 2 || meals.Months != 3 {
+		t.Errorf("Unexpected 餐費 averages: %+v", meals)
+	}
+	if meals.PerActiveDay() != 300 || meals.PerMonth() != 200 {
+		t.Errorf("Expected 300 per day and 200 per month, got %d and %d", meals.PerActiveDay(), meals.PerMonth())
+	}
+
+	// Income is left out of the overall averages
+	overall, err := GetSpendingAverages(ctx, userID, "")
+	if err != nil {
+		t.Fatalf("GetSpendingAverages failed: %v", err)
+	}
+	if overall.Total != 720 || overall.ActiveDays != 3 || overall.Months != 3 {
+		t.Errorf("Unexpected overall averages: %+v", overall)
+	}
+
+	if _, err := GetSpendingAverages(ctx, userID, "不存在"); !errors.Is(err, ErrCategoryNotFound) {
+		t.Errorf("Expected ErrCategoryNotFound, got %v", err)
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+		err   error
+	}{
+		{input: "45", want: 4500},
+		{input: "45.5", want: 4550},
+		{input: "45.50", want: 4550},
+		{input: "0.05", want: 5},
+		// More than two decimals is rejected, not rounded
+		{input: "45.555", err: ErrAmountPrecision},
+		{input: "45.", err: ErrInvalidAmount},
+		{input: ".5", err: ErrInvalidAmount},
+		{input: "-45", err: ErrInvalidAmount},
+		{input: "-45", err: ErrNegativeAmount},
+		{input: "--45", err: ErrInvalidAmount},
+		{input: "-45.555", err: ErrAmountPrecision},
+		{input: "1e3", err: ErrInvalidAmount},
+		{input: "abc", err: ErrInvalidAmount},
+		{input: "", err: ErrInvalidAmount},
+		{input: "1234567890123456", err: ErrInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.input)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("ParseAmount(%q) = %d, %v; want %d, %v", tt.input, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := map[int]string{
+		4500:  "45",
+		4550:  "45.50",
+		5:     "0.05",
+		0:     "0",
+		-1230: "-12.30",
+		-5:    "-0.05",
+	}
+	for cents, want := range tests {
+		if got := FormatAmount(cents); got != want {
+			t.Errorf("FormatAmount(%d) = %q, want %q", cents, got, want)
+		}
+	}
+}
+
+func TestSummaryKeepsCurrenciesApart(t *testing.T) {
+	ctx := context.Background()
+	userID := "currency_user"
+	month := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	if err := AddCategory(ctx, userID, "餐費", "支出"); err != nil {
+		t.Fatalf("AddCategory failed: %v", err)
+	}
+	categoryID, categoryType, err := GetCategoryIdAndType(ctx, userID, "餐費")
+	if err != nil {
+		t.Fatalf("GetCategoryIdAndType failed: %v", err)
+	}
+
+	day := month.AddDate(0, 0, 2)
+	if _, err := AddTransactionAt(ctx, userID, categoryID, categoryType, 15000, "", day); err != nil {
+		t.Fatalf("AddTransactionAt failed: %v", err)
+	}
+	if _, err := AddTransactionInCurrency(ctx, userID, categoryID, categoryType, 2000, "USD", "", day); err != nil {
+		t.Fatalf("AddTransactionInCurrency failed: %v", err)
+	}
+	if _, err := AddTransactionInCurrency(ctx, userID, categoryID, categoryType, 550, "USD", "", day); err != nil {
+		t.Fatalf("AddTransactionInCurrency failed: %v", err)
+	}
+	if _, err := AddTransactionInCurrency(ctx, userID, categoryID, categoryType, 100000, "JPY", "", day); err != nil {
+		t.Fatalf("AddTransactionInCurrency failed: %v", err)
+	}
+
+	summary, err := GetMonthlySummary(ctx, userID, month)
+	if err != nil {
+		t.Fatalf("GetMonthlySummary failed: %v", err)
+	}
+
+	// The existing totals only count the default currency
+	if summary.ExpenseTotal != 15000 || summary.ExpenseCategoryTotals["餐費"] != 15000 {
+		t.Errorf("Expected only TWD in the main totals, got %d / %v", summary.ExpenseTotal, summary.ExpenseCategoryTotals)
+	}
+	want := map[string]CurrencyTotals{
+		"TWD": {Expense: 15000},
+		"USD": {Expense: 2550},
+		"JPY": {Expense: 100000},
+	}
+	if len(summary.Currencies) != len(want) {
+		t.Errorf("Expected %d currencies, got %v", len(want), summary.Currencies)
+	}
+	for code, totals := range want {
+		if summary.Currencies[code] != totals {
+			t.Errorf("Currency %s: expected %+v, got %+v", code, totals, summary.Currencies[code])
+		}
+	}
+
+	transactions, err := GetTransactions(ctx, userID, 10)
+	if err != nil {
+		t.Fatalf("GetTransactions failed: %v", err)
+	}
+	currencies := make(map[string]int)
+	for _, tr := range transactions {
+		currencies[tr.Currency]++
+	}
+	if currencies["TWD"] != 1 || currencies["USD"] != 2 || currencies["JPY"] != 1 {
+		t.Errorf("Unexpected stored currencies: %v", currencies)
+	}
+}
+
+func TestSearchTransactions(t *testing.T) {
+	ctx := context.Background()
+	userID := "search_user"
+
+	if err := AddCategory(ctx, userID, "餐費", "支出"); err != nil {
+		t.Fatalf("AddCategory failed: %v", err)
+	}
+	categoryID, categoryType, err := GetCategoryIdAndType(ctx, userID, "餐費")
+	if err != nil {
+		t.Fatalf("GetCategoryIdAndType failed: %v", err)
+	}
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, note := range []string{"排骨便當", "Starbucks 拿鐵", "雞腿便當", "", "100% 果汁", "便利商店"} {
+		if _, err := AddTransactionAt(ctx, userID, categoryID, categoryType, 10000+i, note, base.AddDate(0, 0, i)); err != nil {
+			t.Fatalf("AddTransactionAt failed: %v", err)
+		}
+	}
+
+	details, more, err := SearchTransactions(ctx, userID, "便當", 10)
+	if err != nil {
+		t.Fatalf("SearchTransactions failed: %v", err)
+	}
+	if more || len(details) != 2 || details[0].Note != "雞腿便當" || details[1].Note != "排骨便當" {
+		t.Errorf("Expected the two 便當 records newest first, got %+v (more: %v)", details, more)
+	}
+
+	// ILIKE ignores case
+	if details, _, _ := SearchTransactions(ctx, userID, "starbucks", 10); len(details) != 1 {
+		t.Errorf("Expected a case-insensitive match, got %+v", details)
+	}
+
+	// Wildcards in the query match literally
+	if details, _, _ := SearchTransactions(ctx, userID, "%", 10); len(details) != 1 || details[0].Note != "100% 果汁" {
+		t.Errorf("Expected %% to match only the literal percent sign, got %+v", details)
+	}
+
+	if details, _, _ := SearchTransactions(ctx, userID, "麵", 10); len(details) != 0 {
+		t.Errorf("Expected no matches, got %+v", details)
+	}
+	if details, _, _ := SearchTransactions(ctx, "someone_else", "便當", 10); len(details) != 0 {
+		t.Errorf("Expected another user's notes to be left out, got %+v", details)
+	}
+
+	details, more, err = SearchTransactions(ctx, userID, "便", 2)
+	if err != nil {
+		t.Fatalf("SearchTransactions failed: %v", err)
+	}
+	if !more || len(details) != 2 || details[0].Note != "便利商店" {
+		t.Errorf("Expected the newest 2 of 3 matches and more, got %+v (more: %v)", details, more)
+	}
+}
+
+func TestFindTransactionsByAmountRange(t *testing.T) {
+	ctx := context.Background()
+	userID := "amount_range_user"
+
+	for _, name := range []string{"餐費", "交通"} {
+		if err := AddCategory(ctx, userID, name, "支出"); err != nil {
+			t.Fatalf("AddCategory failed: %v", err)
+		}
+	}
+	mealID, mealType, _ := GetCategoryIdAndType(ctx, userID, "餐費")
+	transportID, transportType, _ := GetCategoryIdAndType(ctx, userID, "交通")
+
+	for _, amount := range []int{5000, 10000, 30000, 50000, 80000} {
+		if _, err := AddTransaction(ctx, userID, mealID, mealType, amount, ""); err != nil {
+			t.Fatalf("AddTransaction failed: %v", err)
+		}
+	}
+	if _, err := AddTransaction(ctx, userID, transportID, transportType, 20000, ""); err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+	if _, err := AddTransactionInCurrency(ctx, userID, mealID, mealType, 30000, "USD", "", time.Now()); err != nil {
+		t.Fatalf("AddTransactionInCurrency failed: %v", err)
+	}
+
+	amounts := func(details []TransactionDetail) []int {
+		var result []int
+		for _, d := range details {
+			result = append(result, d.Amount)
+		}
+		return result
+	}
+
+	// Both bounds are inclusive
+	details, err := FindTransactionsByAmountRange(ctx, userID, 10000, 50000, "")
+	if err != nil {
+		t.Fatalf("FindTransactionsByAmountRange failed: %v", err)
+	}
+	if got := amounts(details); !slices.Equal(got, []int{50000, 30000, 20000, 10000}) {
+		t.Errorf("Expected 500, 300, 200 and 100 largest first, got %v", got)
+	}
+
+	details, _ = FindTransactionsByAmountRange(ctx, userID, 10000, 50000, "餐費")
+	if got := amounts(details); !slices.Equal(got, []int{50000, 30000, 10000}) {
+		t.Errorf("Expected only 餐費 in range, got %v", got)
+	}
+
+	// A zero maximum leaves the range open ended
+	details, _ = FindTransactionsByAmountRange(ctx, userID, 50000, 0, "")
+	if got := amounts(details); !slices.Equal(got, []int{80000, 50000}) {
+		t.Errorf("Expected 800 and 500, got %v", got)
+	}
+
+	if details, _ := FindTransactionsByAmountRange(ctx, userID, 10000, 50000, "娛樂"); len(details) != 0 {
+		t.Errorf("Expected no records for an unknown category, got %+v", details)
+	}
+}
+
+func TestPurgeUserData(t *testing.T) {
+	ctx := context.Background()
+	userID := "purge_model_user"
+
+	if err := AddCategory(ctx, userID, "餐費", "支出"); err != nil {
+		t.Fatalf("AddCategory failed: %v", err)
+	}
+	categoryID, categoryType, _ := GetCategoryIdAndType(ctx, userID, "餐費")
+	for _, amount := range []int{10000, 20000, 30000} {
+		if _, err := AddTransaction(ctx, userID, categoryID, categoryType, amount, ""); err != nil {
+			t.Fatalf("AddTransaction failed: %v", err)
+		}
+	}
+	if _, err := DeleteLastTransaction(ctx, userID); err != nil {
+		t.Fatalf("DeleteLastTransaction failed: %v", err)
+	}
+
+	// Another user's data is left alone
+	if err := AddCategory(ctx, "purge_other_user", "餐費", "支出"); err != nil {
+		t.Fatalf("AddCategory failed: %v", err)
+	}
+
+	result, err := PurgeUserData(ctx, userID)
+	if err != nil {
+		t.Fatalf("PurgeUserData failed: %v", err)
+	}
+	if result.Transactions != 2 || result.Categories != 1 {
+		t.Errorf("Expected 2 transactions and 1 category removed, got %+v", result)
+	}
+
+	var remaining int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM transactions WHERE user_id = $1`, userID).Scan(&remaining); err != nil {
+		t.Fatalf("Failed to count transactions: %v", err)
+	}
+	if remaining != 0 {
+		t.Errorf("Expected soft-deleted transactions to be purged too, %d left", remaining)
+	}
+	if exists, _ := CheckCategoryExists(ctx, "purge_other_user", "餐費", "支出"); !exists {
+		t.Error("Expected another user's category to be kept")
+	}
+}
+
+func TestOccurrence(t *testing.T) {
+	tests := []struct {
+		year  int
+		month time.Month
+		day   int
+		want  string
+	}{
+		{2025, time.January, 15, "2025-01-15"},
+		{2025, time.February, 31, "2025-02-28"},
+		{2024, time.February, 30, "2024-02-29"},
+		{2025, time.April, 31, "2025-04-30"},
+		{2025, time.December + 1, 1, "2026-01-01"},
+	}
+
+	for _, tt := range tests {
+		if got := occurrence(tt.year, tt.month, tt.day).Format(time.DateOnly); got != tt.want {
+			t.Errorf("occurrence(%d, %d, %d) = %s, want %s", tt.year, tt.month, tt.day, got, tt.want)
+		}
+	}
+}
+
+func TestMaterializeRecurringTransactions(t *testing.T) {
+	ctx := context.Background()
+	userID := "recurring_user"
+	loc := config.Location()
+	at := func(month time.Month, day int) time.Time {
+		return time.Date(2025, month, day, 9, 0, 0, 0, loc)
+	}
+
+	if err := AddCategory(ctx, userID, "房租", "支出"); err != nil {
+		t.Fatalf("AddCategory failed: %v", err)
+	}
+	categoryID, _, _ := GetCategoryIdAndType(ctx, userID, "房租")
+
+	// The 1st has passed on 1/20, so the first posting is on 2/1
+	rent, err := AddRecurringTransaction(ctx, userID, categoryID, 1500000, 1, "", at(time.January, 20))
+	if err != nil {
+		t.Fatalf("AddRecurringTransaction failed: %v", err)
+	}
+	if got := rent.NextDue.Format(time.DateOnly); got != "2025-02-01" {
+		t.Errorf("Expected the first posting on 2025-02-01, got %s", got)
+	}
+
+	// Due on the day it is created
+	if _, err := AddRecurringTransaction(ctx, userID, categoryID, 30000, 20, "訂閱", at(time.January, 20)); err != nil {
+		t.Fatalf("AddRecurringTransaction failed: %v", err)
+	}
+
+	materialize := func(now time.Time) int {
+		t.Helper()
+		posted, err := MaterializeRecurringTransactions(ctx, now)
+		if err != nil {
+			t.Fatalf("MaterializeRecurringTransactions failed: %v", err)
+		}
+		return posted
+	}
+
+	if posted := materialize(at(time.January, 20)); posted != 1 {
+		t.Errorf("Expected the item due today to be posted, got %d", posted)
+	}
+	if posted := materialize(at(time.January, 31)); posted != 0 {
+		t.Errorf("Expected nothing due before 2/1, got %d", posted)
+	}
+	if posted := materialize(at(time.February, 1)); posted != 1 {
+		t.Errorf("Expected the rent to be posted on 2/1, got %d", posted)
+	}
+
+	// Running again, as after a restart, posts nothing twice
+	if posted := materialize(at(time.February, 1)); posted != 0 {
+		t.Errorf("Expected no double posting, got %d", posted)
+	}
+
+	// Months missed while the bot was down are caught up: the rent on 3/1 and 4/1 and the
+	// subscription on 2/20 and 3/20, but not on 4/20
+	if posted := materialize(at(time.April, 5)); posted != 4 {
+		t.Errorf("Expected 4 catch-up postings, got %d", posted)
+	}
+
+	details, err := GetTransactionDetails(ctx, userID, at(time.January, 1), at(time.May, 1))
+	if err != nil {
+		t.Fatalf("GetTransactionDetails failed: %v", err)
+	}
+	var dates []string
+	for _, d := range details {
+		dates = append(dates, d.CreatedAt.In(loc).Format(time.DateOnly))
+	}
+	slices.Sort(dates)
+	want := []string{"2025-01-20", "2025-02-01", "2025-02-20", "2025-03-01", "2025-03-20", "2025-04-01"}
+	if !slices.Equal(dates, want) {
+		t.Errorf("Expected postings on %v, got %v", want, dates)
+	}
+
+	recurring, err := ListRecurringTransactions(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListRecurringTransactions failed: %v", err)
+	}
+	if len(recurring) != 2 || recurring[0].NextDue.Format(time.DateOnly) != "2025-05-01" {
+		t.Errorf("Expected the rent to be next due on 2025-05-01, got %+v", recurring)
+	}
+
+	if err := DeleteRecurringTransaction(ctx, userID, rent.ID); err != nil {
+		t.Fatalf("DeleteRecurringTransaction failed: %v", err)
+	}
+	if err := DeleteRecurringTransaction(ctx, "someone_else", recurring[1].ID); !errors.Is(err, ErrRecurringNotFound) {
+		t.Errorf("Expected ErrRecurringNotFound for another user, got %v", err)
+	}
+}
+
+func TestAddTransactionUsesClock(t *testing.T) {
+	ctx := context.Background()
+	userID := "clock_user"
+
+	fixed := time.Date(2023, time.November, 5, 8, 30, 0, 0, time.UTC)
+	original := Clock
+	Clock = clock.NewFake(fixed)
+	defer func() { Clock = original }()
+
+	if err := AddCategory(ctx, userID, "餐費", "支出"); err != nil {
+		t.Fatalf("AddCategory failed: %v", err)
+	}
+	categoryID, categoryType, _ := GetCategoryIdAndType(ctx, userID, "餐費")
+
+	transaction, err := AddTransaction(ctx, userID, categoryID, categoryType, 10000, "")
+	if err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+	if !transaction.CreatedAt.Equal(fixed) {
+		t.Errorf("Expected the transaction at %v, got %v", fixed, transaction.CreatedAt)
+	}
+
+	details, err := GetTransactionDetails(ctx, userID, fixed.AddDate(0, 0, -1), fixed.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("GetTransactionDetails failed: %v", err)
+	}
+	if len(details) != 1 || !details[0].CreatedAt.Equal(fixed) {
+		t.Errorf("Expected the stored transaction at %v, got %+v", fixed, details)
+	}
+}
+
+func TestChangeCategoryType(t *testing.T) {
+	ctx := context.Background()
+	userID := "change_type_model_user"
+
+	if err := AddCategory(ctx, userID, "獎金", "支出"); err != nil {
+		t.Fatalf("AddCategory failed: %v", err)
+	}
+	categoryID, categoryType, _ := GetCategoryIdAndType(ctx, userID, "獎金")
+	for _, amount := range []int{30000, 20000} {
+		if _, err := AddTransaction(ctx, userID, categoryID, categoryType, amount, ""); err != nil {
+			t.Fatalf("AddTransaction failed: %v", err)
+		}
+	}
+	// A deleted record is not counted as retyped
+	deleted, err := AddTransaction(ctx, userID, categoryID, categoryType, 10000, "")
+	if err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+	if err := DeleteTransaction(ctx, deleted.ID); err != nil {
+		t.Fatalf("DeleteTransaction failed: %v", err)
+	}
+
+	retyped, err := ChangeCategoryType(ctx, userID, "獎金", "收入")
+	if err != nil {
+		t.Fatalf("ChangeCategoryType failed: %v", err)
+	}
+	if retyped != 2 {
+		t.Errorf("Expected 2 transactions retyped, got %d", retyped)
+	}
+
+	if _, newType, _ := GetCategoryIdAndType(ctx, userID, "獎金"); newType != "收入" {
+		t.Errorf("Expected the category to be 收入, got %s", newType)
+	}
+
+	now := time.Now()
+	summary, err := GetSummaryByRange(ctx, userID, now.AddDate(0, 0, -1), now.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("GetSummaryByRange failed: %v", err)
+	}
+	if summary.IncomeTotal != 50000 || summary.ExpenseTotal != 0 {
+		t.Errorf("Expected 500 income and no expense, got %+v", summary)
+	}
+
+	if _, err := ChangeCategoryType(ctx, userID, "獎金", "收入"); !errors.Is(err, ErrCategoryTypeUnchanged) {
+		t.Errorf("Expected ErrCategoryTypeUnchanged, got %v", err)
+	}
+	if _, err := ChangeCategoryType(ctx, userID, "不存在", "收入"); !errors.Is(err, ErrCategoryNotFound) {
+		t.Errorf("Expected ErrCategoryNotFound, got %v", err)
+	}
+}
+
+func TestCategoryTypeChangeDoesNotDrift(t *testing.T) {
+	ctx := context.Background()
+	userID := "type_drift_user"
+
+	if err := AddCategory(ctx, userID, "二手拍", "支出"); err != nil {
+		t.Fatalf("AddCategory failed: %v", err)
+	}
+	categoryID, categoryType, _ := GetCategoryIdAndType(ctx, userID, "二手拍")
+
+	if _, err := AddTransaction(ctx, userID, categoryID, categoryType, 80000, ""); err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+	refund, err := AddTransaction(ctx, userID, categoryID, categoryType, 5000, "運費")
+	if err != nil {
+		t.Fatalf("AddTransaction failed: %v", err)
+	}
+	// Overridden to 收入 while the category is still 支出
+	if _, err := UpdateTransactionType(ctx, userID, refund.ID, "收入"); err != nil {
+		t.Fatalf("UpdateTransactionType failed: %v", err)
+	}
+
+	// Changing the category behind the model's back used to leave its records as 支出,
+	// so the summary kept counting them as expenses
+	if _, err := db.ExecContext(ctx, `UPDATE categories SET type = '收入' WHERE id = $1`, categoryID); err != nil {
+		t.Fatalf("Failed to change category type: %v", err)
+	}
+
+	summary, err := GetMonthlySummary(ctx, userID, time.Now())
+	if err != nil {
+		t.Fatalf("GetMonthlySummary failed: %v", err)
+	}
+	if summary.IncomeTotal != 85000 || summary.ExpenseTotal != 0 {
+		t.Errorf("Expected income 850 and no expense, got %d and %d", summary.IncomeTotal, summary.ExpenseTotal)
+	}
+
+	// Back to 支出: the override is kept and only the other record follows the category
+	if _, err := db.ExecContext(ctx, `UPDATE categories SET type = '支出' WHERE id = $1`, categoryID); err != nil {
+		t.Fatalf("Failed to change category type: %v", err)
+	}
+	summary, err = GetMonthlySummary(ctx, userID, time.Now())
+	if err != nil {
+		t.Fatalf("GetMonthlySummary failed: %v", err)
+	}
+	if summary.IncomeTotal != 5000 || summary.ExpenseTotal != 80000 {
+		t.Errorf("Expected the overridden refund to stay income, got income %d and expense %d", summary.IncomeTotal, summary.ExpenseTotal)
+	}
+}
+
+func TestGetTransactionsWithoutNote(t *testing.T) {
+	ctx := context.Background()
+	userID := "missing_note_model_user"
+
+	if err := AddCategory(ctx, userID, "餐費", "支出"); err != nil {
+		t.Fatalf("AddCategory failed: %v", err)
+	}
+	categoryID, categoryType, _ := GetCategoryIdAndType(ctx, userID, "餐費")
+
+	now := time.Now()
+	for _, tx := range []struct {
+		amount    int
+		note      string
+		createdAt time.Time
+	}{
+		{10000, "便當", now},
+		{20000, "", now},
+		{30000, "", now.AddDate(0, -2, 0)},
+	} {
+		if _, err := AddTransactionInCurrency(ctx, userID, categoryID, categoryType, tx.amount, DefaultCurrency, tx.note, tx.createdAt); err != nil {
+			t.Fatalf("AddTransactionInCurrency failed: %v", err)
+		}
+	}
+	// An empty string that bypassed NULLIF still counts as no note
+	if _, err := db.ExecContext(ctx, `
+        INSERT INTO transactions (user_id, category_id, type, amount, currency, note, created_at)
+        VALUES ($1, $2, $3, 40000, $4, '', $5)
+    `, userID, categoryID, categoryType, DefaultCurrency, now); err != nil {
+		t.Fatalf("Failed to insert transaction with an empty note: %v", err)
+	}
+
+	start := now.AddDate(0, 0, -1)
+	details, err := GetTransactionsWithoutNote(ctx, userID, start, now.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("GetTransactionsWithoutNote failed: %v", err)
+	}
+
+	var amounts []int
+	for _, d := range details {
+		amounts = append(amounts, d.Amount)
+	}
+	if !slices.Equal(amounts, []int{20000, 40000}) {
+		t.Errorf("Expected only this period's records without a note, got %v", amounts)
+	}
+}
+
+func TestMergeCategoriesKeepsArchived(t *testing.T) {
+	ctx := context.Background()
+	userID := "merge_archive_user"
+	now := time.Now()
+
+	for _, name := range []string{"外食", "餐費"} {
+		if err := AddCategory(ctx, userID, name, "支出"); err != nil {
+			t.Fatalf("AddCategory failed: %v", err)
+		}
+	}
+	sourceID, sourceType, err := GetCategoryIdAndType(ctx, userID, "外食")
+	if err != nil {
+		t.Fatalf("GetCategoryIdAndType failed: %v", err)
+	}
+	if _, err := AddTransactionAt(ctx, userID, sourceID, sourceType, 100, "", now.AddDate(-2, 0, 0)); err != nil {
+		t.Fatalf("AddTransactionAt failed: %v", err)
+	}
+	if _, err := AddTransactionAt(ctx, userID, sourceID, sourceType, 200, "", now); err != nil {
+		t.Fatalf("AddTransactionAt failed: %v", err)
+	}
+
+	if err := SetRetentionMonths(ctx, userID, 12); err != nil {
+		t.Fatalf("SetRetentionMonths failed: %v", err)
+	}
+	if archived, err := ArchiveOldTransactions(ctx, now); err != nil || archived != 1 {
+		t.Fatalf("Expected 1 archived row, got %d (err: %v)", archived, err)
+	}
+
+	moved, err := MergeCategories(ctx, userID, "外食", "餐費")
+	if err != nil {
+		t.Fatalf("MergeCategories failed: %v", err)
+	}
+	if moved.Transactions != 2 {
+		t.Errorf("Expected 2 moved rows, got %d", moved.Transactions)
+	}
+
+	targetID, _, err := GetCategoryIdAndType(ctx, userID, "餐費")
+	if err != nil {
+		t.Fatalf("GetCategoryIdAndType failed: %v", err)
+	}
+	var archivedCount int
+	if err := db.QueryRowContext(ctx, `
+        SELECT COUNT(*) FROM archived_transactions WHERE user_id = $1 AND category_id = $2
+    `, userID, targetID).Scan(&archivedCount); err != nil {
+		t.Fatalf("Count archived failed: %v", err)
+	}
+	if archivedCount != 1 {
+		t.Errorf("Expected the archived row to move to the target, got %d", archivedCount)
+	}
+}
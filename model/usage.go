@@ -0,0 +1,65 @@
+package model
+
+import (
+	"accountingbot/db"
+	"accountingbot/logger"
+	"context"
+	"time"
+)
+
+// CommandCount is how many times a user ran a command
+type CommandCount struct {
+	Command string
+	Count   int
+}
+
+// RecordCommandUsage records that the user ran a command
+func RecordCommandUsage(ctx context.Context, userID, command string) error {
+	ctx, span := logger.StartSpan(ctx, "models.RecordCommandUsage")
+	defer span.End()
+
+	_, err := db.ExecContext(ctx, `
+        INSERT INTO command_usage (user_id, command) VALUES ($1, $2)
+    `, userID, command)
+
+	if err != nil {
+		logger.Error(ctx, "Failed to record command usage", "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// GetCommandUsage gets the user's command counts since the given time, most used first
+func GetCommandUsage(ctx context.Context, userID string, since time.Time) ([]CommandCount, error) {
+	ctx, span := logger.StartSpan(ctx, "models.GetCommandUsage")
+	defer span.End()
+
+	logger.Info(ctx, "Get command usage", "user_id", userID, "since", since)
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT command, COUNT(*)
+        FROM command_usage
+        WHERE user_id = $1 AND used_at >= $2
+        GROUP BY command
+        ORDER BY COUNT(*) DESC, command
+    `, userID, since)
+	if err != nil {
+		logger.Error(ctx, "Failed to query command usage", "error", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []CommandCount
+
+	for rows.Next() {
+		var c CommandCount
+		if err := rows.Scan(&c.Command, &c.Count); err != nil {
+			logger.Error(ctx, "Failed to parse command usage", "error", err.Error())
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+
+	logger.Info(ctx, "Command usage fetched", "commands", len(counts))
+	return counts, nil
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is a set of token buckets, one per key, each refilled at the same rate.
+// It is safe for concurrent use. A nil *Limiter allows everything.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	rate    float64 // tokens added per second
+	burst   float64 // bucket capacity
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New returns a limiter allowing each key perMinute events per minute, in bursts of up to
+// perMinute. It returns nil, which allows everything, when perMinute is not positive.
+func New(perMinute int) *Limiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &Limiter{
+		buckets: make(map[string]*bucket),
+		rate:    float64(perMinute) / 60,
+		burst:   float64(perMinute),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from key's bucket and reports whether one was available
+func (l *Limiter) Allow(key string) bool {
+	if l == nil {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Cleanup forgets the buckets that have refilled completely, which behave the same as
+// missing ones, and returns how many were removed
+func (l *Limiter) Cleanup() int {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	removed := 0
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Run calls Cleanup every interval until ctx is done
+func (l *Limiter) Run(ctx context.Context, interval time.Duration) {
+	if l == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.Cleanup()
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock for the limiter
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTestLimiter(perMinute int) (*Limiter, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)}
+	l := New(perMinute)
+	l.now = clock.now
+	return l, clock
+}
+
+func TestAllowBurstThenRefill(t *testing.T) {
+	l, clock := newTestLimiter(3)
+
+	for i := 0; i < 3; i++ {
+		if !l.Allow("U1") {
+			t.Fatalf("Expected event %d within the burst to be allowed", i+1)
+		}
+	}
+	if l.Allow("U1") {
+		t.Error("Expected the event over the burst to be rejected")
+	}
+
+	// Other keys have their own bucket
+	if !l.Allow("U2") {
+		t.Error("Expected a different key to be allowed")
+	}
+
+	// 3 per minute refills one token every 20 seconds
+	clock.t = clock.t.Add(19 * time.Second)
+	if l.Allow("U1") {
+		t.Error("Expected no token before 20 seconds")
+	}
+	clock.t = clock.t.Add(time.Second)
+	if !l.Allow("U1") {
+		t.Error("Expected a token after 20 seconds")
+	}
+	if l.Allow("U1") {
+		t.Error("Expected only one token after 20 seconds")
+	}
+
+	// A long pause refills up to the burst and no further
+	clock.t = clock.t.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if !l.Allow("U1") {
+			t.Fatalf("Expected event %d after a pause to be allowed", i+1)
+		}
+	}
+	if l.Allow("U1") {
+		t.Error("Expected the bucket to be capped at the burst")
+	}
+}
+
+func TestCleanupRemovesFullBuckets(t *testing.T) {
+	l, clock := newTestLimiter(60)
+
+	l.Allow("idle")
+	for i := 0; i < 60; i++ {
+		l.Allow("busy")
+	}
+
+	// One second refills the idle bucket but not the busy one
+	clock.t = clock.t.Add(time.Second)
+	if removed := l.Cleanup(); removed != 1 {
+		t.Errorf("Expected 1 bucket removed, got %d", removed)
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("Expected the busy bucket to be kept")
+	}
+	// The busy key regained a single token, not a fresh bucket
+	if !l.Allow("busy") || l.Allow("busy") {
+		t.Error("Expected the busy key to stay limited after cleanup")
+	}
+}
+
+func TestNilLimiterAllowsEverything(t *testing.T) {
+	l := New(0)
+	if l != nil {
+		t.Fatalf("Expected a disabled limiter to be nil, got %+v", l)
+	}
+	for i := 0; i < 100; i++ {
+		if !l.Allow("U1") {
+			t.Fatal("Expected a nil limiter to allow every event")
+		}
+	}
+	if l.Cleanup() != 0 {
+		t.Error("Expected Cleanup on a nil limiter to do nothing")
+	}
+}
+
+func TestAllowConcurrent(t *testing.T) {
+	l, _ := newTestLimiter(50)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if l.Allow("U1") {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 50 {
+		t.Errorf("Expected exactly 50 events allowed, got %d", allowed)
+	}
+}